@@ -0,0 +1,32 @@
+// Command migrate-redis moves spreadsheets stored with the legacy Redis key
+// layout, where spreadsheet ids were used as keys as is, to the namespaced
+// one.
+//
+//	migrate-redis [-delete]
+//
+// Redis is selected with REDIS_ADDR and REDIS_KEY_PREFIX as for the service.
+// The service must be stopped during the migration.
+package main
+
+import (
+	"flag"
+	"log"
+
+	"devchallenge.it/spreadsheet/internal/model"
+)
+
+func main() {
+	deleteOld := flag.Bool("delete", false, "remove the legacy keys once copied")
+	flag.Parse()
+
+	dao, closeDao := model.NewRedisDaoFromEnv()
+	defer closeDao()
+
+	stats, err := dao.MigrateLegacyKeys(*deleteOld)
+	if err != nil {
+		log.Fatalf("Migration failed: %s", err)
+	}
+
+	log.Printf("Migrated %d spreadsheets, %d dependant sets, %d subscriptions, skipped %d keys",
+		stats.Spreadsheets, stats.Dependants, stats.Subscriptions, stats.Skipped)
+}
@@ -0,0 +1,90 @@
+// Command reindex rebuilds the dependency index and the materialized results
+// of the given spreadsheets from their stored formulas, all registered
+// spreadsheets are rebuilt when none is given.
+//
+//	reindex [-all] [<spreadsheet_id>...]
+//
+// Storage is selected with the same environment variables as the service.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"devchallenge.it/spreadsheet/internal/model"
+	"devchallenge.it/spreadsheet/internal/service"
+)
+
+// listPageSize is the number of spreadsheets listed at once with -all.
+const listPageSize = 1000
+
+func main() {
+	all := flag.Bool("all", false, "rebuild all registered spreadsheets")
+	flag.Parse()
+
+	if *all && flag.NArg() > 0 {
+		log.Fatalf("Usage: %s [-all] [<spreadsheet_id>...]", os.Args[0])
+	}
+
+	dao, closeDao, err := model.NewDaoFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %s", err)
+	}
+	defer closeDao()
+
+	failed := false
+	if flag.NArg() > 0 {
+		for _, sheetId := range flag.Args() {
+			if !rebuild(dao, sheetId) {
+				failed = true
+			}
+		}
+	} else {
+		after := ""
+		for {
+			infos, err := dao.ListSpreadsheets("", after, listPageSize)
+			if err != nil {
+				log.Printf("Failed to list spreadsheets: %s", err)
+				failed = true
+				break
+			}
+
+			for _, info := range infos {
+				if !rebuild(dao, info.Id) {
+					failed = true
+				}
+			}
+
+			if len(infos) < listPageSize {
+				break
+			}
+			after = infos[len(infos)-1].Id
+		}
+	}
+
+	if failed {
+		closeDao()
+		os.Exit(1)
+	}
+}
+
+// rebuild reindexes the spreadsheet and reports whether it succeeded.
+func rebuild(dao model.Dao, sheetId string) bool {
+	added, removed, err := service.RebuildDependencyIndex(dao, sheetId)
+	if err != nil {
+		log.Printf("Failed to rebuild %q: %s", sheetId, err)
+		return false
+	}
+
+	log.Printf("Rebuilt %q: %d dependants added, %d stale removed", sheetId, added, removed)
+
+	changed, err := service.RebuildResults(dao, sheetId)
+	if err != nil {
+		log.Printf("Failed to rebuild results of %q: %s", sheetId, err)
+		return false
+	}
+
+	log.Printf("Rebuilt %q: %d results changed", sheetId, changed)
+	return true
+}
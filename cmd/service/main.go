@@ -4,26 +4,55 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 
+	"devchallenge.it/spreadsheet/internal/formula"
 	"devchallenge.it/spreadsheet/internal/model"
 	"devchallenge.it/spreadsheet/internal/service"
 	"github.com/gorilla/mux"
-	"github.com/redis/go-redis/v9"
 )
 
 const ListenAddr = ":8080"
 
 func main() {
-	var redisAddr = os.Getenv("REDIS_ADDR")
+	dao, closeDao, err := model.NewDaoFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %s", err)
+	}
+	defer closeDao()
 
-	rdb := redis.NewClient(&redis.Options{Addr: redisAddr})
+	if sizeEnv := os.Getenv("FORMULA_CACHE_SIZE"); sizeEnv != "" {
+		size, err := strconv.Atoi(sizeEnv)
+		if err != nil {
+			log.Fatalf("Invalid FORMULA_CACHE_SIZE %q", sizeEnv)
+		}
+		formula.SetParseCacheSize(size)
+	}
 
-	dao := model.NewDao(rdb)
+	if evaluatorEnv := os.Getenv("FORMULA_EVALUATOR"); evaluatorEnv != "" {
+		evaluator, err := formula.ParseEvaluator(evaluatorEnv)
+		if err != nil {
+			log.Fatal(err)
+		}
+		formula.SetEvaluator(evaluator)
+	}
 
 	router := mux.NewRouter()
 	apiV1Router := router.PathPrefix("/api/v1").Subrouter()
 
-	service.NewService(apiV1Router, dao)
+	s := service.NewService(apiV1Router, dao)
+	if allowEnv := os.Getenv("WEBHOOK_ALLOW_PRIVATE"); allowEnv != "" {
+		allow, err := strconv.ParseBool(allowEnv)
+		if err != nil {
+			log.Fatalf("Invalid WEBHOOK_ALLOW_PRIVATE %q", allowEnv)
+		}
+		if allow {
+			s.AllowPrivateWebhooks()
+		}
+	}
+	if err := s.ResumeWebhooks(); err != nil {
+		log.Fatalf("Failed to resume webhook deliveries: %s", err)
+	}
 
 	http.Handle("/", WithLogging(router))
 
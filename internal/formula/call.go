@@ -14,6 +14,8 @@ import (
 	"devchallenge.it/spreadsheet/internal/service/client"
 )
 
+var ERROR_OFFLINE = errors.New("EXTERNAL_REF is not evaluated offline")
+
 type FormulaFun func(s *Solver, args []*ast.BasicLit) (*ast.BasicLit, error)
 
 var formulaFunctions = map[string]FormulaFun{
@@ -129,6 +131,11 @@ func evalMax(s *Solver, args []*ast.BasicLit) (*ast.BasicLit, error) {
 }
 
 func evalExternalRef(s *Solver, args []ast.Expr) (*ast.BasicLit, error) {
+	s.markVolatile()
+	if s.offline {
+		return nil, ERROR_OFFLINE
+	}
+
 	if len(args) != 1 {
 		return nil, errors.New("EXTERNAL_REF expects single argument")
 	}
@@ -138,7 +145,11 @@ func evalExternalRef(s *Solver, args []ast.Expr) (*ast.BasicLit, error) {
 		return nil, fmt.Errorf("Invalid EXTERNAL_REF argument type: %s", args[0])
 	}
 
-	url := ident.Name
+	return s.externalRef(ident.Name)
+}
+
+// externalRef reads the result of the cell given by the url.
+func (s *Solver) externalRef(url string) (*ast.BasicLit, error) {
 	val, err := client.RestGetCell(url)
 	if err != nil {
 		return nil, err
@@ -8,9 +8,9 @@ import (
 
 func TestMinCall(t *testing.T) {
 	dao, mock := prepare()
-	mock.ExpectHGet("devchallenge-xx", "var3").SetVal("=MIN(var1, var2)")
-	mock.ExpectHGet("devchallenge-xx", "var1").SetVal("1")
-	mock.ExpectHGet("devchallenge-xx", "var2").SetVal("2")
+	mock.ExpectHGet(testCellsKey, "var3").SetVal("=MIN(var1, var2)")
+	mock.ExpectHGet(testCellsKey, "var1").SetVal("1")
+	mock.ExpectHGet(testCellsKey, "var2").SetVal("2")
 
 	solver := NewSolver(dao, "devchallenge-xx")
 	result, value, formulaError, err := solver.Solve("var3")
@@ -23,9 +23,9 @@ func TestMinCall(t *testing.T) {
 
 func TestMaxCall(t *testing.T) {
 	dao, mock := prepare()
-	mock.ExpectHGet("devchallenge-xx", "var3").SetVal("=MAX(var1, var2)")
-	mock.ExpectHGet("devchallenge-xx", "var1").SetVal("1")
-	mock.ExpectHGet("devchallenge-xx", "var2").SetVal("2")
+	mock.ExpectHGet(testCellsKey, "var3").SetVal("=MAX(var1, var2)")
+	mock.ExpectHGet(testCellsKey, "var1").SetVal("1")
+	mock.ExpectHGet(testCellsKey, "var2").SetVal("2")
 
 	solver := NewSolver(dao, "devchallenge-xx")
 	result, value, formulaError, err := solver.Solve("var3")
@@ -38,9 +38,9 @@ func TestMaxCall(t *testing.T) {
 
 func TestSumCall(t *testing.T) {
 	dao, mock := prepare()
-	mock.ExpectHGet("devchallenge-xx", "var3").SetVal("=SUM(var1, var2)")
-	mock.ExpectHGet("devchallenge-xx", "var1").SetVal("1")
-	mock.ExpectHGet("devchallenge-xx", "var2").SetVal("2")
+	mock.ExpectHGet(testCellsKey, "var3").SetVal("=SUM(var1, var2)")
+	mock.ExpectHGet(testCellsKey, "var1").SetVal("1")
+	mock.ExpectHGet(testCellsKey, "var2").SetVal("2")
 
 	solver := NewSolver(dao, "devchallenge-xx")
 	result, value, formulaError, err := solver.Solve("var3")
@@ -53,9 +53,9 @@ func TestSumCall(t *testing.T) {
 
 func TestAvgCall(t *testing.T) {
 	dao, mock := prepare()
-	mock.ExpectHGet("devchallenge-xx", "var3").SetVal("=AVG(var1, var2)")
-	mock.ExpectHGet("devchallenge-xx", "var1").SetVal("1")
-	mock.ExpectHGet("devchallenge-xx", "var2").SetVal("2")
+	mock.ExpectHGet(testCellsKey, "var3").SetVal("=AVG(var1, var2)")
+	mock.ExpectHGet(testCellsKey, "var1").SetVal("1")
+	mock.ExpectHGet(testCellsKey, "var2").SetVal("2")
 
 	solver := NewSolver(dao, "devchallenge-xx")
 	result, value, formulaError, err := solver.Solve("var3")
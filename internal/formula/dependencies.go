@@ -0,0 +1,51 @@
+package formula
+
+import (
+	"go/ast"
+	"strings"
+)
+
+// Dependencies returns the lowercase identifiers of the cells the value
+// refers to. Function names and EXTERNAL_REF urls are not cells. Values that
+// are not formulas or can not be parsed have no dependencies.
+func Dependencies(value string) []string {
+	if !IsFormula(value) {
+		return nil
+	}
+
+	parsed, err := parseFormula(value[1:])
+	if err != nil {
+		return nil
+	}
+
+	seen := make(map[string]struct{})
+	var dependencies []string
+
+	var inspect func(n ast.Node) bool
+	inspect = func(n ast.Node) bool {
+		switch nod := n.(type) {
+		case *ast.CallExpr:
+			if funIdent, ok := nod.Fun.(*ast.Ident); ok &&
+				strings.EqualFold(funIdent.Name, "EXTERNAL_REF") {
+				return false
+			}
+
+			for _, arg := range nod.Args {
+				ast.Inspect(arg, inspect)
+			}
+			return false
+		case *ast.Ident:
+			cellId := strings.ToLower(nod.Name)
+			if _, exists := seen[cellId]; !exists {
+				seen[cellId] = struct{}{}
+				dependencies = append(dependencies, cellId)
+			}
+			return false
+		}
+
+		return true
+	}
+	ast.Inspect(parsed.tree, inspect)
+
+	return dependencies
+}
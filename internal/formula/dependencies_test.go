@@ -0,0 +1,17 @@
+package formula
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDependencies(t *testing.T) {
+	assert.Nil(t, Dependencies("1"))
+	assert.Nil(t, Dependencies("some string"))
+	assert.Nil(t, Dependencies("=(var1"))
+
+	assert.Equal(t, []string{"var1", "var2"}, Dependencies("=VAR1 + var2 * var1"))
+	assert.Equal(t, []string{"var1", "var2", "var3"}, Dependencies("=SUM(var1, MAX(var2, 1)) / -var3"))
+	assert.Equal(t, []string{"var1"}, Dependencies("=EXTERNAL_REF(http://localhost/api/v1/x/y) + var1"))
+}
@@ -133,8 +133,13 @@ func (s *Solver) evalFloatBinOperator(op token.Token, litX, litY *ast.BasicLit)
 
 func (s *Solver) expandVariable(lit *ast.Ident) (*ast.BasicLit, error) {
 	result, _, formulaErr, err := s.Solve(lit.Name)
+	if s.IsVolatile(lit.Name) {
+		s.markVolatile()
+	}
 	if err != nil {
 		return nil, err
+	} else if formulaErr == NO_SUCH_CELL && s.isDeleted(lit.Name) {
+		return nil, REFERENCE_ERROR
 	} else if formulaErr != nil {
 		return nil, formulaErr
 	}
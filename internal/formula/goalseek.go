@@ -0,0 +1,187 @@
+package formula
+
+import (
+	"errors"
+	"math/big"
+
+	"devchallenge.it/spreadsheet/internal/model"
+)
+
+const DefaultGoalSeekIterations = 100
+
+// Precision of the goal seek arithmetic, the same as of the parsed floats.
+const goalSeekPrec = 64
+
+var GOAL_SEEK_INPUT_ERROR = errors.New("Goal seek input is not a number")
+var GOAL_SEEK_RESULT_ERROR = errors.New("Goal seek target result is not a number")
+var GOAL_SEEK_NOT_CONVERGED = errors.New("Goal seek did not converge")
+
+var defaultGoalSeekTolerance = big.NewFloat(1e-9)
+
+// GoalSeek looks for the Input cell value making the Target cell result equal
+// to Goal within the Tolerance.
+type GoalSeek struct {
+	Target        string
+	Input         string
+	Goal          *big.Float
+	Tolerance     *big.Float
+	MaxIterations int
+
+	// Setting of the spreadsheet the target is evaluated with.
+	Iteration model.IterativeCalculation
+}
+
+// GoalSeekStep is the Target cell Result evaluated with the Input value.
+type GoalSeekStep struct {
+	Input  string
+	Result string
+}
+
+// Run evaluates the target with a fresh solver for every tried input so the
+// cells are never written. It starts from the current input value using the
+// secant method and falls back to bisection once the goal is bracketed. The
+// found input is the last step.
+func (g GoalSeek) Run(source CellSource, spreadsheet string) (steps []GoalSeekStep, err error) {
+	tolerance := g.Tolerance
+	if tolerance == nil {
+		tolerance = defaultGoalSeekTolerance
+	}
+	maxIterations := g.MaxIterations
+	if maxIterations <= 0 {
+		maxIterations = DefaultGoalSeekIterations
+	}
+
+	x0, err := g.start(source, spreadsheet)
+	if err != nil {
+		return nil, err
+	}
+
+	// Last points with the result below and above the goal, the goal is
+	// bracketed when both are known.
+	var below, above *goalSeekPoint
+
+	eval := func(x *big.Float) (*goalSeekPoint, bool, error) {
+		point, step, err := g.eval(source, spreadsheet, x)
+		steps = append(steps, step)
+		if err != nil {
+			return nil, false, err
+		}
+
+		switch point.diff.Sign() {
+		case -1:
+			below = point
+		case 1:
+			above = point
+		}
+
+		diff := new(big.Float).Abs(point.diff)
+		return point, diff.Cmp(tolerance) <= 0, nil
+	}
+
+	p0, found, err := eval(x0)
+	if err != nil || found {
+		return steps, err
+	}
+
+	x1 := new(big.Float).SetPrec(goalSeekPrec).Abs(x0)
+	x1.Quo(x1, big.NewFloat(100))
+	if x1.Sign() == 0 {
+		x1.SetInt64(1)
+	}
+	x1.Add(x0, x1)
+
+	p1, found, err := eval(x1)
+	if err != nil || found {
+		return steps, err
+	}
+
+	for len(steps) < maxIterations {
+		x, ok := secant(p0, p1)
+		if below != nil && above != nil && (!ok || !between(x, below.x, above.x)) {
+			x = new(big.Float).SetPrec(goalSeekPrec).Add(below.x, above.x)
+			x.Quo(x, big.NewFloat(2))
+			ok = true
+		}
+		if !ok {
+			return steps, GOAL_SEEK_NOT_CONVERGED
+		}
+
+		p, found, err := eval(x)
+		if err != nil || found {
+			return steps, err
+		}
+		p0, p1 = p1, p
+	}
+
+	return steps, GOAL_SEEK_NOT_CONVERGED
+}
+
+type goalSeekPoint struct {
+	x    *big.Float
+	diff *big.Float
+}
+
+// start returns the current input value, a missing input starts from zero.
+func (g GoalSeek) start(source CellSource, spreadsheet string) (*big.Float, error) {
+	value, err := source.GetCell(spreadsheet, g.Input)
+	if err == model.ERROR_NO_CELL {
+		return new(big.Float).SetPrec(goalSeekPrec), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	x, _, err := new(big.Float).SetPrec(goalSeekPrec).Parse(value, 10)
+	if err != nil {
+		return nil, GOAL_SEEK_INPUT_ERROR
+	}
+
+	return x, nil
+}
+
+func (g GoalSeek) eval(source CellSource, spreadsheet string, x *big.Float) (*goalSeekPoint, GoalSeekStep, error) {
+	step := GoalSeekStep{Input: x.Text('f', -1)}
+
+	solver := NewSolver(source, spreadsheet)
+	solver.SetIterativeCalculation(g.Iteration)
+	solver.SetCell(g.Input, step.Input)
+
+	result, _, formulaError, err := solver.Solve(g.Target)
+	if err != nil {
+		return nil, step, err
+	}
+	step.Result = result
+	if formulaError != nil {
+		return nil, step, GOAL_SEEK_RESULT_ERROR
+	}
+
+	y, _, err := new(big.Float).SetPrec(goalSeekPrec).Parse(result, 10)
+	if err != nil {
+		return nil, step, GOAL_SEEK_RESULT_ERROR
+	}
+
+	return &goalSeekPoint{x: x, diff: y.Sub(y, g.Goal)}, step, nil
+}
+
+// secant returns the root of the line through both points, not ok when the
+// line is flat.
+func secant(p0, p1 *goalSeekPoint) (*big.Float, bool) {
+	slope := new(big.Float).SetPrec(goalSeekPrec).Sub(p1.diff, p0.diff)
+	if slope.Sign() == 0 {
+		return nil, false
+	}
+
+	dx := new(big.Float).SetPrec(goalSeekPrec).Sub(p1.x, p0.x)
+	dx.Mul(dx, p1.diff)
+	dx.Quo(dx, slope)
+
+	return new(big.Float).SetPrec(goalSeekPrec).Sub(p1.x, dx), true
+}
+
+// between reports whether x lies strictly between a and b.
+func between(x, a, b *big.Float) bool {
+	if a.Cmp(b) > 0 {
+		a, b = b, a
+	}
+	return x.Cmp(a) > 0 && x.Cmp(b) < 0
+}
@@ -0,0 +1,64 @@
+package formula
+
+import (
+	"math/big"
+	"testing"
+
+	"devchallenge.it/spreadsheet/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGoalSeekLinear(t *testing.T) {
+	cells := model.CellsSnapshot{
+		"price":    "10",
+		"quantity": "3",
+		"total":    "=price * quantity",
+	}
+
+	steps, err := GoalSeek{Target: "total", Input: "price", Goal: big.NewFloat(45)}.Run(cells, "sheet")
+	assert.NoError(t, err)
+	assert.Equal(t, GoalSeekStep{Input: "15", Result: "45"}, steps[len(steps)-1])
+	assert.Equal(t, GoalSeekStep{Input: "10", Result: "30"}, steps[0])
+
+	// Cells are not written
+	assert.Equal(t, "10", cells["price"])
+}
+
+func TestGoalSeekNonLinear(t *testing.T) {
+	cells := model.CellsSnapshot{
+		"x":   "1",
+		"sqr": "=x * x * x - 2",
+	}
+
+	steps, err := GoalSeek{Target: "sqr", Input: "x", Goal: big.NewFloat(0), Tolerance: big.NewFloat(1e-6)}.Run(cells, "sheet")
+	assert.NoError(t, err)
+
+	x, _, _ := big.ParseFloat(steps[len(steps)-1].Input, 10, 64, big.ToNearestEven)
+	value, _ := x.Float64()
+	assert.InDelta(t, 1.259921, value, 1e-5)
+}
+
+func TestGoalSeekErrors(t *testing.T) {
+	cells := model.CellsSnapshot{
+		"x":    "=y",
+		"y":    "1",
+		"text": "abc",
+		"flat": "=y * 0",
+	}
+
+	_, err := GoalSeek{Target: "y", Input: "x", Goal: big.NewFloat(0)}.Run(cells, "sheet")
+	assert.Equal(t, GOAL_SEEK_INPUT_ERROR, err)
+
+	steps, err := GoalSeek{Target: "text", Input: "y", Goal: big.NewFloat(0)}.Run(cells, "sheet")
+	assert.Equal(t, GOAL_SEEK_RESULT_ERROR, err)
+	assert.Len(t, steps, 1)
+
+	steps, err = GoalSeek{Target: "flat", Input: "y", Goal: big.NewFloat(1), MaxIterations: 5}.Run(cells, "sheet")
+	assert.Equal(t, GOAL_SEEK_NOT_CONVERGED, err)
+	assert.Len(t, steps, 2)
+
+	// Missing input starts from zero
+	steps, err = GoalSeek{Target: "z", Input: "z", Goal: big.NewFloat(2)}.Run(cells, "sheet")
+	assert.NoError(t, err)
+	assert.Equal(t, GoalSeekStep{Input: "2", Result: "2"}, steps[len(steps)-1])
+}
@@ -0,0 +1,180 @@
+package formula
+
+import (
+	"errors"
+	"math/big"
+	"sort"
+
+	"devchallenge.it/spreadsheet/internal/model"
+)
+
+// Iterative calculation defaults, the same as in the common spreadsheet
+// applications.
+const (
+	DefaultMaxIterations = 100
+	DefaultEpsilon       = 0.001
+)
+
+var NOT_CONVERGED_ERROR = errors.New("Circular reference did not converge")
+
+// SetIterativeCalculation allows the solver to evaluate circular references,
+// otherwise they fail with CYCLE_DEPENDECY_ERROR.
+func (s *Solver) SetIterativeCalculation(iteration model.IterativeCalculation) {
+	if iteration.MaxIterations <= 0 {
+		iteration.MaxIterations = DefaultMaxIterations
+	}
+	if iteration.Epsilon <= 0 {
+		iteration.Epsilon = DefaultEpsilon
+	}
+	s.iteration = iteration
+}
+
+// component returns the sorted cells of the circular strongly-connected
+// component of the dependency graph containing the cell, nil when the cell is
+// not a part of a cycle. The components of all the cells reachable from the
+// cell are found with Tarjan's algorithm and remembered.
+func (s *Solver) component(cellId string) ([]string, error) {
+	if members, exists := s.components[cellId]; exists {
+		return members, nil
+	}
+
+	index := make(map[string]int)
+	lowlink := make(map[string]int)
+	onStack := make(map[string]struct{})
+	var stack []string
+
+	var connect func(cellId string) error
+	connect = func(cellId string) error {
+		index[cellId] = len(index)
+		lowlink[cellId] = index[cellId]
+		stack = append(stack, cellId)
+		onStack[cellId] = struct{}{}
+
+		value, err := s.getValue(cellId)
+		if err != nil && err != model.ERROR_NO_CELL {
+			return err
+		}
+
+		selfLoop := false
+		for _, depCellId := range Dependencies(value) {
+			if depCellId == cellId {
+				selfLoop = true
+			}
+			if _, done := s.components[depCellId]; done {
+				continue
+			}
+
+			if _, visited := index[depCellId]; !visited {
+				if err := connect(depCellId); err != nil {
+					return err
+				}
+				if lowlink[depCellId] < lowlink[cellId] {
+					lowlink[cellId] = lowlink[depCellId]
+				}
+			} else if _, exists := onStack[depCellId]; exists && index[depCellId] < lowlink[cellId] {
+				lowlink[cellId] = index[depCellId]
+			}
+		}
+
+		if lowlink[cellId] != index[cellId] {
+			return nil
+		}
+
+		var members []string
+		for {
+			member := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			delete(onStack, member)
+			members = append(members, member)
+			if member == cellId {
+				break
+			}
+		}
+
+		if len(members) == 1 && !selfLoop {
+			members = nil
+		}
+		sort.Strings(members)
+		for _, member := range members {
+			s.components[member] = members
+		}
+		if members == nil {
+			s.components[cellId] = nil
+		}
+
+		return nil
+	}
+
+	if err := connect(cellId); err != nil {
+		return nil, err
+	}
+
+	return s.components[cellId], nil
+}
+
+// solveComponent evaluates the cells of a circular component in turns
+// starting from zero, every cell reads the latest results of the others. The
+// results are final once none of them changes by more than epsilon, a failed
+// component cell fails all of them.
+func (s *Solver) solveComponent(members []string) error {
+	formulas := make(map[string]*parsedFormula, len(members))
+	for _, member := range members {
+		value, err := s.getValue(member)
+		if err != nil {
+			return err
+		}
+
+		parsed, formulaError := parseFormula(value[1:])
+		if formulaError != nil {
+			s.failComponent(members, formulaError)
+			return nil
+		}
+		formulas[member] = parsed
+		s.cache[member] = "0"
+	}
+
+	epsilon := big.NewFloat(s.iteration.Epsilon)
+	for i := 0; i < s.iteration.MaxIterations; i++ {
+		converged := true
+		for _, member := range members {
+			s.evaluating = append(s.evaluating, member)
+			resultLit, formulaError := s.eval(formulas[member])
+			s.evaluating = s.evaluating[:len(s.evaluating)-1]
+			if formulaError != nil {
+				s.failComponent(members, formulaError)
+				return nil
+			}
+
+			if !withinEpsilon(s.cache[member], resultLit.Value, epsilon) {
+				converged = false
+			}
+			s.cache[member] = resultLit.Value
+		}
+
+		if converged {
+			return nil
+		}
+	}
+
+	s.failComponent(members, NOT_CONVERGED_ERROR)
+	return nil
+}
+
+func (s *Solver) failComponent(members []string, formulaError error) {
+	for _, member := range members {
+		s.fail(member, formulaError)
+	}
+}
+
+// withinEpsilon reports whether the numbers differ by at most epsilon, other
+// values must be equal.
+func withinEpsilon(a, b string, epsilon *big.Float) bool {
+	x, _, errX := big.ParseFloat(a, 10, 64, big.ToNearestEven)
+	y, _, errY := big.ParseFloat(b, 10, 64, big.ToNearestEven)
+	if errX != nil || errY != nil {
+		return a == b
+	}
+
+	diff := x.Sub(x, y)
+	return diff.Abs(diff).Cmp(epsilon) <= 0
+}
@@ -0,0 +1,89 @@
+package formula
+
+import (
+	"math/big"
+	"testing"
+
+	"devchallenge.it/spreadsheet/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIterativeCalculation(t *testing.T) {
+	// Interest is paid on the average of the opening and closing balances
+	cells := model.CellsSnapshot{
+		"opening":  "1000",
+		"rate":     "0.1",
+		"interest": "=rate * (opening + closing) / 2",
+		"closing":  "=opening + interest",
+		"report":   "=closing * 1",
+	}
+
+	solver := NewSolver(cells, "sheet")
+	_, _, formulaError, err := solver.Solve("report")
+	assert.NoError(t, err)
+	assert.Equal(t, CYCLE_DEPENDECY_ERROR, formulaError)
+
+	solver = NewSolver(cells, "sheet")
+	solver.SetIterativeCalculation(model.IterativeCalculation{Enabled: true, Epsilon: 1e-9})
+
+	result, _, formulaError, err := solver.Solve("report")
+	assert.NoError(t, err)
+	assert.NoError(t, formulaError)
+
+	closing, _, _ := big.ParseFloat(result, 10, 64, big.ToNearestEven)
+	value, _ := closing.Float64()
+	assert.InDelta(t, 1105.263158, value, 1e-6)
+
+	result, _, formulaError, err = solver.Solve("opening")
+	assert.NoError(t, err)
+	assert.NoError(t, formulaError)
+	assert.Equal(t, "1000", result)
+}
+
+func TestIterativeCalculationNotConverged(t *testing.T) {
+	cells := model.CellsSnapshot{
+		"var1": "=var1 + 1",
+		"var2": "=var1 * 2",
+		"var3": "=var4 * 2",
+		"var4": "=var3 + 1",
+	}
+
+	solver := NewSolver(cells, "sheet")
+	solver.SetIterativeCalculation(model.IterativeCalculation{Enabled: true, MaxIterations: 10})
+
+	result, _, formulaError, err := solver.Solve("var2")
+	assert.NoError(t, err)
+	assert.Equal(t, NOT_CONVERGED_ERROR, formulaError)
+	assert.Equal(t, ERROR, result)
+
+	result, _, formulaError, err = solver.Solve("var1")
+	assert.NoError(t, err)
+	assert.Equal(t, NOT_CONVERGED_ERROR, formulaError)
+	assert.Equal(t, ERROR, result)
+
+	_, _, formulaError, err = solver.Solve("var3")
+	assert.NoError(t, err)
+	assert.Equal(t, NOT_CONVERGED_ERROR, formulaError)
+}
+
+func TestIterativeCalculationErrors(t *testing.T) {
+	cells := model.CellsSnapshot{
+		"var1": "=var2 + missing",
+		"var2": "=var1",
+		"var3": "=var4 / 0",
+		"var4": "=var3",
+	}
+
+	solver := NewSolver(cells, "sheet")
+	solver.SetIterativeCalculation(model.IterativeCalculation{Enabled: true})
+
+	result, _, formulaError, err := solver.Solve("var2")
+	assert.NoError(t, err)
+	assert.Equal(t, NO_SUCH_CELL, formulaError)
+	assert.Equal(t, ERROR, result)
+
+	result, _, formulaError, err = solver.Solve("var4")
+	assert.NoError(t, err)
+	assert.Error(t, formulaError)
+	assert.Equal(t, ERROR, result)
+}
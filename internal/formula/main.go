@@ -4,42 +4,106 @@ import (
 	"errors"
 	"strings"
 
-	"devchallenge.it/spreadsheet/internal/formula/parser"
 	"devchallenge.it/spreadsheet/internal/model"
-	"github.com/redis/go-redis/v9"
 )
 
 const ERROR = "ERROR"
+const REF = "#REF!"
 
 var CYCLE_DEPENDECY_ERROR = errors.New("Cycle dependency")
 var NO_SUCH_CELL = errors.New("No such cellId")
+var REFERENCE_ERROR = errors.New("Reference to missing cell")
+
+// CellSource provides the cells a Solver evaluates, it is satisfied by
+// model.Dao as well as by a model.CellsSnapshot.
+type CellSource interface {
+	GetCell(spreadsheetId string, cellId string) (string, error)
+	GetAllCells(spreadsheetId string) (map[string]string, error)
+	GetCells(spreadsheetId string, cellIds []string) (map[string]string, error)
+}
 
 type Solver struct {
-	dao         *model.Dao
+	dao         CellSource
 	spreadsheet string
 
 	visited map[string]struct{}
 	values  map[string]string
+	deleted map[string]struct{}
 	cache   map[string]string
+
+	iteration  model.IterativeCalculation
+	components map[string][]string
+	errors     map[string]error
+
+	// Formula cells being evaluated, the innermost last, and the cells
+	// depending on EXTERNAL_REF.
+	evaluating []string
+	volatile   map[string]struct{}
+	offline    bool
+
+	// Results of the cells solved by the other solvers of SolveParallel.
+	shared *solvedResults
 }
 
-func NewSolver(dao *model.Dao, spreadsheet string) *Solver {
+func NewSolver(dao CellSource, spreadsheet string) *Solver {
 	return &Solver{
 		dao:         dao,
 		spreadsheet: spreadsheet,
 
 		visited: make(map[string]struct{}),
 		values:  make(map[string]string),
+		deleted: make(map[string]struct{}),
 		cache:   make(map[string]string),
+
+		components: make(map[string][]string),
+		errors:     make(map[string]error),
+		volatile:   make(map[string]struct{}),
 	}
 }
 
+// LoadAllKeys reads all the spreadsheet cells at once, the cells set or
+// deleted in the solver keep their values.
 func (s *Solver) LoadAllKeys() (err error) {
 	data, err := s.dao.GetAllCells(s.spreadsheet)
 	if err != nil {
 		return err
 	}
 
+	for cellId, value := range data {
+		if _, overridden := s.values[cellId]; overridden {
+			continue
+		}
+		if _, deleted := s.deleted[cellId]; deleted {
+			continue
+		}
+		s.values[cellId] = value
+	}
+
+	return nil
+}
+
+// LoadKeys reads the cells not known to the solver yet at once.
+func (s *Solver) LoadKeys(cellIds []string) error {
+	var missing []string
+	for _, cellId := range cellIds {
+		cellId = strings.ToLower(cellId)
+		if _, exists := s.values[cellId]; exists {
+			continue
+		}
+		if _, deleted := s.deleted[cellId]; deleted {
+			continue
+		}
+		missing = append(missing, cellId)
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	data, err := s.dao.GetCells(s.spreadsheet, missing)
+	if err != nil {
+		return err
+	}
+
 	for cellId, value := range data {
 		s.values[cellId] = value
 	}
@@ -50,6 +114,23 @@ func (s *Solver) LoadAllKeys() (err error) {
 func (s *Solver) SetCell(cellId string, value string) {
 	cellId = strings.ToLower(cellId)
 	s.values[cellId] = value
+	delete(s.deleted, cellId)
+}
+
+// DeleteCell makes the solver treat the cell as missing regardless of the
+// stored value, references to it fail with REFERENCE_ERROR rather than
+// NO_SUCH_CELL.
+func (s *Solver) DeleteCell(cellId string) {
+	cellId = strings.ToLower(cellId)
+	delete(s.values, cellId)
+	delete(s.cache, cellId)
+	delete(s.errors, cellId)
+	s.deleted[cellId] = struct{}{}
+}
+
+func (s *Solver) isDeleted(cellId string) bool {
+	_, deleted := s.deleted[strings.ToLower(cellId)]
+	return deleted
 }
 
 func (s *Solver) Solve(cellId string) (result string, value string, formulaError error, err error) {
@@ -57,7 +138,7 @@ func (s *Solver) Solve(cellId string) (result string, value string, formulaError
 
 	value, err = s.getValue(cellId)
 	if err != nil {
-		if err == redis.Nil {
+		if err == model.ERROR_NO_CELL {
 			err = nil
 			formulaError = NO_SUCH_CELL
 		}
@@ -69,25 +150,54 @@ func (s *Solver) Solve(cellId string) (result string, value string, formulaError
 		return
 	}
 
+	if s.shared != nil {
+		if solved, exists := s.shared.get(cellId); exists {
+			if solved.volatile {
+				s.volatile[cellId] = struct{}{}
+			}
+			return solved.result, value, solved.formulaError, nil
+		}
+	}
+
+	if formulaError, exists := s.errors[cellId]; exists {
+		return s.cache[cellId], value, formulaError, nil
+	}
+
 	if result, exists := s.cache[cellId]; exists {
 		return result, value, nil, nil
 	}
 
+	if s.iteration.Enabled {
+		members, err := s.component(cellId)
+		if err != nil {
+			return "", value, nil, err
+		}
+
+		if members != nil {
+			if err := s.solveComponent(members); err != nil {
+				return "", value, nil, err
+			}
+			return s.Solve(cellId)
+		}
+	}
+
 	if _, exists := s.visited[cellId]; exists {
 		return ERROR, value, CYCLE_DEPENDECY_ERROR, err
 	}
 
 	s.visited[cellId] = struct{}{}
 
-	tr, formulaError := parser.ParseExpr(value[1:], cellId)
+	parsed, formulaError := parseFormula(value[1:])
 	if formulaError != nil {
-		result = ERROR
+		result = s.fail(cellId, formulaError)
 		return
 	}
 
-	resultLit, formulaError := s.evalNode(tr)
+	s.evaluating = append(s.evaluating, cellId)
+	resultLit, formulaError := s.eval(parsed)
+	s.evaluating = s.evaluating[:len(s.evaluating)-1]
 	if formulaError != nil {
-		result = ERROR
+		result = s.fail(cellId, formulaError)
 		return
 	}
 
@@ -98,12 +208,50 @@ func (s *Solver) Solve(cellId string) (result string, value string, formulaError
 	return
 }
 
+// fail caches the formula error of the cell, so it is not reported as a cycle
+// when the cell is solved again. Returns the cell result.
+func (s *Solver) fail(cellId string, formulaError error) string {
+	result := ERROR
+	if formulaError == REFERENCE_ERROR {
+		result = REF
+	}
+
+	s.cache[cellId] = result
+	s.errors[cellId] = formulaError
+
+	return result
+}
+
+// SetOffline makes EXTERNAL_REF fail without a request, for the solvers
+// whose results of the volatile cells are not used.
+func (s *Solver) SetOffline() {
+	s.offline = true
+}
+
+// IsVolatile reports whether the solved cell depends on EXTERNAL_REF, so its
+// result may change without a change of the spreadsheet.
+func (s *Solver) IsVolatile(cellId string) bool {
+	_, volatile := s.volatile[strings.ToLower(cellId)]
+	return volatile
+}
+
+// markVolatile marks the cells being evaluated as depending on EXTERNAL_REF.
+func (s *Solver) markVolatile() {
+	for _, cellId := range s.evaluating {
+		s.volatile[cellId] = struct{}{}
+	}
+}
+
 func (s *Solver) getValue(cellId string) (string, error) {
 	cellId = strings.ToLower(cellId)
 	if value, exists := s.values[cellId]; exists {
 		return value, nil
 	}
 
+	if _, deleted := s.deleted[cellId]; deleted {
+		return "", model.ERROR_NO_CELL
+	}
+
 	value, err := s.dao.GetCell(s.spreadsheet, cellId)
 	if err != nil {
 		return "", err
@@ -116,3 +264,9 @@ func (s *Solver) getValue(cellId string) (string, error) {
 func IsFormula(value string) bool {
 	return len(value) > 0 && value[0] == '='
 }
+
+// IsMissingCell reports whether the solved cell is missing, a formula
+// referencing a missing cell fails with NO_SUCH_CELL as well.
+func IsMissingCell(value string, formulaError error) bool {
+	return formulaError == NO_SUCH_CELL && !IsFormula(value)
+}
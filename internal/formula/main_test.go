@@ -1,6 +1,8 @@
 package formula
 
 import (
+	"fmt"
+	"os"
 	"testing"
 
 	"devchallenge.it/spreadsheet/internal/model"
@@ -8,20 +10,35 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-func prepare() (*model.Dao, redismock.ClientMock) {
+// Redis hash of the devchallenge-xx spreadsheet cells.
+const testCellsKey = "spreadsheet:sheet:{devchallenge-xx}:cells"
+
+// TestMain runs the tests with every evaluator, they must give the same
+// results.
+func TestMain(m *testing.M) {
+	for _, e := range []Evaluator{TreeEvaluator, BytecodeEvaluator} {
+		fmt.Printf("Evaluator %s\n", e)
+		SetEvaluator(e)
+		if code := m.Run(); code != 0 {
+			os.Exit(code)
+		}
+	}
+}
+
+func prepare() (*model.RedisDao, redismock.ClientMock) {
 	rdb, mock := redismock.NewClientMock()
-	dao := model.NewDao(rdb)
+	dao := model.NewRedisDao(rdb)
 
 	return dao, mock
 }
 
 func TestRecursiveFormula(t *testing.T) {
 	rdb, mock := redismock.NewClientMock()
-	dao := model.NewDao(rdb)
+	dao := model.NewRedisDao(rdb)
 
-	mock.ExpectHGet("devchallenge-xx", "var1").SetVal("=var2")
-	mock.ExpectHGet("devchallenge-xx", "var2").SetVal("=var3")
-	mock.ExpectHGet("devchallenge-xx", "var3").SetVal("=1")
+	mock.ExpectHGet(testCellsKey, "var1").SetVal("=var2")
+	mock.ExpectHGet(testCellsKey, "var2").SetVal("=var3")
+	mock.ExpectHGet(testCellsKey, "var3").SetVal("=1")
 
 	solver := NewSolver(dao, "devchallenge-xx")
 
@@ -34,9 +51,9 @@ func TestRecursiveFormula(t *testing.T) {
 func TestCaseInsensitive(t *testing.T) {
 	dao, mock := prepare()
 
-	mock.ExpectHGet("devchallenge-xx", "var3").SetVal("=vAr1+VAR2")
-	mock.ExpectHGet("devchallenge-xx", "var1").SetVal("1")
-	mock.ExpectHGet("devchallenge-xx", "var2").SetVal("2")
+	mock.ExpectHGet(testCellsKey, "var3").SetVal("=vAr1+VAR2")
+	mock.ExpectHGet(testCellsKey, "var1").SetVal("1")
+	mock.ExpectHGet(testCellsKey, "var2").SetVal("2")
 
 	solver := NewSolver(dao, "devchallenge-xx")
 
@@ -48,11 +65,11 @@ func TestCaseInsensitive(t *testing.T) {
 
 func TestCache(t *testing.T) {
 	rdb, mock := redismock.NewClientMock()
-	dao := model.NewDao(rdb)
+	dao := model.NewRedisDao(rdb)
 
-	mock.ExpectHGet("devchallenge-xx", "var1").SetVal("=var2+var3+var2")
-	mock.ExpectHGet("devchallenge-xx", "var2").SetVal("=1")
-	mock.ExpectHGet("devchallenge-xx", "var3").SetVal("=var2")
+	mock.ExpectHGet(testCellsKey, "var1").SetVal("=var2+var3+var2")
+	mock.ExpectHGet(testCellsKey, "var2").SetVal("=1")
+	mock.ExpectHGet(testCellsKey, "var3").SetVal("=var2")
 
 	solver := NewSolver(dao, "devchallenge-xx")
 
@@ -64,11 +81,11 @@ func TestCache(t *testing.T) {
 
 func TestCycleDependency(t *testing.T) {
 	rdb, mock := redismock.NewClientMock()
-	dao := model.NewDao(rdb)
+	dao := model.NewRedisDao(rdb)
 
-	mock.ExpectHGet("devchallenge-xx", "var1").SetVal("=var2+var3")
-	mock.ExpectHGet("devchallenge-xx", "var2").SetVal("=var3")
-	mock.ExpectHGet("devchallenge-xx", "var3").SetVal("=var1")
+	mock.ExpectHGet(testCellsKey, "var1").SetVal("=var2+var3")
+	mock.ExpectHGet(testCellsKey, "var2").SetVal("=var3")
+	mock.ExpectHGet(testCellsKey, "var3").SetVal("=var1")
 
 	solver := NewSolver(dao, "devchallenge-xx")
 
@@ -83,9 +100,9 @@ func TestCycleDependency(t *testing.T) {
 
 func TestCycleDependency2(t *testing.T) {
 	rdb, mock := redismock.NewClientMock()
-	dao := model.NewDao(rdb)
+	dao := model.NewRedisDao(rdb)
 
-	mock.ExpectHGet("devchallenge-xx", "var1").SetVal("=var1")
+	mock.ExpectHGet(testCellsKey, "var1").SetVal("=var1")
 
 	solver := NewSolver(dao, "devchallenge-xx")
 
@@ -100,9 +117,9 @@ func TestCycleDependency2(t *testing.T) {
 
 func TestInvalidFormula(t *testing.T) {
 	rdb, mock := redismock.NewClientMock()
-	dao := model.NewDao(rdb)
+	dao := model.NewRedisDao(rdb)
 
-	mock.ExpectHGet("devchallenge-xx", "var1").SetVal("=(1*2")
+	mock.ExpectHGet(testCellsKey, "var1").SetVal("=(1*2")
 
 	solver := NewSolver(dao, "devchallenge-xx")
 
@@ -115,9 +132,9 @@ func TestInvalidFormula(t *testing.T) {
 
 func TestEmptyFormula(t *testing.T) {
 	rdb, mock := redismock.NewClientMock()
-	dao := model.NewDao(rdb)
+	dao := model.NewRedisDao(rdb)
 
-	mock.ExpectHGet("devchallenge-xx", "var1").SetVal("")
+	mock.ExpectHGet(testCellsKey, "var1").SetVal("")
 
 	solver := NewSolver(dao, "devchallenge-xx")
 
@@ -127,3 +144,85 @@ func TestEmptyFormula(t *testing.T) {
 	assert.NoError(t, formulaError)
 	assert.Equal(t, "", result)
 }
+
+func TestMissingReference(t *testing.T) {
+	dao, mock := prepare()
+
+	mock.ExpectHGet(testCellsKey, "var1").SetVal("=var2+1")
+	mock.ExpectHGet(testCellsKey, "var2").SetVal("=var3")
+	mock.ExpectHGet(testCellsKey, "var3").RedisNil()
+
+	solver := NewSolver(dao, "devchallenge-xx")
+
+	result, _, formulaError, err := solver.Solve("var1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, NO_SUCH_CELL, formulaError)
+	assert.Equal(t, ERROR, result)
+}
+
+func TestDeleteCell(t *testing.T) {
+	dao, mock := prepare()
+
+	mock.ExpectHGet(testCellsKey, "var1").SetVal("=var2")
+
+	solver := NewSolver(dao, "devchallenge-xx")
+	solver.DeleteCell("VAR2")
+
+	result, _, formulaError, err := solver.Solve("var1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, REFERENCE_ERROR, formulaError)
+	assert.Equal(t, REF, result)
+
+	_, _, formulaError, err = solver.Solve("var2")
+	assert.NoError(t, err)
+	assert.Equal(t, NO_SUCH_CELL, formulaError)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLoadAllKeysKeepsOverrides(t *testing.T) {
+	solver := NewSolver(model.CellsSnapshot{
+		"var1": "1",
+		"var2": "2",
+		"var3": "=var1 + var2",
+	}, "devchallenge-xx")
+	solver.SetCell("VAR1", "10")
+	solver.DeleteCell("var2")
+
+	assert.NoError(t, solver.LoadAllKeys())
+
+	result, _, _, err := solver.Solve("var1")
+	assert.NoError(t, err)
+	assert.Equal(t, "10", result)
+
+	result, _, formulaError, err := solver.Solve("var3")
+	assert.NoError(t, err)
+	assert.Equal(t, REFERENCE_ERROR, formulaError)
+	assert.Equal(t, REF, result)
+}
+
+func TestLoadKeys(t *testing.T) {
+	dao, mock := prepare()
+
+	mock.ExpectHMGet(testCellsKey, "var1", "var3", "var4").SetVal([]interface{}{"1", "=var1 + var2", nil})
+	mock.ExpectHGet(testCellsKey, "var4").RedisNil()
+
+	solver := NewSolver(dao, "devchallenge-xx")
+	solver.SetCell("var2", "2")
+	solver.DeleteCell("var5")
+
+	assert.NoError(t, solver.LoadKeys([]string{"VAR1", "var2", "var3", "var4", "var5"}))
+
+	result, _, formulaError, err := solver.Solve("var3")
+	assert.NoError(t, err)
+	assert.NoError(t, formulaError)
+	assert.Equal(t, "3", result)
+
+	_, _, formulaError, err = solver.Solve("var4")
+	assert.NoError(t, err)
+	assert.Equal(t, NO_SUCH_CELL, formulaError)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
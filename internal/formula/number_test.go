@@ -12,9 +12,9 @@ import (
 func TestSimpleSolve(t *testing.T) {
 	dao, mock := prepare()
 
-	mock.ExpectHGet("devchallenge-xx", "var3").SetVal("=var1+var2")
-	mock.ExpectHGet("devchallenge-xx", "var1").SetVal("1")
-	mock.ExpectHGet("devchallenge-xx", "var2").SetVal("2")
+	mock.ExpectHGet(testCellsKey, "var3").SetVal("=var1+var2")
+	mock.ExpectHGet(testCellsKey, "var1").SetVal("1")
+	mock.ExpectHGet(testCellsKey, "var2").SetVal("2")
 
 	solver := NewSolver(dao, "devchallenge-xx")
 
@@ -27,11 +27,11 @@ func TestSimpleSolve(t *testing.T) {
 func TestAllOperations(t *testing.T) {
 	dao, mock := prepare()
 
-	mock.ExpectHGet("devchallenge-xx", "var5").SetVal("=var1+(var2*var3+var4)/2")
-	mock.ExpectHGet("devchallenge-xx", "var1").SetVal("1")
-	mock.ExpectHGet("devchallenge-xx", "var2").SetVal("2")
-	mock.ExpectHGet("devchallenge-xx", "var3").SetVal("3")
-	mock.ExpectHGet("devchallenge-xx", "var4").SetVal("4")
+	mock.ExpectHGet(testCellsKey, "var5").SetVal("=var1+(var2*var3+var4)/2")
+	mock.ExpectHGet(testCellsKey, "var1").SetVal("1")
+	mock.ExpectHGet(testCellsKey, "var2").SetVal("2")
+	mock.ExpectHGet(testCellsKey, "var3").SetVal("3")
+	mock.ExpectHGet(testCellsKey, "var4").SetVal("4")
 
 	solver := NewSolver(dao, "devchallenge-xx")
 
@@ -44,9 +44,9 @@ func TestAllOperations(t *testing.T) {
 func TestFloat(t *testing.T) {
 	dao, mock := prepare()
 
-	mock.ExpectHGet("devchallenge-xx", "var1").SetVal("=var2+var3")
-	mock.ExpectHGet("devchallenge-xx", "var2").SetVal("1.1")
-	mock.ExpectHGet("devchallenge-xx", "var3").SetVal("2.2")
+	mock.ExpectHGet(testCellsKey, "var1").SetVal("=var2+var3")
+	mock.ExpectHGet(testCellsKey, "var2").SetVal("1.1")
+	mock.ExpectHGet(testCellsKey, "var3").SetVal("2.2")
 
 	solver := NewSolver(dao, "devchallenge-xx")
 	result, _, formulaError, err := solver.Solve("var1")
@@ -60,9 +60,9 @@ func TestFloat(t *testing.T) {
 
 func TestIntAndFloatResultsFloat(t *testing.T) {
 	rdb, mock := redismock.NewClientMock()
-	dao := model.NewDao(rdb)
+	dao := model.NewRedisDao(rdb)
 
-	mock.ExpectHGet("devchallenge-xx", "var1").SetVal("=1+2.3")
+	mock.ExpectHGet(testCellsKey, "var1").SetVal("=1+2.3")
 
 	solver := NewSolver(dao, "devchallenge-xx")
 
@@ -77,9 +77,9 @@ func TestIntAndFloatResultsFloat(t *testing.T) {
 
 func TestDivideByIntZeroFail(t *testing.T) {
 	rdb, mock := redismock.NewClientMock()
-	dao := model.NewDao(rdb)
+	dao := model.NewRedisDao(rdb)
 
-	mock.ExpectHGet("devchallenge-xx", "var1").SetVal("=1/0")
+	mock.ExpectHGet(testCellsKey, "var1").SetVal("=1/0")
 
 	solver := NewSolver(dao, "devchallenge-xx")
 
@@ -92,9 +92,9 @@ func TestDivideByIntZeroFail(t *testing.T) {
 
 func TestDivideByFloatZeroFail(t *testing.T) {
 	rdb, mock := redismock.NewClientMock()
-	dao := model.NewDao(rdb)
+	dao := model.NewRedisDao(rdb)
 
-	mock.ExpectHGet("devchallenge-xx", "var1").SetVal("=1/0.000")
+	mock.ExpectHGet(testCellsKey, "var1").SetVal("=1/0.000")
 
 	solver := NewSolver(dao, "devchallenge-xx")
 
@@ -107,10 +107,10 @@ func TestDivideByFloatZeroFail(t *testing.T) {
 
 func TestParseNumberWithUnaryOp(t *testing.T) {
 	rdb, mock := redismock.NewClientMock()
-	dao := model.NewDao(rdb)
+	dao := model.NewRedisDao(rdb)
 
-	mock.ExpectHGet("devchallenge-xx", "var1").SetVal("=1-var2")
-	mock.ExpectHGet("devchallenge-xx", "var2").SetVal("+12")
+	mock.ExpectHGet(testCellsKey, "var1").SetVal("=1-var2")
+	mock.ExpectHGet(testCellsKey, "var2").SetVal("+12")
 
 	solver := NewSolver(dao, "devchallenge-xx")
 
@@ -123,9 +123,9 @@ func TestParseNumberWithUnaryOp(t *testing.T) {
 
 func TestDivideIntByIntResultFloat(t *testing.T) {
 	rdb, mock := redismock.NewClientMock()
-	dao := model.NewDao(rdb)
+	dao := model.NewRedisDao(rdb)
 
-	mock.ExpectHGet("devchallenge-xx", "var1").SetVal("=1/2")
+	mock.ExpectHGet(testCellsKey, "var1").SetVal("=1/2")
 
 	solver := NewSolver(dao, "devchallenge-xx")
 
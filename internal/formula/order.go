@@ -0,0 +1,137 @@
+package formula
+
+import (
+	"sort"
+	"strings"
+
+	"devchallenge.it/spreadsheet/internal/model"
+)
+
+// Order sorts the cells so that every cell follows the cells it refers to
+// among the given ones, solving them in the order evaluates every formula
+// once with its references already cached. Cells of circular references
+// follow the others ordered by id.
+func (s *Solver) Order(cellIds []string) ([]string, error) {
+	ids := uniqueIds(cellIds)
+	references, err := s.references(ids)
+	if err != nil {
+		return nil, err
+	}
+	dependants, pending := graph(ids, references)
+
+	order := make([]string, 0, len(ids))
+	for _, cellId := range ids {
+		if pending[cellId] == 0 {
+			order = append(order, cellId)
+		}
+	}
+
+	for i := 0; i < len(order); i++ {
+		for _, dependantId := range dependants[order[i]] {
+			pending[dependantId]--
+			if pending[dependantId] == 0 {
+				order = append(order, dependantId)
+			}
+		}
+	}
+
+	for _, cellId := range ids {
+		if pending[cellId] > 0 {
+			order = append(order, cellId)
+		}
+	}
+
+	return order, nil
+}
+
+// layer groups the cells so that every cell refers only to the cells of the
+// previous layers among the given ones, the cells of a layer are independent
+// of each other. Cells of circular references and the cells depending on them
+// are returned separately ordered by id.
+func layer(ids []string, references map[string][]string) (layers [][]string, circular []string) {
+	dependants, pending := graph(ids, references)
+
+	var layer []string
+	for _, cellId := range ids {
+		if pending[cellId] == 0 {
+			layer = append(layer, cellId)
+		}
+	}
+
+	for len(layer) > 0 {
+		layers = append(layers, layer)
+
+		var next []string
+		for _, cellId := range layer {
+			for _, dependantId := range dependants[cellId] {
+				pending[dependantId]--
+				if pending[dependantId] == 0 {
+					next = append(next, dependantId)
+				}
+			}
+		}
+		sort.Strings(next)
+		layer = next
+	}
+
+	for _, cellId := range ids {
+		if pending[cellId] > 0 {
+			circular = append(circular, cellId)
+		}
+	}
+
+	return layers, circular
+}
+
+// uniqueIds returns the sorted unique lowercase cell ids.
+func uniqueIds(cellIds []string) []string {
+	ids := make([]string, 0, len(cellIds))
+	set := make(map[string]struct{}, len(cellIds))
+	for _, cellId := range cellIds {
+		cellId = strings.ToLower(cellId)
+		if _, exists := set[cellId]; !exists {
+			set[cellId] = struct{}{}
+			ids = append(ids, cellId)
+		}
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+// references returns the cells every cell refers to.
+func (s *Solver) references(ids []string) (map[string][]string, error) {
+	references := make(map[string][]string, len(ids))
+	for _, cellId := range ids {
+		value, err := s.getValue(cellId)
+		if err != nil && err != model.ERROR_NO_CELL {
+			return nil, err
+		}
+		references[cellId] = Dependencies(value)
+	}
+
+	return references, nil
+}
+
+// graph returns the references among the cells: the dependants of every cell
+// and the number of cells every cell refers to. References of a cell to
+// itself are ignored.
+func graph(ids []string, references map[string][]string) (dependants map[string][]string, pending map[string]int) {
+	set := make(map[string]struct{}, len(ids))
+	for _, cellId := range ids {
+		set[cellId] = struct{}{}
+	}
+
+	dependants = make(map[string][]string)
+	pending = make(map[string]int)
+	for _, cellId := range ids {
+		for _, dependencyId := range references[cellId] {
+			if _, exists := set[dependencyId]; exists && dependencyId != cellId {
+				dependants[dependencyId] = append(dependants[dependencyId], cellId)
+				pending[cellId]++
+			}
+		}
+	}
+
+	return dependants, pending
+}
@@ -0,0 +1,42 @@
+package formula
+
+import (
+	"testing"
+
+	"devchallenge.it/spreadsheet/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrder(t *testing.T) {
+	cells := model.CellsSnapshot{
+		"var1": "=var2 + var3",
+		"var2": "=var3 + outside",
+		"var3": "1",
+		"var4": "=var5",
+		"var5": "=var4",
+	}
+
+	order, err := NewSolver(cells, "sheet").Order([]string{"VAR1", "var2", "var3", "var4", "var5", "missing"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"missing", "var3", "var2", "var1", "var4", "var5"}, order)
+}
+
+func TestVolatile(t *testing.T) {
+	cells := model.CellsSnapshot{
+		"var1": "=EXTERNAL_REF(http://127.0.0.1:1/api/v1/sheet/var1)",
+		"var2": "=var1 + 1",
+		"var3": "=var2 * 2",
+		"var4": "=var3 + var5",
+		"var5": "=1",
+	}
+
+	solver := NewSolver(cells, "sheet")
+	solver.Solve("var2")
+	solver.Solve("var4")
+
+	assert.True(t, solver.IsVolatile("var1"))
+	assert.True(t, solver.IsVolatile("VAR2"))
+	assert.True(t, solver.IsVolatile("var3"))
+	assert.True(t, solver.IsVolatile("var4"))
+	assert.False(t, solver.IsVolatile("var5"))
+}
@@ -0,0 +1,207 @@
+package formula
+
+import (
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"devchallenge.it/spreadsheet/internal/model"
+)
+
+// SolvedCell is the outcome of a cell solved by SolveParallel.
+type SolvedCell struct {
+	Result       string
+	Value        string
+	FormulaError error
+}
+
+// solvedResults is the cache of the formula results shared by the solvers of
+// SolveParallel, a result is written once its cell is solved.
+type solvedResults struct {
+	mu      sync.RWMutex
+	results map[string]solvedResult
+}
+
+type solvedResult struct {
+	result       string
+	formulaError error
+	volatile     bool
+}
+
+func (r *solvedResults) get(cellId string) (solvedResult, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result, exists := r.results[cellId]
+	return result, exists
+}
+
+func (r *solvedResults) set(cellId string, result solvedResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.results[cellId] = result
+}
+
+// SolveParallel solves the cells together with the cells they refer to
+// layer by layer, cells of a layer are independent and solved by the workers
+// at once, GOMAXPROCS of them when workers is not positive. Every worker has
+// a solver configured like this one reading the values loaded into it, the
+// results of the previous layers are shared. Circular references are solved
+// sequentially after the layers.
+func (s *Solver) SolveParallel(cellIds []string, workers int) (map[string]SolvedCell, error) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	references, err := s.closure(cellIds)
+	if err != nil {
+		return nil, err
+	}
+
+	closure := make([]string, 0, len(references))
+	for cellId := range references {
+		closure = append(closure, cellId)
+	}
+	sort.Strings(closure)
+	layers, circular := layer(closure, references)
+
+	// The workers read the values loaded and the cells deleted by this solver
+	// without writing them
+	values := make(model.CellsSnapshot, len(s.values))
+	for cellId, value := range s.values {
+		values[cellId] = value
+	}
+
+	deleted := make(map[string]struct{}, len(s.deleted))
+	for cellId := range s.deleted {
+		deleted[cellId] = struct{}{}
+	}
+
+	shared := &solvedResults{results: make(map[string]solvedResult, len(closure))}
+	newWorker := func() *Solver {
+		worker := NewSolver(values, s.spreadsheet)
+		worker.deleted = deleted
+		worker.iteration = s.iteration
+		worker.offline = s.offline
+		worker.shared = shared
+		return worker
+	}
+
+	solve := func(solver *Solver, cellId string) error {
+		result, value, formulaError, err := solver.Solve(cellId)
+		if err != nil {
+			return err
+		}
+		if !IsMissingCell(value, formulaError) {
+			shared.set(cellId, solvedResult{result, formulaError, solver.IsVolatile(cellId)})
+		}
+		return nil
+	}
+
+	for _, layer := range layers {
+		if err := solveLayer(layer, workers, newWorker, solve); err != nil {
+			return nil, err
+		}
+	}
+
+	solver := newWorker()
+	for _, cellId := range circular {
+		if err := solve(solver, cellId); err != nil {
+			return nil, err
+		}
+	}
+
+	cells := make(map[string]SolvedCell, len(cellIds))
+	for _, cellId := range cellIds {
+		cellId = strings.ToLower(cellId)
+		cell := SolvedCell{Value: values[cellId]}
+		if solved, exists := shared.get(cellId); exists {
+			cell.Result, cell.FormulaError = solved.result, solved.formulaError
+		} else {
+			cell.FormulaError = NO_SUCH_CELL
+		}
+		cells[cellId] = cell
+	}
+
+	return cells, nil
+}
+
+// solveLayer solves the independent cells with the workers, the first error
+// stops the layer.
+func solveLayer(layer []string, workers int, newWorker func() *Solver, solve func(*Solver, string) error) error {
+	if workers > len(layer) {
+		workers = len(layer)
+	}
+
+	queue := make(chan string)
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			solver := newWorker()
+			for cellId := range queue {
+				if err := solve(solver, cellId); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	var err error
+feed:
+	for _, cellId := range layer {
+		select {
+		case queue <- cellId:
+		case err = <-errs:
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if err == nil {
+		select {
+		case err = <-errs:
+		default:
+		}
+	}
+
+	return err
+}
+
+// closure returns the cells the given ones refer to directly or through
+// other cells, missing cells included, with the references of every cell.
+func (s *Solver) closure(cellIds []string) (map[string][]string, error) {
+	references := make(map[string][]string, len(cellIds))
+	queue := make([]string, 0, len(cellIds))
+	visit := func(cellId string) {
+		if _, exists := references[cellId]; !exists {
+			references[cellId] = nil
+			queue = append(queue, cellId)
+		}
+	}
+	for _, cellId := range cellIds {
+		visit(strings.ToLower(cellId))
+	}
+
+	for i := 0; i < len(queue); i++ {
+		value, err := s.getValue(queue[i])
+		if err != nil && err != model.ERROR_NO_CELL {
+			return nil, err
+		}
+
+		references[queue[i]] = Dependencies(value)
+		for _, dependencyId := range references[queue[i]] {
+			visit(dependencyId)
+		}
+	}
+
+	return references, nil
+}
@@ -0,0 +1,155 @@
+package formula
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"devchallenge.it/spreadsheet/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLayer(t *testing.T) {
+	cells := model.CellsSnapshot{
+		"var1": "=var2 + var3",
+		"var2": "=var3 + outside",
+		"var3": "1",
+		"var4": "=var5",
+		"var5": "=var4",
+		"var6": "=var4 + var3",
+		"var7": "=var7 + 1",
+	}
+
+	ids := uniqueIds([]string{"VAR1", "var2", "var3", "var4", "var5", "var6", "var7", "outside"})
+	references, err := NewSolver(cells, "sheet").references(ids)
+	assert.NoError(t, err)
+
+	layers, circular := layer(ids, references)
+	assert.Equal(t, [][]string{{"outside", "var3", "var7"}, {"var2"}, {"var1"}}, layers)
+	assert.Equal(t, []string{"var4", "var5", "var6"}, circular)
+}
+
+func TestSolveParallel(t *testing.T) {
+	cells := model.CellsSnapshot{
+		"var1":  "1",
+		"var2":  "=var1 + 1",
+		"var3":  "=var2 * var1",
+		"var4":  "=var3 / (var1 - 1)",
+		"var5":  "=var4 + 1",
+		"var6":  "=missing + 1",
+		"var7":  "=var8 + 1",
+		"var8":  "=var7 / 2 + var3",
+		"var9":  "=var8 + var2",
+		"var10": "=EXTERNAL_REF(http://127.0.0.1:1/api/v1/sheet/var1) + var3",
+		"var11": "=var10 + 1",
+		"var12": "=var12",
+	}
+	cellIds := []string{"VAR1", "var2", "var3", "var4", "var5", "var6", "var7", "var8", "var9", "var10", "var11", "var12", "missing"}
+
+	for _, iteration := range []model.IterativeCalculation{{}, {Enabled: true}} {
+		expected := make(map[string]SolvedCell)
+		solver := NewSolver(cells, "sheet")
+		solver.SetIterativeCalculation(iteration)
+		solver.SetOffline()
+		for _, cellId := range cellIds {
+			var cell SolvedCell
+			var err error
+			cell.Result, cell.Value, cell.FormulaError, err = solver.Solve(cellId)
+			assert.NoError(t, err)
+			expected[cellId] = cell
+		}
+
+		solver = NewSolver(cells, "sheet")
+		solver.SetIterativeCalculation(iteration)
+		solver.SetOffline()
+		assert.NoError(t, solver.LoadAllKeys())
+
+		solved, err := solver.SolveParallel(cellIds, 4)
+		assert.NoError(t, err)
+		assert.Len(t, solved, len(cellIds))
+		for _, cellId := range cellIds {
+			assert.Equal(t, expected[cellId], solved[strings.ToLower(cellId)], "%s %+v", cellId, iteration)
+		}
+	}
+}
+
+// TestSolveParallelExternalRef evaluates the slow EXTERNAL_REF cells at once.
+func TestSolveParallelExternalRef(t *testing.T) {
+	const delay = 200 * time.Millisecond
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		time.Sleep(delay)
+		w.Write([]byte(`{"value": "2", "result": "2"}`))
+	}))
+	defer server.Close()
+
+	cells := model.CellsSnapshot{"total": "=0"}
+	var cellIds []string
+	for i := 0; i < 8; i++ {
+		cellId := fmt.Sprintf("var%d", i)
+		cells[cellId] = fmt.Sprintf("=EXTERNAL_REF(%s/api/v1/other/var1) * %d", server.URL, i)
+		cells["total"] += " + " + cellId
+		cellIds = append(cellIds, cellId)
+	}
+	cellIds = append(cellIds, "total")
+
+	solver := NewSolver(cells, "sheet")
+	assert.NoError(t, solver.LoadAllKeys())
+
+	start := time.Now()
+	solved, err := solver.SolveParallel(cellIds, 8)
+	assert.NoError(t, err)
+	assert.Less(t, time.Since(start), 4*delay)
+
+	assert.Equal(t, int32(8), atomic.LoadInt32(&requests))
+	assert.Equal(t, "56", solved["total"].Result)
+	assert.Equal(t, "14", solved["var7"].Result)
+}
+
+// wideSpreadsheet returns cells of 100 independent chains, every formula
+// refers to the previous cell of its chain and a cell of the first row.
+func wideSpreadsheet(size int) model.CellsSnapshot {
+	cells := make(model.CellsSnapshot, size)
+	for i := 0; i < size; i++ {
+		if i < 100 {
+			cells[fmt.Sprintf("var%d", i)] = fmt.Sprint(i)
+		} else {
+			cells[fmt.Sprintf("var%d", i)] = fmt.Sprintf("=var%d * 2 - var%d + %d", i-100, i%100, i)
+		}
+	}
+
+	return cells
+}
+
+// BenchmarkSolveParallel evaluates the whole wide spreadsheet with a single
+// solver and in parallel.
+func BenchmarkSolveParallel(b *testing.B) {
+	cells := wideSpreadsheet(10000)
+	cellIds := make([]string, 0, len(cells))
+	for cellId := range cells {
+		cellIds = append(cellIds, cellId)
+	}
+
+	b.Run("sequential", func(b *testing.B) {
+		solveSpreadsheet(b, cells)
+	})
+
+	b.Run("parallel", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			solver := NewSolver(cells, "sheet")
+			if err := solver.LoadAllKeys(); err != nil {
+				b.Fatal(err)
+			}
+			if _, err := solver.SolveParallel(cellIds, 0); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package formula
+
+import (
+	"container/list"
+	"go/ast"
+	"sync"
+
+	"devchallenge.it/spreadsheet/internal/formula/parser"
+)
+
+// DefaultParseCacheSize is the number of parsed formulas kept by default,
+// enough for all the formulas of a 10k-cell spreadsheet.
+const DefaultParseCacheSize = 16384
+
+// parseCache is the least recently used formulas with their trees and
+// programs, shared by all the solvers. They are never modified by the
+// evaluation, so a formula is evaluated by many goroutines at once.
+type parseCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	recent  *list.List
+}
+
+// parsedFormula is the tree of the formula and the program compiled from it,
+// the program is nil when the formula could not be parsed.
+type parsedFormula struct {
+	src     string
+	tree    ast.Expr
+	program *program
+	err     error
+}
+
+var parsedFormulas = newParseCache(DefaultParseCacheSize)
+
+func newParseCache(size int) *parseCache {
+	return &parseCache{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		recent:  list.New(),
+	}
+}
+
+// SetParseCacheSize replaces the parsed formulas cache with an empty one of
+// the given size, the cache is disabled when the size is not positive.
+func SetParseCacheSize(size int) {
+	parsedFormulas.mu.Lock()
+	defer parsedFormulas.mu.Unlock()
+
+	parsedFormulas.size = size
+	parsedFormulas.entries = make(map[string]*list.Element)
+	parsedFormulas.recent.Init()
+}
+
+// parseFormula returns the parsed and compiled formula expression without
+// the leading '=', parse errors are cached as well.
+func parseFormula(src string) (*parsedFormula, error) {
+	parsed := parsedFormulas.parse(src)
+	return parsed, parsed.err
+}
+
+func (c *parseCache) parse(src string) *parsedFormula {
+	c.mu.Lock()
+	if element, exists := c.entries[src]; exists {
+		c.recent.MoveToFront(element)
+		c.mu.Unlock()
+		return element.Value.(*parsedFormula)
+	}
+	c.mu.Unlock()
+
+	// Parsed without the lock, a formula parsed concurrently is stored once
+	parsed := &parsedFormula{src: src}
+	parsed.tree, parsed.err = parser.ParseExpr(src, "")
+	if parsed.err == nil {
+		parsed.program = compile(parsed.tree)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.size <= 0 {
+		return parsed
+	}
+	if element, exists := c.entries[src]; exists {
+		c.recent.MoveToFront(element)
+		return element.Value.(*parsedFormula)
+	}
+
+	c.entries[src] = c.recent.PushFront(parsed)
+	for c.recent.Len() > c.size {
+		oldest := c.recent.Back()
+		c.recent.Remove(oldest)
+		delete(c.entries, oldest.Value.(*parsedFormula).src)
+	}
+
+	return parsed
+}
+
+func (c *parseCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.recent.Len()
+}
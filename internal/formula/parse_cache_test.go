@@ -0,0 +1,135 @@
+package formula
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"devchallenge.it/spreadsheet/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCache(t *testing.T) {
+	cache := newParseCache(2)
+
+	parsed := cache.parse("var1+1")
+	assert.NoError(t, parsed.err)
+	assert.NotNil(t, parsed.program)
+	assert.Error(t, cache.parse("var2+").err)
+
+	// The same formula is returned while it is cached
+	assert.Same(t, parsed, cache.parse("var1+1"))
+
+	// The least recently used formula is evicted
+	cache.parse("var3")
+	assert.Equal(t, 2, cache.len())
+	assert.Contains(t, cache.entries, "var1+1")
+	assert.Contains(t, cache.entries, "var3")
+	assert.NotContains(t, cache.entries, "var2+")
+
+	assert.Error(t, cache.parse("var2+").err)
+}
+
+func TestParseCacheDisabled(t *testing.T) {
+	cache := newParseCache(0)
+
+	assert.NoError(t, cache.parse("var1+1").err)
+	assert.Equal(t, 0, cache.len())
+}
+
+func TestParseCacheConcurrent(t *testing.T) {
+	cache := newParseCache(16)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				parsed := cache.parse(fmt.Sprintf("var%d + %d", j%32, i))
+				assert.NoError(t, parsed.err)
+				assert.NotNil(t, parsed.program)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, cache.len(), 16)
+	assert.Equal(t, cache.len(), len(cache.entries))
+}
+
+// benchmarkSpreadsheet returns 10k cells, every formula refers to the
+// previous cell and a cell in the first half of the spreadsheet.
+func benchmarkSpreadsheet() model.CellsSnapshot {
+	const size = 10000
+
+	cells := make(model.CellsSnapshot, size)
+	cells["var0"] = "1"
+	for i := 1; i < size; i++ {
+		cells[fmt.Sprintf("var%d", i)] = fmt.Sprintf("=(var%d + var%d) / 2 + %d", i-1, i/2, i)
+	}
+
+	return cells
+}
+
+// BenchmarkSolveSpreadsheet evaluates the whole spreadsheet with a new
+// solver like a spreadsheet read does.
+func BenchmarkSolveSpreadsheet(b *testing.B) {
+	cells := benchmarkSpreadsheet()
+
+	for _, size := range []int{DefaultParseCacheSize, 0} {
+		name := "cached"
+		if size == 0 {
+			name = "uncached"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			SetParseCacheSize(size)
+			defer SetParseCacheSize(DefaultParseCacheSize)
+
+			solveSpreadsheet(b, cells)
+		})
+	}
+}
+
+func solveSpreadsheet(b *testing.B, cells model.CellsSnapshot) {
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		solver := NewSolver(cells, "sheet")
+		if err := solver.LoadAllKeys(); err != nil {
+			b.Fatal(err)
+		}
+		for cellId := range cells {
+			if _, _, formulaError, err := solver.Solve(cellId); err != nil || formulaError != nil {
+				b.Fatal(cellId, err, formulaError)
+			}
+		}
+	}
+}
+
+// BenchmarkDependencies extracts the references of every formula like the
+// dependency index rebuild does.
+func BenchmarkDependencies(b *testing.B) {
+	cells := benchmarkSpreadsheet()
+
+	for _, size := range []int{DefaultParseCacheSize, 0} {
+		name := "cached"
+		if size == 0 {
+			name = "uncached"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			SetParseCacheSize(size)
+			defer SetParseCacheSize(DefaultParseCacheSize)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for _, value := range cells {
+					Dependencies(value)
+				}
+			}
+		})
+	}
+}
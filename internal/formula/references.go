@@ -0,0 +1,22 @@
+package formula
+
+import "regexp"
+
+// Matches EXTERNAL_REF calls the way the parser reads them, the url spans up
+// to the closing bracket.
+var externalRefPattern = regexp.MustCompile(`EXTERNAL_REF\(\s*([^)]*?)\s*\)`)
+
+// RewriteExternalRefs replaces urls of the EXTERNAL_REF calls of the formula
+// with the ones returned by rewrite. Other values are returned as is.
+func RewriteExternalRefs(value string, rewrite func(url string) string) string {
+	if !IsFormula(value) {
+		return value
+	}
+
+	return externalRefPattern.ReplaceAllStringFunc(value, func(call string) string {
+		match := externalRefPattern.FindStringSubmatchIndex(call)
+		start, end := match[2], match[3]
+
+		return call[:start] + rewrite(call[start:end]) + call[end:]
+	})
+}
@@ -0,0 +1,19 @@
+package formula
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewriteExternalRefs(t *testing.T) {
+	rewrite := func(url string) string {
+		return url + "-copy"
+	}
+
+	assert.Equal(t, "EXTERNAL_REF(http://x/y)", RewriteExternalRefs("EXTERNAL_REF(http://x/y)", rewrite))
+	assert.Equal(t, "=var1 + 1", RewriteExternalRefs("=var1 + 1", rewrite))
+	assert.Equal(t,
+		"=EXTERNAL_REF(http://x/a/b-copy) * EXTERNAL_REF( http://x/c/d-copy )",
+		RewriteExternalRefs("=EXTERNAL_REF(http://x/a/b) * EXTERNAL_REF( http://x/c/d )", rewrite))
+}
@@ -11,11 +11,11 @@ import (
 
 func TestStrings(t *testing.T) {
 	rdb, mock := redismock.NewClientMock()
-	dao := model.NewDao(rdb)
+	dao := model.NewRedisDao(rdb)
 
-	mock.ExpectHGet("devchallenge-xx", "var1").SetVal("=var2")
-	mock.ExpectHGet("devchallenge-xx", "var2").SetVal("=((var3))")
-	mock.ExpectHGet("devchallenge-xx", "var3").SetVal("abc!@_*.%á")
+	mock.ExpectHGet(testCellsKey, "var1").SetVal("=var2")
+	mock.ExpectHGet(testCellsKey, "var2").SetVal("=((var3))")
+	mock.ExpectHGet(testCellsKey, "var3").SetVal("abc!@_*.%á")
 
 	solver := NewSolver(dao, "devchallenge-xx")
 
@@ -27,10 +27,10 @@ func TestStrings(t *testing.T) {
 
 func TestNoBinaryOperatorsForStrings(t *testing.T) {
 	rdb, mock := redismock.NewClientMock()
-	dao := model.NewDao(rdb)
+	dao := model.NewRedisDao(rdb)
 
-	mock.ExpectHGet("devchallenge-xx", "var1").SetVal("=var2+1")
-	mock.ExpectHGet("devchallenge-xx", "var2").SetVal("Some string")
+	mock.ExpectHGet(testCellsKey, "var1").SetVal("=var2+1")
+	mock.ExpectHGet(testCellsKey, "var2").SetVal("Some string")
 
 	solver := NewSolver(dao, "devchallenge-xx")
 
@@ -44,14 +44,14 @@ const LATIN = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz01233456789"
 
 func FuzzString(f *testing.F) {
 	rdb, mock := redismock.NewClientMock()
-	dao := model.NewDao(rdb)
+	dao := model.NewRedisDao(rdb)
 
 	f.Add(LATIN)
 	f.Add("最近有什么新鲜事吗？")
 	f.Add(strings.Repeat(LATIN, 1000))
 
 	f.Fuzz(func(t *testing.T, s string) {
-		mock.ExpectHGet("devchallenge-xx", "var1").SetVal(s)
+		mock.ExpectHGet(testCellsKey, "var1").SetVal(s)
 
 		solver := NewSolver(dao, "devchallenge-xx")
 
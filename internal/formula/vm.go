@@ -0,0 +1,264 @@
+package formula
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strings"
+)
+
+// Evaluator selects how the solvers evaluate formulas.
+type Evaluator int
+
+const (
+	// BytecodeEvaluator runs formulas compiled to a program of a stack
+	// machine, the default.
+	BytecodeEvaluator Evaluator = iota
+
+	// TreeEvaluator walks the parsed formula tree.
+	TreeEvaluator
+)
+
+var evaluator = BytecodeEvaluator
+
+var evaluatorNames = map[Evaluator]string{
+	BytecodeEvaluator: "bytecode",
+	TreeEvaluator:     "tree",
+}
+
+func (e Evaluator) String() string {
+	return evaluatorNames[e]
+}
+
+// ParseEvaluator returns the evaluator by its name, "bytecode" or "tree".
+func ParseEvaluator(name string) (Evaluator, error) {
+	for e, evaluatorName := range evaluatorNames {
+		if evaluatorName == name {
+			return e, nil
+		}
+	}
+
+	return 0, fmt.Errorf("Unknown evaluator %q", name)
+}
+
+// SetEvaluator selects the evaluator of all the solvers, it is not safe to
+// call while formulas are evaluated.
+func SetEvaluator(e Evaluator) {
+	evaluator = e
+}
+
+type opcode uint8
+
+const (
+	// Push the literal consts[arg].
+	opConst opcode = iota
+	// Push the result of the cell names[arg].
+	opLoad
+	// Pop y and x, push x op y where op is the token arg.
+	opBinary
+	// Pop x, push 0 op x where op is the token arg.
+	opUnary
+	// Pop arity arguments, push the result of the function funcs[arg].
+	opCall
+	// Mark the evaluated cells volatile, push the result of the EXTERNAL_REF
+	// url names[arg].
+	opExternalRef
+	// Mark the evaluated cells volatile, fail when the solver is offline.
+	opVolatile
+	// Fail with errs[arg].
+	opFail
+)
+
+type instruction struct {
+	op    opcode
+	arity int32
+	arg   int32
+}
+
+// program is a formula compiled for the stack machine, its instructions
+// evaluate the formula in the same order as the tree evaluator does. Programs
+// are shared by the solvers and never modified.
+type program struct {
+	code   []instruction
+	consts []*ast.BasicLit
+	names  []string
+	funcs  []FormulaFun
+	errs   []error
+	depth  int
+}
+
+// compile translates the parsed formula tree into a program.
+func compile(tree ast.Expr) *program {
+	c := &compiler{program: &program{}}
+	c.compile(tree)
+
+	return c.program
+}
+
+type compiler struct {
+	*program
+	sp int
+}
+
+func (c *compiler) emit(op opcode, arg int, arity int, push int) {
+	c.code = append(c.code, instruction{op: op, arity: int32(arity), arg: int32(arg)})
+	c.sp += push
+	if c.sp > c.depth {
+		c.depth = c.sp
+	}
+}
+
+func (c *compiler) fail(err error) {
+	c.errs = append(c.errs, err)
+	c.emit(opFail, len(c.errs)-1, 0, 1)
+}
+
+func (c *compiler) compile(n ast.Node) {
+	switch nod := n.(type) {
+	case *ast.Ident:
+		c.names = append(c.names, nod.Name)
+		c.emit(opLoad, len(c.names)-1, 0, 1)
+	case *ast.BasicLit:
+		c.consts = append(c.consts, nod)
+		c.emit(opConst, len(c.consts)-1, 0, 1)
+	case *ast.ParenExpr:
+		c.compile(nod.X)
+	case *ast.BinaryExpr:
+		c.compile(nod.X)
+		c.compile(nod.Y)
+		c.emit(opBinary, int(nod.Op), 0, -1)
+	case *ast.UnaryExpr:
+		c.compile(nod.X)
+		c.emit(opUnary, int(nod.Op), 0, 0)
+	case *ast.CallExpr:
+		c.compileCall(nod)
+	case *ast.BadExpr:
+		c.fail(fmt.Errorf("Expression parsing failed"))
+	default:
+		c.fail(fmt.Errorf("Expression %T not supported", n))
+	}
+}
+
+// compileCall resolves the function at compile time, a call which fails
+// before its arguments are evaluated compiles to opFail.
+func (c *compiler) compileCall(call *ast.CallExpr) {
+	funIdent, ok := call.Fun.(*ast.Ident)
+	if !ok {
+		c.fail(fmt.Errorf("Invalid function name literal type: %T", call.Fun))
+		return
+	}
+	funName := strings.ToUpper(funIdent.Name)
+
+	if funName == "EXTERNAL_REF" {
+		c.compileExternalRef(call.Args)
+		return
+	}
+
+	fun, exists := formulaFunctions[funName]
+	if !exists {
+		c.fail(fmt.Errorf("Unknown function %q", funName))
+		return
+	}
+	for _, arg := range call.Args {
+		c.compile(arg)
+	}
+
+	c.funcs = append(c.funcs, fun)
+	c.emit(opCall, len(c.funcs)-1, len(call.Args), 1-len(call.Args))
+}
+
+func (c *compiler) compileExternalRef(args []ast.Expr) {
+	if len(args) != 1 {
+		c.emit(opVolatile, 0, 0, 0)
+		c.fail(errors.New("EXTERNAL_REF expects single argument"))
+		return
+	}
+
+	ident, ok := args[0].(*ast.Ident)
+	if !ok {
+		c.emit(opVolatile, 0, 0, 0)
+		c.fail(fmt.Errorf("Invalid EXTERNAL_REF argument type: %s", args[0]))
+		return
+	}
+
+	c.names = append(c.names, ident.Name)
+	c.emit(opExternalRef, len(c.names)-1, 0, 1)
+}
+
+// eval evaluates the parsed formula with the selected evaluator.
+func (s *Solver) eval(parsed *parsedFormula) (*ast.BasicLit, error) {
+	if evaluator == TreeEvaluator {
+		return s.evalNode(parsed.tree)
+	}
+
+	return s.run(parsed.program)
+}
+
+// run executes the program, the result is the only value left on the stack.
+func (s *Solver) run(p *program) (*ast.BasicLit, error) {
+	stack := make([]*ast.BasicLit, 0, p.depth)
+
+	for _, in := range p.code {
+		switch in.op {
+		case opConst:
+			stack = append(stack, p.consts[in.arg])
+
+		case opLoad:
+			lit, err := s.expandVariable(&ast.Ident{Name: p.names[in.arg]})
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, lit)
+
+		case opBinary:
+			x, y := stack[len(stack)-2], stack[len(stack)-1]
+			lit, err := s.evalBinOperator(x, y, token.Token(in.arg))
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack[:len(stack)-2], lit)
+
+		case opUnary:
+			y := stack[len(stack)-1]
+			x := &ast.BasicLit{Value: "0", Kind: y.Kind}
+			lit, err := s.evalBinOperator(x, y, token.Token(in.arg))
+			if err != nil {
+				return nil, err
+			}
+			stack[len(stack)-1] = lit
+
+		case opCall:
+			base := len(stack) - int(in.arity)
+			args := make([]*ast.BasicLit, in.arity)
+			copy(args, stack[base:])
+			lit, err := p.funcs[in.arg](s, args)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack[:base], lit)
+
+		case opExternalRef:
+			s.markVolatile()
+			if s.offline {
+				return nil, ERROR_OFFLINE
+			}
+			lit, err := s.externalRef(p.names[in.arg])
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, lit)
+
+		case opVolatile:
+			s.markVolatile()
+			if s.offline {
+				return nil, ERROR_OFFLINE
+			}
+
+		case opFail:
+			return nil, p.errs[in.arg]
+		}
+	}
+
+	return stack[len(stack)-1], nil
+}
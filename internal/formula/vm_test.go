@@ -0,0 +1,117 @@
+package formula
+
+import (
+	"go/token"
+	"testing"
+
+	"devchallenge.it/spreadsheet/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompile(t *testing.T) {
+	parsed, err := parseFormula("-(var1 + 2) * SUM(var2, 3, 4)")
+	assert.NoError(t, err)
+
+	p := parsed.program
+	assert.Equal(t, []instruction{
+		{op: opLoad, arg: 0},
+		{op: opConst, arg: 0},
+		{op: opBinary, arg: int32(token.ADD)},
+		{op: opUnary, arg: int32(token.SUB)},
+		{op: opLoad, arg: 1},
+		{op: opConst, arg: 1},
+		{op: opConst, arg: 2},
+		{op: opCall, arity: 3, arg: 0},
+		{op: opBinary, arg: int32(token.MUL)},
+	}, p.code)
+	assert.Equal(t, []string{"var1", "var2"}, p.names)
+	assert.Equal(t, 4, p.depth)
+}
+
+func TestCompileFailingCall(t *testing.T) {
+	parsed, err := parseFormula("var1 + FOO(var2)")
+	assert.NoError(t, err)
+
+	// The arguments of an unknown function are not evaluated
+	p := parsed.program
+	assert.Equal(t, []instruction{
+		{op: opLoad, arg: 0},
+		{op: opFail, arg: 0},
+		{op: opBinary, arg: int32(token.ADD)},
+	}, p.code)
+	assert.EqualError(t, p.errs[0], `Unknown function "FOO"`)
+}
+
+// TestEvaluatorsEqual compares the results and the errors of both
+// evaluators, including the cells the evaluation stopped at.
+func TestEvaluatorsEqual(t *testing.T) {
+	defer SetEvaluator(evaluator)
+
+	cells := model.CellsSnapshot{
+		"var1":  "3",
+		"var2":  "-2.5",
+		"var3":  "text",
+		"var4":  "=var1 * (var2 - 1) / 4",
+		"var5":  "=-var1 + +var2",
+		"var6":  "=SUM(var1, var2, 7) + AVG(var1, 2) - MIN(var4, var5) * MAX(1, var1)",
+		"var7":  "=var3 + 1",
+		"var8":  "=var1 / (var1 - 3)",
+		"var9":  "=missing + var1",
+		"var10": "=var9 * 2",
+		"var11": "=UNKNOWN(var1) + missing",
+		"var12": "=EXTERNAL_REF(http://127.0.0.1:1/api/v1/sheet/var1) + var1",
+		"var14": "=var15",
+		"var15": "=var14 + 1",
+		"var16": "=7 / 2 + 1",
+		"var17": "=-(var3)",
+	}
+
+	type outcome struct {
+		Result       string
+		FormulaError error
+		Volatile     bool
+	}
+	solve := func(e Evaluator) map[string]outcome {
+		SetEvaluator(e)
+		solver := NewSolver(cells, "sheet")
+		solver.SetOffline()
+
+		outcomes := make(map[string]outcome, len(cells))
+		for cellId := range cells {
+			result, _, formulaError, err := solver.Solve(cellId)
+			assert.NoError(t, err)
+			outcomes[cellId] = outcome{result, formulaError, solver.IsVolatile(cellId)}
+		}
+
+		return outcomes
+	}
+
+	tree := solve(TreeEvaluator)
+	assert.Equal(t, tree, solve(BytecodeEvaluator))
+	assert.Equal(t, "-2.625", tree["var4"].Result)
+	assert.Equal(t, ERROR_OFFLINE, tree["var12"].FormulaError)
+	assert.True(t, tree["var12"].Volatile)
+}
+
+// BenchmarkEvaluator evaluates the whole 10k-cell spreadsheet with each of
+// the evaluators.
+func BenchmarkEvaluator(b *testing.B) {
+	defer SetEvaluator(evaluator)
+
+	cells := benchmarkSpreadsheet()
+	for _, e := range []Evaluator{TreeEvaluator, BytecodeEvaluator} {
+		b.Run(e.String(), func(b *testing.B) {
+			SetEvaluator(e)
+			solveSpreadsheet(b, cells)
+		})
+	}
+}
+
+func TestParseEvaluator(t *testing.T) {
+	e, err := ParseEvaluator("tree")
+	assert.NoError(t, err)
+	assert.Equal(t, TreeEvaluator, e)
+
+	_, err = ParseEvaluator("jit")
+	assert.Error(t, err)
+}
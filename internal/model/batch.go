@@ -0,0 +1,81 @@
+package model
+
+import (
+	"errors"
+	"strings"
+)
+
+// Number of attempts of Dao.Update before giving up on concurrent writers.
+const maxUpdateRetries = 32
+
+var ERROR_UPDATE_CONFLICT = errors.New("Spreadsheet was concurrently modified")
+
+type batchOpKind int
+
+const (
+	batchSetCell batchOpKind = iota
+	batchDeleteCell
+	batchAddDependants
+	batchDeleteDependants
+	batchSetResult
+	batchDeleteResult
+)
+
+type batchOp struct {
+	kind      batchOpKind
+	cellId    string
+	value     string
+	dependsOn []string
+}
+
+// Batch collects writes to a single spreadsheet which are applied atomically
+// by Dao.Update.
+type Batch struct {
+	ops []batchOp
+
+	origin    Origin
+	title     *string
+	iteration *IterativeCalculation
+	edit      *EditStack
+	events    []CellChange
+}
+
+// Origin identifies the user and the request making a change.
+type Origin struct {
+	Author    string
+	RequestId string
+}
+
+func (b *Batch) SetCell(cellId string, value string) {
+	b.ops = append(b.ops, batchOp{kind: batchSetCell, cellId: strings.ToLower(cellId), value: value})
+}
+
+func (b *Batch) DeleteCell(cellId string) {
+	b.ops = append(b.ops, batchOp{kind: batchDeleteCell, cellId: strings.ToLower(cellId)})
+}
+
+func (b *Batch) AddDependatFormula(cellId string, dependsOn []string) {
+	b.ops = append(b.ops, batchOp{kind: batchAddDependants, cellId: cellId, dependsOn: dependsOn})
+}
+
+func (b *Batch) DeleteDependatFormula(cellId string, dependsOn []string) {
+	b.ops = append(b.ops, batchOp{kind: batchDeleteDependants, cellId: cellId, dependsOn: dependsOn})
+}
+
+// SetOrigin sets the origin recorded in the cell history, the author of the
+// first change becomes the owner of the spreadsheet.
+func (b *Batch) SetOrigin(origin Origin) {
+	b.origin = origin
+}
+
+func (b *Batch) SetTitle(title string) {
+	b.title = &title
+}
+
+func (b *Batch) SetIterativeCalculation(iteration IterativeCalculation) {
+	b.iteration = &iteration
+}
+
+func (b *Batch) Empty() bool {
+	return len(b.ops) == 0 && b.title == nil && b.iteration == nil && len(b.events) == 0
+}
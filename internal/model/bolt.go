@@ -0,0 +1,1229 @@
+package model
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	boltCellsBucket         = []byte("cells")
+	boltDependantsBucket    = []byte("dependants")
+	boltSubscriptionsBucket = []byte("subscriptions")
+	boltRegistryBucket      = []byte("spreadsheets")
+	boltHistoryBucket       = []byte("history")
+	boltEditsBucket         = []byte("edits")
+	boltSnapshotsBucket     = []byte("snapshots")
+	boltResultsBucket       = []byte("results")
+	boltEventsBucket        = []byte("events")
+	boltDeliveriesBucket    = []byte("deliveries")
+)
+
+// BoltDao stores spreadsheets in a local bbolt file. Every write is a bbolt
+// transaction which is fsynced on commit, so the file stays consistent after
+// a crash. Cell change notifications are delivered in-process.
+type BoltDao struct {
+	db     *bolt.DB
+	pubsub *localPubSub
+
+	locksMu sync.Mutex
+	locks   map[string]*sync.Mutex
+}
+
+func NewBoltDao(path string) (*BoltDao, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltCellsBucket, boltDependantsBucket, boltSubscriptionsBucket, boltRegistryBucket, boltHistoryBucket, boltEditsBucket, boltSnapshotsBucket, boltResultsBucket, boltEventsBucket, boltDeliveriesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &BoltDao{
+		db:     db,
+		pubsub: newLocalPubSub(),
+		locks:  make(map[string]*sync.Mutex),
+	}, nil
+}
+
+func (dao *BoltDao) Close() error {
+	return dao.db.Close()
+}
+
+func boltSheetBucket(tx *bolt.Tx, root []byte, spreadsheetId string) *bolt.Bucket {
+	return tx.Bucket(root).Bucket([]byte(strings.ToLower(spreadsheetId)))
+}
+
+func (dao *BoltDao) IsSpreadsheetExists(spreadsheetId string) (bool, error) {
+	exists := false
+	err := dao.db.View(func(tx *bolt.Tx) error {
+		sheet := boltSheetBucket(tx, boltCellsBucket, spreadsheetId)
+		if sheet != nil {
+			k, _ := sheet.Cursor().First()
+			exists = k != nil
+		}
+		return nil
+	})
+
+	return exists, err
+}
+
+func (dao *BoltDao) GetSpreadeetKeys(spreadsheetId string) ([]string, error) {
+	keys := []string{}
+	err := dao.db.View(func(tx *bolt.Tx) error {
+		sheet := boltSheetBucket(tx, boltCellsBucket, spreadsheetId)
+		if sheet == nil {
+			return nil
+		}
+		return sheet.ForEach(func(k, _ []byte) error {
+			keys = append(keys, string(k))
+			return nil
+		})
+	})
+
+	return keys, err
+}
+
+func (dao *BoltDao) SetCell(spreadsheetId string, cellId string, value string) error {
+	return dao.db.Update(func(tx *bolt.Tx) error {
+		return boltSetCell(tx, spreadsheetId, cellId, value)
+	})
+}
+
+func boltSetCell(tx *bolt.Tx, spreadsheetId string, cellId string, value string) error {
+	sheet, err := tx.Bucket(boltCellsBucket).CreateBucketIfNotExists([]byte(strings.ToLower(spreadsheetId)))
+	if err != nil {
+		return err
+	}
+
+	return sheet.Put([]byte(strings.ToLower(cellId)), []byte(value))
+}
+
+func boltDeleteCell(tx *bolt.Tx, spreadsheetId string, cellId string) error {
+	sheet := boltSheetBucket(tx, boltCellsBucket, spreadsheetId)
+	if sheet == nil {
+		return nil
+	}
+
+	return sheet.Delete([]byte(strings.ToLower(cellId)))
+}
+
+func (dao *BoltDao) GetCell(spreadsheetId string, cellId string) (string, error) {
+	var value string
+	err := dao.db.View(func(tx *bolt.Tx) error {
+		sheet := boltSheetBucket(tx, boltCellsBucket, spreadsheetId)
+		if sheet == nil {
+			return ERROR_NO_CELL
+		}
+
+		v := sheet.Get([]byte(strings.ToLower(cellId)))
+		if v == nil {
+			return ERROR_NO_CELL
+		}
+
+		value = string(v)
+		return nil
+	})
+
+	return value, err
+}
+
+func (dao *BoltDao) GetAllCells(spreadsheetId string) (map[string]string, error) {
+	cells := make(map[string]string)
+	err := dao.db.View(func(tx *bolt.Tx) error {
+		sheet := boltSheetBucket(tx, boltCellsBucket, spreadsheetId)
+		if sheet == nil {
+			return nil
+		}
+		return sheet.ForEach(func(k, v []byte) error {
+			cells[string(k)] = string(v)
+			return nil
+		})
+	})
+
+	return cells, err
+}
+
+func (dao *BoltDao) GetCells(spreadsheetId string, cellIds []string) (map[string]string, error) {
+	cells := make(map[string]string, len(cellIds))
+	err := dao.db.View(func(tx *bolt.Tx) error {
+		sheet := boltSheetBucket(tx, boltCellsBucket, spreadsheetId)
+		if sheet == nil {
+			return nil
+		}
+		for _, cellId := range cellIds {
+			cellId = strings.ToLower(cellId)
+			if value := sheet.Get([]byte(cellId)); value != nil {
+				cells[cellId] = string(value)
+			}
+		}
+		return nil
+	})
+
+	return cells, err
+}
+
+func boltSetResult(tx *bolt.Tx, spreadsheetId string, cellId string, data string) error {
+	results, err := tx.Bucket(boltResultsBucket).CreateBucketIfNotExists([]byte(strings.ToLower(spreadsheetId)))
+	if err != nil {
+		return err
+	}
+
+	return results.Put([]byte(cellId), []byte(data))
+}
+
+func (dao *BoltDao) GetResult(spreadsheetId string, cellId string) (Result, error) {
+	var result Result
+	err := dao.db.View(func(tx *bolt.Tx) error {
+		results := boltSheetBucket(tx, boltResultsBucket, spreadsheetId)
+		if results == nil {
+			return ERROR_NO_RESULT
+		}
+
+		data := results.Get([]byte(strings.ToLower(cellId)))
+		if data == nil {
+			return ERROR_NO_RESULT
+		}
+
+		var err error
+		result, err = unmarshalResult(string(data))
+		return err
+	})
+
+	return result, err
+}
+
+func (dao *BoltDao) GetResults(spreadsheetId string, cellIds []string) (map[string]Result, error) {
+	results := make(map[string]Result, len(cellIds))
+	err := dao.db.View(func(tx *bolt.Tx) error {
+		sheet := boltSheetBucket(tx, boltResultsBucket, spreadsheetId)
+		if sheet == nil {
+			return nil
+		}
+
+		for _, cellId := range cellIds {
+			cellId = strings.ToLower(cellId)
+			data := sheet.Get([]byte(cellId))
+			if data == nil {
+				continue
+			}
+
+			result, err := unmarshalResult(string(data))
+			if err != nil {
+				return err
+			}
+			results[cellId] = result
+		}
+		return nil
+	})
+
+	return results, err
+}
+
+func (dao *BoltDao) GetAllResults(spreadsheetId string) (map[string]Result, error) {
+	results := make(map[string]Result)
+	err := dao.db.View(func(tx *bolt.Tx) error {
+		sheet := boltSheetBucket(tx, boltResultsBucket, spreadsheetId)
+		if sheet == nil {
+			return nil
+		}
+		return sheet.ForEach(func(k, v []byte) error {
+			result, err := unmarshalResult(string(v))
+			results[string(k)] = result
+			return err
+		})
+	})
+
+	return results, err
+}
+
+func (dao *BoltDao) GetSpreadsheetState(spreadsheetId string) (SpreadsheetState, error) {
+	state := SpreadsheetState{
+		Cells:   make(map[string]string),
+		Results: make(map[string]Result),
+	}
+	err := dao.db.View(func(tx *bolt.Tx) error {
+		sheet := boltSheetBucket(tx, boltCellsBucket, spreadsheetId)
+		if sheet == nil {
+			return nil
+		}
+		err := sheet.ForEach(func(k, v []byte) error {
+			state.Cells[string(k)] = string(v)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if results := boltSheetBucket(tx, boltResultsBucket, spreadsheetId); results != nil {
+			for cellId := range state.Cells {
+				if data := results.Get([]byte(cellId)); data != nil {
+					if state.Results[cellId], err = unmarshalResult(string(data)); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		if bucket := tx.Bucket(boltRegistryBucket).Bucket([]byte(strings.ToLower(spreadsheetId))); bucket != nil {
+			if data := bucket.Get([]byte("iteration")); data != nil {
+				return json.Unmarshal(data, &state.IterativeCalculation)
+			}
+		}
+		return nil
+	})
+
+	return state, err
+}
+
+func (dao *BoltDao) GetDependants(spreadsheetId string, cellId string) ([]string, error) {
+	dependants := []string{}
+	err := dao.db.View(func(tx *bolt.Tx) error {
+		sheet := boltSheetBucket(tx, boltDependantsBucket, spreadsheetId)
+		if sheet == nil {
+			return nil
+		}
+
+		cell := sheet.Bucket([]byte(strings.ToLower(cellId)))
+		if cell == nil {
+			return nil
+		}
+
+		return cell.ForEach(func(k, _ []byte) error {
+			dependants = append(dependants, string(k))
+			return nil
+		})
+	})
+
+	return dependants, err
+}
+
+func (dao *BoltDao) GetDependencyIndex(spreadsheetId string) (map[string][]string, error) {
+	index := make(map[string][]string)
+	err := dao.db.View(func(tx *bolt.Tx) error {
+		sheet := boltSheetBucket(tx, boltDependantsBucket, spreadsheetId)
+		if sheet == nil {
+			return nil
+		}
+
+		return sheet.ForEachBucket(func(cellId []byte) error {
+			var dependants []string
+			sheet.Bucket(cellId).ForEach(func(k, _ []byte) error {
+				dependants = append(dependants, string(k))
+				return nil
+			})
+			if len(dependants) > 0 {
+				index[string(cellId)] = dependants
+			}
+			return nil
+		})
+	})
+
+	return index, err
+}
+
+// GetDependantsGraph walks the dependant buckets in a single transaction.
+func (dao *BoltDao) GetDependantsGraph(spreadsheetId string, cellIds []string) (map[string][]string, error) {
+	graph := make(map[string][]string)
+	err := dao.db.View(func(tx *bolt.Tx) error {
+		sheet := boltSheetBucket(tx, boltDependantsBucket, spreadsheetId)
+		if sheet == nil {
+			return nil
+		}
+
+		visited := make(map[string]struct{}, len(cellIds))
+		queue := make([]string, 0, len(cellIds))
+		visit := func(cellId string) {
+			if _, exists := visited[cellId]; !exists {
+				visited[cellId] = struct{}{}
+				queue = append(queue, cellId)
+			}
+		}
+		for _, cellId := range cellIds {
+			visit(strings.ToLower(cellId))
+		}
+
+		for i := 0; i < len(queue); i++ {
+			cell := sheet.Bucket([]byte(queue[i]))
+			if cell == nil {
+				continue
+			}
+
+			var dependants []string
+			cell.ForEach(func(k, _ []byte) error {
+				dependants = append(dependants, string(k))
+				return nil
+			})
+			if len(dependants) == 0 {
+				continue
+			}
+
+			graph[queue[i]] = dependants
+			for _, dependantId := range dependants {
+				visit(dependantId)
+			}
+		}
+
+		return nil
+	})
+
+	return graph, err
+}
+
+func (dao *BoltDao) AddDependatFormula(spreadsheetId string, cellId string, dependsOn []string) error {
+	return dao.db.Update(func(tx *bolt.Tx) error {
+		return boltAddDependatFormula(tx, spreadsheetId, cellId, dependsOn)
+	})
+}
+
+func boltAddDependatFormula(tx *bolt.Tx, spreadsheetId string, cellId string, dependsOn []string) error {
+	sheet, err := tx.Bucket(boltDependantsBucket).CreateBucketIfNotExists([]byte(strings.ToLower(spreadsheetId)))
+	if err != nil {
+		return err
+	}
+
+	cellId = strings.ToLower(cellId)
+	for _, dependantCellId := range dependsOn {
+		if strings.ToLower(dependantCellId) == cellId {
+			continue
+		}
+
+		cell, err := sheet.CreateBucketIfNotExists([]byte(strings.ToLower(dependantCellId)))
+		if err != nil {
+			return err
+		}
+
+		if err := cell.Put([]byte(cellId), []byte{}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (dao *BoltDao) DeleteDependatFormula(spreadsheetId string, cellId string, dependsOn []string) error {
+	return dao.db.Update(func(tx *bolt.Tx) error {
+		return boltDeleteDependatFormula(tx, spreadsheetId, cellId, dependsOn)
+	})
+}
+
+func boltDeleteDependatFormula(tx *bolt.Tx, spreadsheetId string, cellId string, dependsOn []string) error {
+	sheet := boltSheetBucket(tx, boltDependantsBucket, spreadsheetId)
+	if sheet == nil {
+		return nil
+	}
+
+	for _, dependantCellId := range dependsOn {
+		cell := sheet.Bucket([]byte(strings.ToLower(dependantCellId)))
+		if cell == nil {
+			continue
+		}
+
+		if err := cell.Delete([]byte(strings.ToLower(cellId))); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Update serializes updates of the spreadsheet with an in-process lock, bbolt
+// has a single writer so the lock is enough to make validation and write
+// atomic. Reads of fn are done in their own transactions as bbolt must not
+// open a read transaction while the same goroutine holds the write one.
+func (dao *BoltDao) Update(spreadsheetId string, fn func(batch *Batch) error) error {
+	lock := dao.sheetLock(spreadsheetId)
+	lock.Lock()
+	defer lock.Unlock()
+
+	batch := &Batch{}
+	if err := fn(batch); err != nil {
+		return err
+	}
+
+	if batch.Empty() {
+		return nil
+	}
+
+	err := dao.db.Update(func(tx *bolt.Tx) error {
+		if err := boltApplyBatch(tx, spreadsheetId, batch); err != nil {
+			return err
+		}
+		return boltAppendCellEvents(tx, spreadsheetId, batch.events)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Published under the spreadsheet lock, so in the order of the event ids
+	for _, change := range batch.events {
+		dao.NotifyCellChange(spreadsheetId, change)
+	}
+
+	return nil
+}
+
+func (dao *BoltDao) sheetLock(spreadsheetId string) *sync.Mutex {
+	dao.locksMu.Lock()
+	defer dao.locksMu.Unlock()
+
+	key := strings.ToLower(spreadsheetId)
+	lock, exists := dao.locks[key]
+	if !exists {
+		lock = &sync.Mutex{}
+		dao.locks[key] = lock
+	}
+
+	return lock
+}
+
+func boltApplyBatch(tx *bolt.Tx, spreadsheetId string, batch *Batch) error {
+	now := time.Now().UTC()
+
+	if err := boltPushEdit(tx, spreadsheetId, batch); err != nil {
+		return err
+	}
+
+	for _, op := range batch.ops {
+		var err error
+		switch op.kind {
+		case batchSetCell:
+			err = boltSetCell(tx, spreadsheetId, op.cellId, op.value)
+		case batchDeleteCell:
+			err = boltDeleteCell(tx, spreadsheetId, op.cellId)
+		case batchAddDependants:
+			err = boltAddDependatFormula(tx, spreadsheetId, op.cellId, op.dependsOn)
+		case batchDeleteDependants:
+			err = boltDeleteDependatFormula(tx, spreadsheetId, op.cellId, op.dependsOn)
+		case batchSetResult:
+			err = boltSetResult(tx, spreadsheetId, op.cellId, op.value)
+		case batchDeleteResult:
+			if results := boltSheetBucket(tx, boltResultsBucket, spreadsheetId); results != nil {
+				err = results.Delete([]byte(op.cellId))
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := boltAppendHistory(tx, spreadsheetId, batch.historyEntries(now)); err != nil {
+		return err
+	}
+
+	return boltUpdateRegistry(tx, spreadsheetId, batch, now)
+}
+
+// boltPushEdit records the edit reverting the batch, it reads the cell values
+// so it is called before the batch is applied. Edits of a stack are keyed by
+// the bucket sequence.
+func boltPushEdit(tx *bolt.Tx, spreadsheetId string, batch *Batch) error {
+	cellIds := batch.editCells()
+	if len(cellIds) == 0 {
+		return nil
+	}
+
+	values := make(map[string]string, len(cellIds))
+	if cells := boltSheetBucket(tx, boltCellsBucket, spreadsheetId); cells != nil {
+		for _, cellId := range cellIds {
+			if value := cells.Get([]byte(cellId)); value != nil {
+				values[cellId] = string(value)
+			}
+		}
+	}
+
+	data, err := json.Marshal(batch.revertEdit(values))
+	if err != nil {
+		return err
+	}
+
+	sheet, err := tx.Bucket(boltEditsBucket).CreateBucketIfNotExists([]byte(strings.ToLower(spreadsheetId)))
+	if err != nil {
+		return err
+	}
+
+	push, pop, clearRedo := batch.editStacks()
+	if pop != nil {
+		if stack := sheet.Bucket([]byte(pop.String())); stack != nil {
+			if k, _ := stack.Cursor().Last(); k != nil {
+				if err := stack.Delete(k); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if clearRedo && sheet.Bucket([]byte(RedoStack.String())) != nil {
+		if err := sheet.DeleteBucket([]byte(RedoStack.String())); err != nil {
+			return err
+		}
+	}
+
+	stack, err := sheet.CreateBucketIfNotExists([]byte(push.String()))
+	if err != nil {
+		return err
+	}
+
+	seq, err := stack.NextSequence()
+	if err != nil {
+		return err
+	}
+	if err := stack.Put(binary.BigEndian.AppendUint64(nil, seq), data); err != nil {
+		return err
+	}
+
+	var keys [][]byte
+	stack.ForEach(func(k, _ []byte) error {
+		keys = append(keys, k)
+		return nil
+	})
+	for len(keys) > maxUndoEdits {
+		if err := stack.Delete(keys[0]); err != nil {
+			return err
+		}
+		keys = keys[1:]
+	}
+
+	return nil
+}
+
+func (dao *BoltDao) GetEdit(spreadsheetId string, stack EditStack) (Edit, error) {
+	var edit Edit
+	err := dao.db.View(func(tx *bolt.Tx) error {
+		sheet := boltSheetBucket(tx, boltEditsBucket, spreadsheetId)
+		if sheet == nil {
+			return ERROR_NO_EDIT
+		}
+
+		edits := sheet.Bucket([]byte(stack.String()))
+		if edits == nil {
+			return ERROR_NO_EDIT
+		}
+
+		_, data := edits.Cursor().Last()
+		if data == nil {
+			return ERROR_NO_EDIT
+		}
+
+		return json.Unmarshal(data, &edit)
+	})
+
+	return edit, err
+}
+
+func (dao *BoltDao) CreateSnapshot(spreadsheetId string, snapshot Snapshot) error {
+	snapshot.Name = strings.ToLower(snapshot.Name)
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	return dao.db.Update(func(tx *bolt.Tx) error {
+		sheet, err := tx.Bucket(boltSnapshotsBucket).CreateBucketIfNotExists([]byte(strings.ToLower(spreadsheetId)))
+		if err != nil {
+			return err
+		}
+
+		if sheet.Get([]byte(snapshot.Name)) != nil {
+			return ERROR_SNAPSHOT_EXISTS
+		}
+
+		return sheet.Put([]byte(snapshot.Name), data)
+	})
+}
+
+func (dao *BoltDao) ListSnapshots(spreadsheetId string) ([]Snapshot, error) {
+	snapshots := []Snapshot{}
+	err := dao.db.View(func(tx *bolt.Tx) error {
+		sheet := boltSheetBucket(tx, boltSnapshotsBucket, spreadsheetId)
+		if sheet == nil {
+			return nil
+		}
+
+		return sheet.ForEach(func(_, data []byte) error {
+			var snapshot Snapshot
+			if err := json.Unmarshal(data, &snapshot); err != nil {
+				return err
+			}
+			snapshots = append(snapshots, snapshot)
+			return nil
+		})
+	})
+	sortSnapshots(snapshots)
+
+	return snapshots, err
+}
+
+func (dao *BoltDao) GetSnapshot(spreadsheetId string, name string) (Snapshot, error) {
+	var snapshot Snapshot
+	err := dao.db.View(func(tx *bolt.Tx) error {
+		sheet := boltSheetBucket(tx, boltSnapshotsBucket, spreadsheetId)
+		if sheet == nil {
+			return ERROR_NO_SNAPSHOT
+		}
+
+		data := sheet.Get([]byte(strings.ToLower(name)))
+		if data == nil {
+			return ERROR_NO_SNAPSHOT
+		}
+
+		return json.Unmarshal(data, &snapshot)
+	})
+
+	return snapshot, err
+}
+
+// boltAppendHistory stores entries of every cell in its own bucket keyed by
+// the bucket sequence, so the cursor walks them in order.
+func boltAppendHistory(tx *bolt.Tx, spreadsheetId string, entries []historyEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	sheet, err := tx.Bucket(boltHistoryBucket).CreateBucketIfNotExists([]byte(strings.ToLower(spreadsheetId)))
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		cell, err := sheet.CreateBucketIfNotExists([]byte(entry.CellId))
+		if err != nil {
+			return err
+		}
+
+		seq, err := cell.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+
+		if err := cell.Put(binary.BigEndian.AppendUint64(nil, seq), data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (dao *BoltDao) GetCellHistory(spreadsheetId string, cellId string) ([]CellVersion, error) {
+	versions := []CellVersion{}
+	err := dao.db.View(func(tx *bolt.Tx) error {
+		sheet := boltSheetBucket(tx, boltHistoryBucket, spreadsheetId)
+		if sheet == nil {
+			return nil
+		}
+
+		cell := sheet.Bucket([]byte(strings.ToLower(cellId)))
+		if cell == nil {
+			return nil
+		}
+
+		return cell.ForEach(func(_, v []byte) error {
+			var entry historyEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			versions = append(versions, entry.version(len(versions)+1))
+			return nil
+		})
+	})
+
+	return versions, err
+}
+
+// GetCellsAt walks every cell history back from the latest entry to the first
+// one made at the moment or before.
+func (dao *BoltDao) GetCellsAt(spreadsheetId string, at time.Time) (map[string]string, error) {
+	cells := make(map[string]string)
+	err := dao.db.View(func(tx *bolt.Tx) error {
+		sheet := boltSheetBucket(tx, boltHistoryBucket, spreadsheetId)
+		if sheet == nil {
+			return nil
+		}
+
+		return sheet.ForEachBucket(func(cellId []byte) error {
+			c := sheet.Bucket(cellId).Cursor()
+			for k, v := c.Last(); k != nil; k, v = c.Prev() {
+				var entry historyEntry
+				if err := json.Unmarshal(v, &entry); err != nil {
+					return err
+				}
+				if entry.Timestamp.After(at) {
+					continue
+				}
+
+				if !entry.Deleted {
+					cells[string(cellId)] = entry.Value
+				}
+				return nil
+			}
+			return nil
+		})
+	})
+
+	return cells, err
+}
+
+func boltUpdateRegistry(tx *bolt.Tx, spreadsheetId string, batch *Batch, updatedAt time.Time) error {
+	info, err := tx.Bucket(boltRegistryBucket).CreateBucketIfNotExists([]byte(strings.ToLower(spreadsheetId)))
+	if err != nil {
+		return err
+	}
+
+	now := []byte(updatedAt.Format(time.RFC3339Nano))
+	values := map[string][]byte{"updatedAt": now}
+	if info.Get([]byte("createdAt")) == nil {
+		values["createdAt"] = now
+		values["owner"] = []byte(batch.origin.Author)
+	}
+	if batch.title != nil {
+		values["title"] = []byte(*batch.title)
+	}
+	if batch.iteration != nil {
+		if values["iteration"], err = json.Marshal(batch.iteration); err != nil {
+			return err
+		}
+	}
+
+	for k, v := range values {
+		if err := info.Put([]byte(k), v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ListSpreadsheets seeks the registry bucket, keys of bbolt buckets are
+// ordered bytewise.
+func (dao *BoltDao) ListSpreadsheets(prefix string, after string, limit int) ([]SpreadsheetInfo, error) {
+	prefix = strings.ToLower(prefix)
+	after = strings.ToLower(after)
+
+	infos := []SpreadsheetInfo{}
+	err := dao.db.View(func(tx *bolt.Tx) error {
+		start := prefix
+		if after > prefix {
+			start = after
+		}
+
+		c := tx.Bucket(boltRegistryBucket).Cursor()
+		for k, _ := c.Seek([]byte(start)); k != nil && len(infos) < limit; k, _ = c.Next() {
+			if !strings.HasPrefix(string(k), prefix) {
+				break
+			}
+			if string(k) == after {
+				continue
+			}
+
+			info, err := boltSpreadsheetInfo(tx, string(k))
+			if err != nil {
+				return err
+			}
+			infos = append(infos, info)
+		}
+
+		return nil
+	})
+
+	return infos, err
+}
+
+func (dao *BoltDao) GetSpreadsheetInfo(spreadsheetId string) (SpreadsheetInfo, error) {
+	var info SpreadsheetInfo
+	err := dao.db.View(func(tx *bolt.Tx) error {
+		var err error
+		info, err = boltSpreadsheetInfo(tx, strings.ToLower(spreadsheetId))
+		return err
+	})
+
+	return info, err
+}
+
+func (dao *BoltDao) GetIterativeCalculation(spreadsheetId string) (IterativeCalculation, error) {
+	var iteration IterativeCalculation
+	err := dao.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltRegistryBucket).Bucket([]byte(strings.ToLower(spreadsheetId)))
+		if bucket == nil {
+			return nil
+		}
+
+		if data := bucket.Get([]byte("iteration")); data != nil {
+			return json.Unmarshal(data, &iteration)
+		}
+		return nil
+	})
+
+	return iteration, err
+}
+
+func boltSpreadsheetInfo(tx *bolt.Tx, spreadsheetId string) (SpreadsheetInfo, error) {
+	bucket := tx.Bucket(boltRegistryBucket).Bucket([]byte(spreadsheetId))
+	if bucket == nil {
+		return SpreadsheetInfo{}, ERROR_NO_SPREADSHEET
+	}
+
+	info := SpreadsheetInfo{
+		Id:    spreadsheetId,
+		Title: string(bucket.Get([]byte("title"))),
+		Owner: string(bucket.Get([]byte("owner"))),
+	}
+
+	var err error
+	if info.CreatedAt, err = time.Parse(time.RFC3339Nano, string(bucket.Get([]byte("createdAt")))); err != nil {
+		return SpreadsheetInfo{}, err
+	}
+	if info.UpdatedAt, err = time.Parse(time.RFC3339Nano, string(bucket.Get([]byte("updatedAt")))); err != nil {
+		return SpreadsheetInfo{}, err
+	}
+	if iteration := bucket.Get([]byte("iteration")); iteration != nil {
+		if err := json.Unmarshal(iteration, &info.IterativeCalculation); err != nil {
+			return SpreadsheetInfo{}, err
+		}
+	}
+
+	if sheet := boltSheetBucket(tx, boltCellsBucket, spreadsheetId); sheet != nil {
+		info.CellCount = sheet.Stats().KeyN
+	}
+
+	return info, nil
+}
+
+func (dao *BoltDao) DeleteSpreadsheet(spreadsheetId string) error {
+	lock := dao.sheetLock(spreadsheetId)
+	lock.Lock()
+	defer lock.Unlock()
+
+	return dao.db.Update(func(tx *bolt.Tx) error {
+		name := []byte(strings.ToLower(spreadsheetId))
+		for _, root := range [][]byte{boltCellsBucket, boltDependantsBucket, boltRegistryBucket, boltHistoryBucket, boltEditsBucket, boltSnapshotsBucket, boltResultsBucket, boltEventsBucket} {
+			if tx.Bucket(root).Bucket(name) == nil {
+				continue
+			}
+			if err := tx.Bucket(root).DeleteBucket(name); err != nil {
+				return err
+			}
+		}
+
+		subscriptions := tx.Bucket(boltSubscriptionsBucket)
+		var subIds [][]byte
+		err := subscriptions.ForEachBucket(func(subId []byte) error {
+			if string(subscriptions.Bucket(subId).Get([]byte("spreadsheetId"))) == string(name) {
+				subIds = append(subIds, subId)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, subId := range subIds {
+			if err := subscriptions.DeleteBucket(subId); err != nil {
+				return err
+			}
+			if tx.Bucket(boltDeliveriesBucket).Bucket(subId) == nil {
+				continue
+			}
+			if err := tx.Bucket(boltDeliveriesBucket).DeleteBucket(subId); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (dao *BoltDao) CreateSubscription(spreadsheetId string, cellId string) (string, error) {
+	return dao.createSubscription(spreadsheetId, cellId, nil)
+}
+
+func (dao *BoltDao) CreateWebhook(spreadsheetId string, cellId string, url string, secret string) (string, error) {
+	return dao.createSubscription(spreadsheetId, cellId, map[string]string{"callbackUrl": url, "secret": secret})
+}
+
+func (dao *BoltDao) createSubscription(spreadsheetId string, cellId string, fields map[string]string) (string, error) {
+	var id string
+	err := dao.db.Update(func(tx *bolt.Tx) error {
+		subscriptions := tx.Bucket(boltSubscriptionsBucket)
+
+		idVal, err := subscriptions.NextSequence()
+		if err != nil {
+			return err
+		}
+		id = strconv.FormatUint(idVal, 16)
+
+		sub, err := subscriptions.CreateBucket([]byte(id))
+		if err != nil {
+			return err
+		}
+
+		if err := sub.Put([]byte("spreadsheetId"), []byte(strings.ToLower(spreadsheetId))); err != nil {
+			return err
+		}
+
+		for k, v := range fields {
+			if err := sub.Put([]byte(k), []byte(v)); err != nil {
+				return err
+			}
+		}
+
+		return sub.Put([]byte("cellId"), []byte(strings.ToLower(cellId)))
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// GetWebhooks scans the subscriptions as they are not indexed by cells.
+func (dao *BoltDao) GetWebhooks(spreadsheetId string, cellIds []string) ([]Webhook, error) {
+	cells := make(map[string]bool, len(cellIds))
+	for _, cellId := range cellIds {
+		cells[strings.ToLower(cellId)] = true
+	}
+
+	var webhooks []Webhook
+	err := dao.db.View(func(tx *bolt.Tx) error {
+		subscriptions := tx.Bucket(boltSubscriptionsBucket)
+		return subscriptions.ForEachBucket(func(subId []byte) error {
+			data := make(map[string]string)
+			subscriptions.Bucket(subId).ForEach(func(k, v []byte) error {
+				data[string(k)] = string(v)
+				return nil
+			})
+
+			webhook, ok := WebhookFromSubscription(string(subId), data)
+			if ok && webhook.SpreadsheetId == strings.ToLower(spreadsheetId) && cells[webhook.CellId] {
+				webhooks = append(webhooks, webhook)
+			}
+			return nil
+		})
+	})
+
+	return webhooks, err
+}
+
+// SaveDelivery keys the deliveries of a subscription by their ids, new ones
+// are numbered by the bucket sequence.
+func (dao *BoltDao) SaveDelivery(delivery Delivery) (Delivery, error) {
+	err := dao.db.Update(func(tx *bolt.Tx) error {
+		sub, err := tx.Bucket(boltDeliveriesBucket).CreateBucketIfNotExists([]byte(delivery.SubscriptionId))
+		if err != nil {
+			return err
+		}
+
+		if delivery.Id == 0 {
+			seq, err := sub.NextSequence()
+			if err != nil {
+				return err
+			}
+			delivery.Id = int64(seq)
+		}
+
+		data, err := json.Marshal(delivery)
+		if err != nil {
+			return err
+		}
+
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, uint64(delivery.Id))
+		if err := sub.Put(key, data); err != nil {
+			return err
+		}
+
+		n := 0
+		c := sub.Cursor()
+		for k, _ := c.Last(); k != nil; k, _ = c.Prev() {
+			n++
+		}
+		for ; n > MaxDeliveries; n-- {
+			k, _ := sub.Cursor().First()
+			if err := sub.Delete(k); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	return delivery, nil
+}
+
+func (dao *BoltDao) GetDeliveries(subId string) ([]Delivery, error) {
+	deliveries := []Delivery{}
+	err := dao.db.View(func(tx *bolt.Tx) error {
+		sub := tx.Bucket(boltDeliveriesBucket).Bucket([]byte(subId))
+		if sub == nil {
+			return nil
+		}
+
+		return sub.ForEach(func(_, v []byte) error {
+			var delivery Delivery
+			if err := json.Unmarshal(v, &delivery); err != nil {
+				return err
+			}
+			deliveries = append(deliveries, delivery)
+			return nil
+		})
+	})
+
+	return deliveries, err
+}
+
+// GetPendingDeliveries scans the deliveries of every subscription.
+func (dao *BoltDao) GetPendingDeliveries() ([]Delivery, error) {
+	var deliveries []Delivery
+	err := dao.db.View(func(tx *bolt.Tx) error {
+		subscriptions := tx.Bucket(boltDeliveriesBucket)
+		return subscriptions.ForEachBucket(func(subId []byte) error {
+			return subscriptions.Bucket(subId).ForEach(func(_, v []byte) error {
+				var delivery Delivery
+				if err := json.Unmarshal(v, &delivery); err != nil {
+					return err
+				}
+				if delivery.Status == DeliveryPending {
+					deliveries = append(deliveries, delivery)
+				}
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortDeliveries(deliveries)
+
+	return deliveries, nil
+}
+
+func (dao *BoltDao) GetSubscription(subId string) (map[string]string, error) {
+	data := make(map[string]string)
+	err := dao.db.View(func(tx *bolt.Tx) error {
+		sub := tx.Bucket(boltSubscriptionsBucket).Bucket([]byte(subId))
+		if sub == nil {
+			return ERROR_NO_SUBSCRIPTION
+		}
+
+		return sub.ForEach(func(k, v []byte) error {
+			data[string(k)] = string(v)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (dao *BoltDao) Subscribe(subId string) (Subscriber, error) {
+	data, err := dao.GetSubscription(subId)
+	if err != nil {
+		return nil, err
+	}
+
+	return dao.pubsub.Subscribe(subscriptionPubSubKey(data["spreadsheetId"], data["cellId"])), nil
+}
+
+func (dao *BoltDao) SubscribeSpreadsheet(spreadsheetId string) (Subscriber, error) {
+	return dao.pubsub.Subscribe(spreadsheetPubSubKey(strings.ToLower(spreadsheetId))), nil
+}
+
+// boltAppendCellEvents numbers the events by the sequence of the spreadsheet
+// bucket, events of a cell are keyed by their ids. The ids are set on changes.
+func boltAppendCellEvents(tx *bolt.Tx, spreadsheetId string, changes []CellChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	sheet, err := tx.Bucket(boltEventsBucket).CreateBucketIfNotExists([]byte(strings.ToLower(spreadsheetId)))
+	if err != nil {
+		return err
+	}
+
+	for i := range changes {
+		cell, err := sheet.CreateBucketIfNotExists([]byte(strings.ToLower(changes[i].CellId)))
+		if err != nil {
+			return err
+		}
+
+		seq, err := sheet.NextSequence()
+		if err != nil {
+			return err
+		}
+		changes[i].EventId = int64(seq)
+
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, seq)
+		if err := cell.Put(key, []byte(marshalCellChange(changes[i]))); err != nil {
+			return err
+		}
+
+		n := 0
+		c := cell.Cursor()
+		for k, _ := c.Last(); k != nil; k, _ = c.Prev() {
+			n++
+		}
+		for ; n > MaxCellEvents; n-- {
+			k, _ := cell.Cursor().First()
+			if err := cell.Delete(k); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (dao *BoltDao) GetCellEvents(spreadsheetId string, cellId string) ([]CellChange, error) {
+	events := []CellChange{}
+	err := dao.db.View(func(tx *bolt.Tx) error {
+		sheet := boltSheetBucket(tx, boltEventsBucket, spreadsheetId)
+		if sheet == nil {
+			return nil
+		}
+
+		cell := sheet.Bucket([]byte(strings.ToLower(cellId)))
+		if cell == nil {
+			return nil
+		}
+
+		return cell.ForEach(func(_, v []byte) error {
+			var event CellChange
+			if err := json.Unmarshal(v, &event); err != nil {
+				return err
+			}
+			events = append(events, event)
+			return nil
+		})
+	})
+
+	return events, err
+}
+
+func (dao *BoltDao) NotifyCellChange(spreadsheetId string, change CellChange) error {
+	dao.pubsub.PublishCellChange(strings.ToLower(spreadsheetId), change)
+	return nil
+}
@@ -0,0 +1,123 @@
+package model
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func prepareBolt(t *testing.T) *BoltDao {
+	dao, err := NewBoltDao(filepath.Join(t.TempDir(), "spreadsheet.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dao.Close() })
+
+	return dao
+}
+
+func TestBoltCells(t *testing.T) {
+	testDaoCells(t, prepareBolt(t))
+}
+
+func TestBoltDependants(t *testing.T) {
+	testDaoDependants(t, prepareBolt(t))
+}
+
+func TestBoltSubscription(t *testing.T) {
+	testDaoSubscription(t, prepareBolt(t))
+}
+
+func TestBoltSubscribeSpreadsheet(t *testing.T) {
+	testDaoSubscribeSpreadsheet(t, prepareBolt(t))
+}
+
+func TestBoltUpdate(t *testing.T) {
+	testDaoUpdate(t, prepareBolt(t))
+}
+
+func TestBoltDependencyIndex(t *testing.T) {
+	testDaoDependencyIndex(t, prepareBolt(t))
+}
+
+func TestBoltDependantsGraph(t *testing.T) {
+	testDaoDependantsGraph(t, prepareBolt(t))
+}
+
+func TestBoltDeleteSpreadsheet(t *testing.T) {
+	testDaoDeleteSpreadsheet(t, prepareBolt(t))
+}
+
+func TestBoltRegistry(t *testing.T) {
+	testDaoRegistry(t, prepareBolt(t))
+}
+
+func TestBoltHistory(t *testing.T) {
+	testDaoHistory(t, prepareBolt(t))
+}
+
+func TestBoltEdits(t *testing.T) {
+	testDaoEdits(t, prepareBolt(t))
+}
+
+func TestBoltSnapshots(t *testing.T) {
+	testDaoSnapshots(t, prepareBolt(t))
+}
+
+func TestBoltIterativeCalculation(t *testing.T) {
+	testDaoIterativeCalculation(t, prepareBolt(t))
+}
+
+func TestBoltResults(t *testing.T) {
+	testDaoResults(t, prepareBolt(t))
+}
+
+func TestBoltSpreadsheetState(t *testing.T) {
+	testDaoSpreadsheetState(t, prepareBolt(t))
+}
+
+func TestBoltCellEvents(t *testing.T) {
+	testDaoCellEvents(t, prepareBolt(t))
+}
+
+func TestBoltWebhooks(t *testing.T) {
+	testDaoWebhooks(t, prepareBolt(t))
+}
+
+func TestBoltSubscriberClose(t *testing.T) {
+	dao := prepareBolt(t)
+
+	id, err := dao.CreateSubscription("devchallenge-xx", "var1")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", id)
+
+	subscriber, err := dao.Subscribe(id)
+	assert.NoError(t, err)
+	assert.NoError(t, subscriber.Close())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err = subscriber.ReceiveMessage(ctx)
+	assert.Equal(t, ERROR_SUBSCRIBER_CLOSED, err)
+}
+
+func TestBoltReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spreadsheet.db")
+
+	dao, err := NewBoltDao(path)
+	assert.NoError(t, err)
+	assert.NoError(t, dao.SetCell("devchallenge-xx", "var1", "1"))
+	assert.NoError(t, dao.Close())
+
+	dao, err = NewBoltDao(path)
+	assert.NoError(t, err)
+	defer dao.Close()
+
+	value, err := dao.GetCell("devchallenge-xx", "var1")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", value)
+}
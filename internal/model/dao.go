@@ -0,0 +1,156 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Dao is the storage backend of the spreadsheets, their dependency index and
+// cell subscriptions.
+type Dao interface {
+	IsSpreadsheetExists(spreadsheetId string) (bool, error)
+	GetSpreadeetKeys(spreadsheetId string) ([]string, error)
+
+	SetCell(spreadsheetId string, cellId string, value string) error
+	GetCell(spreadsheetId string, cellId string) (string, error)
+	GetAllCells(spreadsheetId string) (map[string]string, error)
+	// GetCells reads the cells at once, missing cells are omitted.
+	GetCells(spreadsheetId string, cellIds []string) (map[string]string, error)
+
+	// GetResult returns the materialized result of the cell or
+	// ERROR_NO_RESULT.
+	GetResult(spreadsheetId string, cellId string) (Result, error)
+	GetAllResults(spreadsheetId string) (map[string]Result, error)
+	// GetResults reads the results at once, cells without a materialized
+	// result are omitted.
+	GetResults(spreadsheetId string, cellIds []string) (map[string]Result, error)
+	// GetSpreadsheetState reads the cells with their results and the
+	// iterative calculation setting at once, so they come from the same
+	// update. A missing spreadsheet has no cells.
+	GetSpreadsheetState(spreadsheetId string) (SpreadsheetState, error)
+
+	GetDependants(spreadsheetId string, cellId string) ([]string, error)
+	AddDependatFormula(spreadsheetId string, cellId string, dependsOn []string) error
+	DeleteDependatFormula(spreadsheetId string, cellId string, dependsOn []string) error
+	// GetDependencyIndex returns dependants of every cell of the spreadsheet.
+	GetDependencyIndex(spreadsheetId string) (map[string][]string, error)
+	// GetDependantsGraph returns dependants of the cells and of all of their
+	// transitive dependants read at once, cells without dependants are
+	// omitted like in GetDependencyIndex.
+	GetDependantsGraph(spreadsheetId string, cellIds []string) (map[string][]string, error)
+
+	// Update runs fn and atomically applies the writes collected in the
+	// batch. fn must read the spreadsheet through the Dao and may be called
+	// again when a concurrent update was detected.
+	Update(spreadsheetId string, fn func(batch *Batch) error) error
+
+	// DeleteSpreadsheet removes cells, dependency index, subscriptions,
+	// history and snapshots of the spreadsheet.
+	DeleteSpreadsheet(spreadsheetId string) error
+
+	// GetCellHistory returns versions of the cell from the oldest one.
+	GetCellHistory(spreadsheetId string, cellId string) ([]CellVersion, error)
+	// GetCellsAt returns cells of the spreadsheet as they were at the moment.
+	GetCellsAt(spreadsheetId string, at time.Time) (map[string]string, error)
+	// GetEdit returns the top edit of the stack or ERROR_NO_EDIT when it is
+	// empty.
+	GetEdit(spreadsheetId string, stack EditStack) (Edit, error)
+
+	// CreateSnapshot stores the snapshot or returns ERROR_SNAPSHOT_EXISTS when
+	// the name is taken.
+	CreateSnapshot(spreadsheetId string, snapshot Snapshot) error
+	// ListSnapshots returns snapshots of the spreadsheet from the oldest one.
+	ListSnapshots(spreadsheetId string) ([]Snapshot, error)
+	GetSnapshot(spreadsheetId string, name string) (Snapshot, error)
+
+	// ListSpreadsheets returns up to limit registered spreadsheets with the
+	// id prefix ordered by id, starting after the given id.
+	ListSpreadsheets(prefix string, after string, limit int) ([]SpreadsheetInfo, error)
+	GetSpreadsheetInfo(spreadsheetId string) (SpreadsheetInfo, error)
+	// GetIterativeCalculation returns the spreadsheet setting, it is disabled
+	// for unknown spreadsheets.
+	GetIterativeCalculation(spreadsheetId string) (IterativeCalculation, error)
+
+	CreateSubscription(spreadsheetId string, cellId string) (string, error)
+	// CreateWebhook creates a subscription of the cell delivered to the
+	// callback url, the subscription data includes the url and the secret.
+	CreateWebhook(spreadsheetId string, cellId string, url string, secret string) (string, error)
+	// GetWebhooks returns the webhook subscriptions of the cells.
+	GetWebhooks(spreadsheetId string, cellIds []string) ([]Webhook, error)
+	// SaveDelivery stores the delivery, a new one without id is assigned
+	// the next id of its subscription. The MaxDeliveries latest deliveries
+	// of a subscription are kept.
+	SaveDelivery(delivery Delivery) (Delivery, error)
+	// GetDeliveries returns the deliveries of the subscription from the
+	// oldest one.
+	GetDeliveries(subId string) ([]Delivery, error)
+	// GetPendingDeliveries returns the pending deliveries of every
+	// subscription, so their attempts are resumed after a restart.
+	GetPendingDeliveries() ([]Delivery, error)
+	GetSubscription(subId string) (map[string]string, error)
+	Subscribe(subId string) (Subscriber, error)
+	// SubscribeSpreadsheet receives the changes of every cell of the
+	// spreadsheet, the cell is given by the change.
+	SubscribeSpreadsheet(spreadsheetId string) (Subscriber, error)
+	// GetCellEvents returns the event log of the cell from the oldest change,
+	// the MaxCellEvents latest changes published by Batch.PublishCellChanges
+	// are kept.
+	GetCellEvents(spreadsheetId string, cellId string) ([]CellChange, error)
+	// NotifyCellChange publishes the change to the subscribers of the cell as
+	// JSON.
+	NotifyCellChange(spreadsheetId string, change CellChange) error
+}
+
+// SpreadsheetInfo is the registry entry of a spreadsheet, it is maintained by
+// Dao.Update.
+type SpreadsheetInfo struct {
+	Id        string
+	Title     string
+	Owner     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	CellCount int
+
+	IterativeCalculation IterativeCalculation
+}
+
+// SpreadsheetState is a consistent read of the spreadsheet, Results holds the
+// materialized results of the Cells.
+type SpreadsheetState struct {
+	Cells                map[string]string
+	Results              map[string]Result
+	IterativeCalculation IterativeCalculation
+}
+
+// IterativeCalculation allows circular references, cells of a cycle are
+// evaluated repeatedly until the results change by at most Epsilon. Zero
+// MaxIterations and Epsilon are replaced by the solver defaults.
+type IterativeCalculation struct {
+	Enabled       bool    `json:"enabled"`
+	MaxIterations int     `json:"maxIterations,omitempty"`
+	Epsilon       float64 `json:"epsilon,omitempty"`
+}
+
+// Subscriber receives cell change notifications of a single subscription.
+type Subscriber interface {
+	ReceiveMessage(ctx context.Context) (string, error)
+	Close() error
+}
+
+var ERROR_NO_SUBSCRIPTION = errors.New("Unknown key")
+var ERROR_NO_CELL = errors.New("Unknown cell")
+var ERROR_NO_SPREADSHEET = errors.New("Unknown spreadsheet")
+
+var ctx = context.Background()
+
+func subscriptionPubSubKey(spreadsheetId, cellId string) string {
+	return fmt.Sprintf("pubsub:%s/%s", spreadsheetId, cellId)
+}
+
+// spreadsheetPubSubKey does not collide with the cell keys as spreadsheet ids
+// have no slashes.
+func spreadsheetPubSubKey(spreadsheetId string) string {
+	return fmt.Sprintf("pubsub:%s", spreadsheetId)
+}
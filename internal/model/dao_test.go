@@ -0,0 +1,842 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testDaoCells(t *testing.T, dao Dao) {
+	exists, err := dao.IsSpreadsheetExists("devchallenge-xx")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	_, err = dao.GetCell("devchallenge-xx", "var1")
+	assert.Equal(t, ERROR_NO_CELL, err)
+
+	assert.NoError(t, dao.SetCell("DevChallenge-XX", "VAR1", "1"))
+	assert.NoError(t, dao.SetCell("devchallenge-xx", "var2", "=var1+1"))
+
+	exists, err = dao.IsSpreadsheetExists("devchallenge-xx")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	value, err := dao.GetCell("devchallenge-xx", "var1")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", value)
+
+	keys, err := dao.GetSpreadeetKeys("devchallenge-xx")
+	assert.NoError(t, err)
+	sort.Strings(keys)
+	assert.Equal(t, []string{"var1", "var2"}, keys)
+
+	cells, err := dao.GetAllCells("devchallenge-xx")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"var1": "1", "var2": "=var1+1"}, cells)
+
+	cells, err = dao.GetCells("devchallenge-xx", []string{"VAR2", "var3"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"var2": "=var1+1"}, cells)
+}
+
+func testDaoDependants(t *testing.T, dao Dao) {
+	assert.NoError(t, dao.AddDependatFormula("devchallenge-xx", "var3", []string{"var1", "var2", "var3"}))
+	assert.NoError(t, dao.AddDependatFormula("devchallenge-xx", "var4", []string{"var1"}))
+
+	deps, err := dao.GetDependants("devchallenge-xx", "var1")
+	assert.NoError(t, err)
+	sort.Strings(deps)
+	assert.Equal(t, []string{"var3", "var4"}, deps)
+
+	deps, err = dao.GetDependants("devchallenge-xx", "var3")
+	assert.NoError(t, err)
+	assert.Empty(t, deps)
+
+	assert.NoError(t, dao.DeleteDependatFormula("devchallenge-xx", "var3", []string{"var1"}))
+
+	deps, err = dao.GetDependants("devchallenge-xx", "var1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"var4"}, deps)
+}
+
+func testDaoSubscription(t *testing.T, dao Dao) {
+	_, err := dao.Subscribe("1")
+	assert.Equal(t, ERROR_NO_SUBSCRIPTION, err)
+
+	id, err := dao.CreateSubscription("DevChallenge-XX", "Var1")
+	assert.NoError(t, err)
+
+	data, err := dao.GetSubscription(id)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"spreadsheetId": "devchallenge-xx", "cellId": "var1"}, data)
+
+	subscriber, err := dao.Subscribe(id)
+	assert.NoError(t, err)
+
+	assert.NoError(t, dao.NotifyCellChange("devchallenge-xx", CellChange{CellId: "var2"}))
+	assert.NoError(t, dao.NotifyCellChange("devchallenge-xx", CellChange{
+		CellId: "VAR1",
+		Old:    &Result{Value: "1", Result: "1"},
+		New:    &Result{Value: "2", Result: "2"},
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	msg, err := subscriber.ReceiveMessage(ctx)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"cellId": "var1", "old": {"value": "1", "result": "1"}, "new": {"value": "2", "result": "2"}}`, msg)
+
+	assert.NoError(t, subscriber.Close())
+}
+
+func testDaoSubscribeSpreadsheet(t *testing.T, dao Dao) {
+	subscriber, err := dao.SubscribeSpreadsheet("DevChallenge-*")
+	assert.NoError(t, err)
+	defer subscriber.Close()
+
+	assert.NoError(t, dao.NotifyCellChange("devchallenge-xx", CellChange{CellId: "var1"}))
+	assert.NoError(t, dao.NotifyCellChange("devchallenge-*", CellChange{CellId: "VAR1"}))
+	assert.NoError(t, dao.NotifyCellChange("devchallenge-*", CellChange{
+		CellId: "var2",
+		New:    &Result{Value: "2", Result: "2"},
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// The spreadsheet id is not a pattern
+	msg, err := subscriber.ReceiveMessage(ctx)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"cellId": "var1"}`, msg)
+
+	msg, err = subscriber.ReceiveMessage(ctx)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"cellId": "var2", "new": {"value": "2", "result": "2"}}`, msg)
+}
+
+func testDaoUpdate(t *testing.T, dao Dao) {
+	err := dao.Update("devchallenge-xx", func(batch *Batch) error {
+		batch.SetCell("var1", "1")
+		batch.SetCell("var2", "=var1")
+		batch.AddDependatFormula("var2", []string{"var1"})
+		return nil
+	})
+	assert.NoError(t, err)
+
+	cells, err := dao.GetAllCells("devchallenge-xx")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"var1": "1", "var2": "=var1"}, cells)
+
+	deps, err := dao.GetDependants("devchallenge-xx", "var1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"var2"}, deps)
+
+	failure := errors.New("validation failure")
+	err = dao.Update("devchallenge-xx", func(batch *Batch) error {
+		batch.SetCell("var1", "2")
+		return failure
+	})
+	assert.Equal(t, failure, err)
+
+	value, err := dao.GetCell("devchallenge-xx", "var1")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", value)
+}
+
+func testDaoDependencyIndex(t *testing.T, dao Dao) {
+	assert.NoError(t, dao.AddDependatFormula("devchallenge-xx", "VAR3", []string{"var1", "Var2"}))
+	assert.NoError(t, dao.AddDependatFormula("devchallenge-xx", "var4", []string{"var1"}))
+	assert.NoError(t, dao.AddDependatFormula("devchallenge-xx-2", "var5", []string{"var1"}))
+
+	index, err := dao.GetDependencyIndex("devchallenge-xx")
+	assert.NoError(t, err)
+	assert.Len(t, index, 2)
+	assert.ElementsMatch(t, []string{"var3", "var4"}, index["var1"])
+	assert.ElementsMatch(t, []string{"var3"}, index["var2"])
+}
+
+func testDaoDependantsGraph(t *testing.T, dao Dao) {
+	// var1 -> var2, var3 -> var4 -> var5 and var6 -> var7
+	assert.NoError(t, dao.AddDependatFormula("devchallenge-xx", "var2", []string{"VAR1"}))
+	assert.NoError(t, dao.AddDependatFormula("devchallenge-xx", "var3", []string{"var1"}))
+	assert.NoError(t, dao.AddDependatFormula("devchallenge-xx", "var4", []string{"var2", "var3"}))
+	assert.NoError(t, dao.AddDependatFormula("devchallenge-xx", "var5", []string{"var4", "var5"}))
+	assert.NoError(t, dao.AddDependatFormula("devchallenge-xx", "var7", []string{"var6"}))
+	assert.NoError(t, dao.AddDependatFormula("devchallenge-xx-2", "var8", []string{"var5"}))
+
+	graph, err := dao.GetDependantsGraph("DevChallenge-XX", []string{"Var1", "var3", "var8"})
+	assert.NoError(t, err)
+	assert.Len(t, graph, 4)
+	assert.ElementsMatch(t, []string{"var2", "var3"}, graph["var1"])
+	assert.Equal(t, []string{"var4"}, graph["var2"])
+	assert.Equal(t, []string{"var4"}, graph["var3"])
+	assert.Equal(t, []string{"var5"}, graph["var4"])
+
+	graph, err = dao.GetDependantsGraph("devchallenge-xx", []string{"var5"})
+	assert.NoError(t, err)
+	assert.Empty(t, graph)
+}
+
+func testDaoDeleteSpreadsheet(t *testing.T, dao Dao) {
+	assert.NoError(t, dao.SetCell("devchallenge-xx", "var1", "1"))
+	assert.NoError(t, dao.SetCell("devchallenge-yy", "var1", "1"))
+	assert.NoError(t, dao.AddDependatFormula("devchallenge-xx", "var2", []string{"var1"}))
+
+	subId, err := dao.CreateSubscription("devchallenge-xx", "var1")
+	assert.NoError(t, err)
+	otherSubId, err := dao.CreateSubscription("devchallenge-yy", "var1")
+	assert.NoError(t, err)
+
+	assert.NoError(t, dao.DeleteSpreadsheet("DevChallenge-XX"))
+
+	exists, err := dao.IsSpreadsheetExists("devchallenge-xx")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	index, err := dao.GetDependencyIndex("devchallenge-xx")
+	assert.NoError(t, err)
+	assert.Empty(t, index)
+
+	_, err = dao.GetSubscription(subId)
+	assert.Equal(t, ERROR_NO_SUBSCRIPTION, err)
+
+	_, err = dao.GetSubscription(otherSubId)
+	assert.NoError(t, err)
+
+	exists, err = dao.IsSpreadsheetExists("devchallenge-yy")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func testDaoRegistry(t *testing.T, dao Dao) {
+	_, err := dao.GetSpreadsheetInfo("devchallenge-xx")
+	assert.Equal(t, ERROR_NO_SPREADSHEET, err)
+
+	for _, sheetId := range []string{"DevChallenge-XX", "devchallenge-yy", "other", "devchallenge-zz"} {
+		err := dao.Update(sheetId, func(batch *Batch) error {
+			batch.SetOrigin(Origin{Author: "alice"})
+			batch.SetCell("var1", "1")
+			return nil
+		})
+		assert.NoError(t, err)
+	}
+
+	err = dao.Update("devchallenge-xx", func(batch *Batch) error {
+		batch.SetOrigin(Origin{Author: "bob"})
+		batch.SetTitle("Budget")
+		batch.SetCell("var2", "2")
+		return nil
+	})
+	assert.NoError(t, err)
+
+	info, err := dao.GetSpreadsheetInfo("DevChallenge-XX")
+	assert.NoError(t, err)
+	assert.Equal(t, "devchallenge-xx", info.Id)
+	assert.Equal(t, "Budget", info.Title)
+	assert.Equal(t, "alice", info.Owner)
+	assert.Equal(t, 2, info.CellCount)
+	assert.False(t, info.CreatedAt.IsZero())
+	assert.False(t, info.UpdatedAt.Before(info.CreatedAt))
+
+	ids := func(infos []SpreadsheetInfo) []string {
+		result := []string{}
+		for _, info := range infos {
+			result = append(result, info.Id)
+		}
+		return result
+	}
+
+	infos, err := dao.ListSpreadsheets("", "", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"devchallenge-xx", "devchallenge-yy", "devchallenge-zz", "other"}, ids(infos))
+
+	infos, err = dao.ListSpreadsheets("DevChallenge", "", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"devchallenge-xx", "devchallenge-yy"}, ids(infos))
+
+	infos, err = dao.ListSpreadsheets("devchallenge", "devchallenge-yy", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"devchallenge-zz"}, ids(infos))
+
+	infos, err = dao.ListSpreadsheets("devchallenge", "a", 10)
+	assert.NoError(t, err)
+	assert.Len(t, infos, 3)
+
+	assert.NoError(t, dao.DeleteSpreadsheet("devchallenge-yy"))
+
+	_, err = dao.GetSpreadsheetInfo("devchallenge-yy")
+	assert.Equal(t, ERROR_NO_SPREADSHEET, err)
+
+	infos, err = dao.ListSpreadsheets("devchallenge", "", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"devchallenge-xx", "devchallenge-zz"}, ids(infos))
+}
+
+func testDaoHistory(t *testing.T, dao Dao) {
+	update := func(origin Origin, fn func(batch *Batch)) time.Time {
+		err := dao.Update("devchallenge-xx", func(batch *Batch) error {
+			batch.SetOrigin(origin)
+			fn(batch)
+			return nil
+		})
+		assert.NoError(t, err)
+
+		// Keep versions apart on the clock of coarse backends
+		time.Sleep(10 * time.Millisecond)
+		return time.Now()
+	}
+
+	versions, err := dao.GetCellHistory("devchallenge-xx", "var1")
+	assert.NoError(t, err)
+	assert.Empty(t, versions)
+
+	before := time.Now()
+	first := update(Origin{Author: "alice", RequestId: "r1"}, func(batch *Batch) {
+		batch.SetCell("VAR1", "1")
+		batch.SetCell("var2", "=var1")
+		batch.AddDependatFormula("var2", []string{"var1"})
+	})
+	second := update(Origin{Author: "bob", RequestId: "r2"}, func(batch *Batch) {
+		batch.SetCell("var1", "2")
+	})
+	update(Origin{Author: "alice", RequestId: "r3"}, func(batch *Batch) {
+		batch.DeleteCell("var2")
+	})
+
+	versions, err = dao.GetCellHistory("DevChallenge-XX", "Var1")
+	assert.NoError(t, err)
+	if assert.Len(t, versions, 2) {
+		assert.Equal(t, 1, versions[0].Version)
+		assert.Equal(t, "1", versions[0].Value)
+		assert.Equal(t, "alice", versions[0].Author)
+		assert.Equal(t, "r1", versions[0].RequestId)
+		assert.Equal(t, 2, versions[1].Version)
+		assert.Equal(t, "2", versions[1].Value)
+		assert.Equal(t, "bob", versions[1].Author)
+		assert.False(t, versions[1].Timestamp.Before(versions[0].Timestamp))
+	}
+
+	versions, err = dao.GetCellHistory("devchallenge-xx", "var2")
+	assert.NoError(t, err)
+	if assert.Len(t, versions, 2) {
+		assert.False(t, versions[0].Deleted)
+		assert.True(t, versions[1].Deleted)
+		assert.Equal(t, "r3", versions[1].RequestId)
+	}
+
+	cells, err := dao.GetCellsAt("devchallenge-xx", before.Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Empty(t, cells)
+
+	cells, err = dao.GetCellsAt("devchallenge-xx", first)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"var1": "1", "var2": "=var1"}, cells)
+
+	cells, err = dao.GetCellsAt("DevChallenge-XX", second)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"var1": "2", "var2": "=var1"}, cells)
+
+	cells, err = dao.GetCellsAt("devchallenge-xx", time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"var1": "2"}, cells)
+
+	assert.NoError(t, dao.DeleteSpreadsheet("devchallenge-xx"))
+
+	versions, err = dao.GetCellHistory("devchallenge-xx", "var1")
+	assert.NoError(t, err)
+	assert.Empty(t, versions)
+}
+
+func testDaoEdits(t *testing.T, dao Dao) {
+	update := func(fn func(batch *Batch)) {
+		err := dao.Update("devchallenge-xx", func(batch *Batch) error {
+			fn(batch)
+			return nil
+		})
+		assert.NoError(t, err)
+	}
+
+	_, err := dao.GetEdit("devchallenge-xx", UndoStack)
+	assert.Equal(t, ERROR_NO_EDIT, err)
+
+	update(func(batch *Batch) {
+		batch.SetOrigin(Origin{RequestId: "r1"})
+		batch.SetCell("var1", "1")
+	})
+	update(func(batch *Batch) {
+		batch.SetOrigin(Origin{RequestId: "r2"})
+		batch.SetCell("VAR1", "2")
+		batch.SetCell("var2", "=var1")
+		batch.AddDependatFormula("var2", []string{"var1"})
+	})
+	// Changes without cell writes are not edits
+	update(func(batch *Batch) {
+		batch.SetTitle("Budget")
+	})
+
+	edit, err := dao.GetEdit("DevChallenge-XX", UndoStack)
+	assert.NoError(t, err)
+	assert.Equal(t, Edit{
+		RequestId: "r2",
+		Cells: []EditCell{
+			{CellId: "var1", Value: "1"},
+			{CellId: "var2", Deleted: true},
+		},
+	}, edit)
+
+	_, err = dao.GetEdit("devchallenge-xx", RedoStack)
+	assert.Equal(t, ERROR_NO_EDIT, err)
+
+	// Undo moves the edit reverting the undo to the redo stack
+	update(func(batch *Batch) {
+		batch.SetOrigin(Origin{RequestId: "r3"})
+		batch.ApplyEdit(UndoStack)
+		batch.SetCell("var1", "1")
+		batch.DeleteCell("var2")
+	})
+
+	edit, err = dao.GetEdit("devchallenge-xx", UndoStack)
+	assert.NoError(t, err)
+	assert.Equal(t, Edit{RequestId: "r1", Cells: []EditCell{{CellId: "var1", Deleted: true}}}, edit)
+
+	edit, err = dao.GetEdit("devchallenge-xx", RedoStack)
+	assert.NoError(t, err)
+	assert.Equal(t, Edit{
+		RequestId: "r3",
+		Cells: []EditCell{
+			{CellId: "var1", Value: "2"},
+			{CellId: "var2", Value: "=var1"},
+		},
+	}, edit)
+
+	update(func(batch *Batch) {
+		batch.ApplyEdit(RedoStack)
+		batch.SetCell("var1", "2")
+		batch.SetCell("var2", "=var1")
+	})
+
+	_, err = dao.GetEdit("devchallenge-xx", RedoStack)
+	assert.Equal(t, ERROR_NO_EDIT, err)
+
+	edit, err = dao.GetEdit("devchallenge-xx", UndoStack)
+	assert.NoError(t, err)
+	assert.Equal(t, []EditCell{{CellId: "var1", Value: "1"}, {CellId: "var2", Deleted: true}}, edit.Cells)
+
+	// A new change clears the redo stack
+	update(func(batch *Batch) {
+		batch.ApplyEdit(UndoStack)
+		batch.SetCell("var1", "1")
+		batch.DeleteCell("var2")
+	})
+	update(func(batch *Batch) {
+		batch.SetCell("var3", "3")
+	})
+
+	_, err = dao.GetEdit("devchallenge-xx", RedoStack)
+	assert.Equal(t, ERROR_NO_EDIT, err)
+
+	// Only the latest edits are kept
+	for i := 0; i < maxUndoEdits+5; i++ {
+		update(func(batch *Batch) {
+			batch.SetOrigin(Origin{RequestId: fmt.Sprint(i)})
+			batch.SetCell("var4", fmt.Sprint(i))
+		})
+	}
+	for i := maxUndoEdits + 4; i >= 5; i-- {
+		edit, err = dao.GetEdit("devchallenge-xx", UndoStack)
+		if !assert.NoError(t, err) || !assert.Equal(t, fmt.Sprint(i), edit.RequestId) {
+			break
+		}
+		update(func(batch *Batch) {
+			batch.ApplyEdit(UndoStack)
+			batch.SetCell("var4", "0")
+		})
+	}
+	_, err = dao.GetEdit("devchallenge-xx", UndoStack)
+	assert.Equal(t, ERROR_NO_EDIT, err)
+
+	assert.NoError(t, dao.DeleteSpreadsheet("devchallenge-xx"))
+
+	_, err = dao.GetEdit("devchallenge-xx", RedoStack)
+	assert.Equal(t, ERROR_NO_EDIT, err)
+}
+
+func testDaoSnapshots(t *testing.T, dao Dao) {
+	snapshots, err := dao.ListSnapshots("devchallenge-xx")
+	assert.NoError(t, err)
+	assert.Empty(t, snapshots)
+
+	createdAt := time.Now().UTC().Truncate(time.Millisecond)
+	assert.NoError(t, dao.CreateSnapshot("DevChallenge-XX", Snapshot{
+		Name:      "Month-End",
+		Author:    "alice",
+		CreatedAt: createdAt,
+		Cells:     map[string]string{"var1": "1", "var2": "=var1"},
+	}))
+	assert.NoError(t, dao.CreateSnapshot("devchallenge-xx", Snapshot{
+		Name:      "later",
+		CreatedAt: createdAt.Add(time.Second),
+		Cells:     map[string]string{},
+	}))
+	assert.NoError(t, dao.CreateSnapshot("devchallenge-yy", Snapshot{
+		Name:      "month-end",
+		CreatedAt: createdAt,
+		Cells:     map[string]string{},
+	}))
+
+	err = dao.CreateSnapshot("devchallenge-xx", Snapshot{Name: "month-end", CreatedAt: createdAt})
+	assert.Equal(t, ERROR_SNAPSHOT_EXISTS, err)
+
+	snapshot, err := dao.GetSnapshot("devchallenge-xx", "MONTH-END")
+	assert.NoError(t, err)
+	assert.Equal(t, "month-end", snapshot.Name)
+	assert.Equal(t, "alice", snapshot.Author)
+	assert.True(t, createdAt.Equal(snapshot.CreatedAt))
+	assert.Equal(t, map[string]string{"var1": "1", "var2": "=var1"}, snapshot.Cells)
+
+	_, err = dao.GetSnapshot("devchallenge-xx", "missing")
+	assert.Equal(t, ERROR_NO_SNAPSHOT, err)
+
+	snapshots, err = dao.ListSnapshots("devchallenge-xx")
+	assert.NoError(t, err)
+	if assert.Len(t, snapshots, 2) {
+		assert.Equal(t, "month-end", snapshots[0].Name)
+		assert.Equal(t, "later", snapshots[1].Name)
+	}
+
+	assert.NoError(t, dao.DeleteSpreadsheet("devchallenge-xx"))
+
+	_, err = dao.GetSnapshot("devchallenge-xx", "month-end")
+	assert.Equal(t, ERROR_NO_SNAPSHOT, err)
+
+	_, err = dao.GetSnapshot("devchallenge-yy", "month-end")
+	assert.NoError(t, err)
+}
+
+func testDaoIterativeCalculation(t *testing.T, dao Dao) {
+	iteration, err := dao.GetIterativeCalculation("devchallenge-xx")
+	assert.NoError(t, err)
+	assert.Equal(t, IterativeCalculation{}, iteration)
+
+	err = dao.Update("devchallenge-xx", func(batch *Batch) error {
+		batch.SetCell("var1", "1")
+		return nil
+	})
+	assert.NoError(t, err)
+
+	iteration, err = dao.GetIterativeCalculation("devchallenge-xx")
+	assert.NoError(t, err)
+	assert.Equal(t, IterativeCalculation{}, iteration)
+
+	enabled := IterativeCalculation{Enabled: true, MaxIterations: 50, Epsilon: 0.01}
+	err = dao.Update("DevChallenge-XX", func(batch *Batch) error {
+		batch.SetIterativeCalculation(enabled)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	// Kept by the changes not setting it
+	err = dao.Update("devchallenge-xx", func(batch *Batch) error {
+		batch.SetTitle("Loan")
+		return nil
+	})
+	assert.NoError(t, err)
+
+	iteration, err = dao.GetIterativeCalculation("devchallenge-xx")
+	assert.NoError(t, err)
+	assert.Equal(t, enabled, iteration)
+
+	info, err := dao.GetSpreadsheetInfo("devchallenge-xx")
+	assert.NoError(t, err)
+	assert.Equal(t, enabled, info.IterativeCalculation)
+
+	infos, err := dao.ListSpreadsheets("", "", 10)
+	assert.NoError(t, err)
+	if assert.Len(t, infos, 1) {
+		assert.Equal(t, enabled, infos[0].IterativeCalculation)
+	}
+}
+
+func testDaoResults(t *testing.T, dao Dao) {
+	_, err := dao.GetResult("devchallenge-xx", "var1")
+	assert.Equal(t, ERROR_NO_RESULT, err)
+
+	results, err := dao.GetAllResults("devchallenge-xx")
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+
+	err = dao.Update("devchallenge-xx", func(batch *Batch) error {
+		batch.SetCell("var1", "1")
+		batch.SetCell("var2", "=var1 / 0")
+		batch.SetResult("VAR1", Result{Value: "1", Result: "1"})
+		batch.SetResult("var2", Result{Value: "=var1 / 0", Result: "ERROR", Error: "division by zero"})
+		return nil
+	})
+	assert.NoError(t, err)
+
+	result, err := dao.GetResult("DevChallenge-XX", "Var2")
+	assert.NoError(t, err)
+	assert.Equal(t, Result{Value: "=var1 / 0", Result: "ERROR", Error: "division by zero"}, result)
+
+	results, err = dao.GetResults("devchallenge-xx", []string{"VAR2", "var3"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]Result{"var2": {Value: "=var1 / 0", Result: "ERROR", Error: "division by zero"}}, results)
+
+	err = dao.Update("devchallenge-xx", func(batch *Batch) error {
+		batch.DeleteCell("var2")
+		batch.DeleteResult("var2")
+		batch.SetResult("var1", Result{Value: "1", Result: "1"})
+		return nil
+	})
+	assert.NoError(t, err)
+
+	results, err = dao.GetAllResults("devchallenge-xx")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]Result{"var1": {Value: "1", Result: "1"}}, results)
+
+	assert.NoError(t, dao.DeleteSpreadsheet("devchallenge-xx"))
+
+	_, err = dao.GetResult("devchallenge-xx", "var1")
+	assert.Equal(t, ERROR_NO_RESULT, err)
+}
+
+func testDaoSpreadsheetState(t *testing.T, dao Dao) {
+	state, err := dao.GetSpreadsheetState("devchallenge-xx")
+	assert.NoError(t, err)
+	assert.Empty(t, state.Cells)
+
+	iteration := IterativeCalculation{Enabled: true, MaxIterations: 10}
+	err = dao.Update("devchallenge-xx", func(batch *Batch) error {
+		batch.SetCell("var1", "1")
+		batch.SetCell("var2", "=var1 + 1")
+		batch.SetResult("var1", Result{Value: "1", Result: "1"})
+		batch.SetIterativeCalculation(iteration)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	state, err = dao.GetSpreadsheetState("DevChallenge-XX")
+	assert.NoError(t, err)
+	assert.Equal(t, SpreadsheetState{
+		Cells:                map[string]string{"var1": "1", "var2": "=var1 + 1"},
+		Results:              map[string]Result{"var1": {Value: "1", Result: "1"}},
+		IterativeCalculation: iteration,
+	}, state)
+
+	assert.NoError(t, dao.DeleteSpreadsheet("devchallenge-xx"))
+
+	state, err = dao.GetSpreadsheetState("devchallenge-xx")
+	assert.NoError(t, err)
+	assert.Empty(t, state.Cells)
+	assert.Empty(t, state.Results)
+}
+
+func testDaoCellEvents(t *testing.T, dao Dao) {
+	publish := func(spreadsheetId string, changes ...CellChange) []CellChange {
+		err := dao.Update(spreadsheetId, func(batch *Batch) error {
+			batch.PublishCellChanges(changes)
+			return nil
+		})
+		assert.NoError(t, err)
+		return changes
+	}
+
+	events, err := dao.GetCellEvents("devchallenge-xx", "var1")
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+
+	subscriber, err := dao.SubscribeSpreadsheet("devchallenge-xx")
+	assert.NoError(t, err)
+	defer subscriber.Close()
+
+	events = publish("devchallenge-xx",
+		CellChange{CellId: "VAR1", New: &Result{Value: "1", Result: "1"}},
+		CellChange{CellId: "var2", New: &Result{Value: "=var1", Result: "1"}},
+	)
+	assert.Len(t, events, 2)
+	assert.Less(t, events[0].EventId, events[1].EventId)
+
+	// Subscribers receive the changes with their event ids
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	msg, err := subscriber.ReceiveMessage(ctx)
+	assert.NoError(t, err)
+	assert.JSONEq(t, fmt.Sprintf(`{"eventId": %d, "cellId": "var1", "new": {"value": "1", "result": "1"}}`, events[0].EventId), msg)
+
+	for i := 2; i <= MaxCellEvents+1; i++ {
+		publish("DevChallenge-XX",
+			CellChange{CellId: "var1", Old: &Result{Value: "1", Result: "1"}, New: &Result{Value: "2", Result: "2"}},
+		)
+	}
+
+	// The oldest change of var1 is trimmed
+	events, err = dao.GetCellEvents("devchallenge-xx", "Var1")
+	assert.NoError(t, err)
+	assert.Len(t, events, MaxCellEvents)
+	assert.Equal(t, "var1", events[0].CellId)
+	assert.Equal(t, &Result{Value: "2", Result: "2"}, events[0].New)
+	for i := 1; i < len(events); i++ {
+		assert.Less(t, events[i-1].EventId, events[i].EventId)
+	}
+
+	events, err = dao.GetCellEvents("devchallenge-xx", "var2")
+	assert.NoError(t, err)
+	assert.Equal(t, []CellChange{{EventId: events[0].EventId, CellId: "var2", New: &Result{Value: "=var1", Result: "1"}}}, events)
+
+	assert.NoError(t, dao.DeleteSpreadsheet("devchallenge-xx"))
+
+	events, err = dao.GetCellEvents("devchallenge-xx", "var1")
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+
+	// Concurrent updates log and publish the changes in the id order
+	concurrent, err := dao.SubscribeSpreadsheet("devchallenge-zz")
+	assert.NoError(t, err)
+	defer concurrent.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 3; j++ {
+				publish("devchallenge-zz", CellChange{CellId: "var1"}, CellChange{CellId: "var1"})
+			}
+		}()
+	}
+	wg.Wait()
+
+	events, err = dao.GetCellEvents("devchallenge-zz", "var1")
+	assert.NoError(t, err)
+	assert.Len(t, events, 48)
+	for i := 1; i < len(events); i++ {
+		assert.Equal(t, events[i-1].EventId+1, events[i].EventId)
+	}
+
+	for _, event := range events {
+		msg, err := concurrent.ReceiveMessage(ctx)
+		if !assert.NoError(t, err) {
+			break
+		}
+
+		var published CellChange
+		assert.NoError(t, json.Unmarshal([]byte(msg), &published))
+		assert.Equal(t, event.EventId, published.EventId)
+	}
+}
+
+func testDaoWebhooks(t *testing.T, dao Dao) {
+	_, err := dao.CreateSubscription("devchallenge-xx", "var1")
+	assert.NoError(t, err)
+	subId, err := dao.CreateWebhook("DevChallenge-XX", "Var1", "http://localhost/hook", "secret")
+	assert.NoError(t, err)
+	_, err = dao.CreateWebhook("devchallenge-xx", "var2", "http://localhost/other", "other")
+	assert.NoError(t, err)
+	_, err = dao.CreateWebhook("devchallenge-yy", "var1", "http://localhost/other", "other")
+	assert.NoError(t, err)
+
+	data, err := dao.GetSubscription(subId)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"spreadsheetId": "devchallenge-xx",
+		"cellId":        "var1",
+		"callbackUrl":   "http://localhost/hook",
+		"secret":        "secret",
+	}, data)
+
+	webhooks, err := dao.GetWebhooks("devchallenge-xx", []string{"VAR1", "var3"})
+	assert.NoError(t, err)
+	assert.Equal(t, []Webhook{{
+		SubscriptionId: subId,
+		SpreadsheetId:  "devchallenge-xx",
+		CellId:         "var1",
+		Url:            "http://localhost/hook",
+		Secret:         "secret",
+	}}, webhooks)
+
+	deliveries, err := dao.GetDeliveries(subId)
+	assert.NoError(t, err)
+	assert.Empty(t, deliveries)
+
+	createdAt := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	delivery, err := dao.SaveDelivery(Delivery{
+		SubscriptionId: subId,
+		SpreadsheetId:  "devchallenge-xx",
+		CellId:         "var1",
+		EventId:        1,
+		Status:         DeliveryPending,
+		Payload:        json.RawMessage(`{"cell_id":"var1"}`),
+		CreatedAt:      createdAt,
+		UpdatedAt:      createdAt,
+	})
+	assert.NoError(t, err)
+	assert.NotZero(t, delivery.Id)
+
+	pending, err := dao.GetPendingDeliveries()
+	assert.NoError(t, err)
+	if assert.Len(t, pending, 1) {
+		assert.Equal(t, delivery.Id, pending[0].Id)
+		assert.Equal(t, subId, pending[0].SubscriptionId)
+	}
+
+	// Saving again updates the delivery
+	delivery.Status = DeliveryFailed
+	delivery.Attempts = 3
+	delivery.Error = "connection refused"
+	_, err = dao.SaveDelivery(delivery)
+	assert.NoError(t, err)
+
+	deliveries, err = dao.GetDeliveries(subId)
+	assert.NoError(t, err)
+	assert.Len(t, deliveries, 1)
+	assert.Equal(t, delivery.Id, deliveries[0].Id)
+	assert.Equal(t, DeliveryFailed, deliveries[0].Status)
+	assert.Equal(t, 3, deliveries[0].Attempts)
+	assert.JSONEq(t, `{"cell_id":"var1"}`, string(deliveries[0].Payload))
+	assert.True(t, createdAt.Equal(deliveries[0].CreatedAt))
+
+	pending, err = dao.GetPendingDeliveries()
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+
+	// The oldest delivery is dropped
+	for i := 0; i < MaxDeliveries; i++ {
+		_, err := dao.SaveDelivery(Delivery{SubscriptionId: subId, SpreadsheetId: "devchallenge-xx", CellId: "var1", Status: DeliveryDelivered, Payload: json.RawMessage(`{}`)})
+		assert.NoError(t, err)
+	}
+
+	deliveries, err = dao.GetDeliveries(subId)
+	assert.NoError(t, err)
+	assert.Len(t, deliveries, MaxDeliveries)
+	assert.Less(t, delivery.Id, deliveries[0].Id)
+	for i := 1; i < len(deliveries); i++ {
+		assert.Less(t, deliveries[i-1].Id, deliveries[i].Id)
+	}
+
+	_, err = dao.SaveDelivery(Delivery{SubscriptionId: subId, SpreadsheetId: "devchallenge-xx", CellId: "var1", Status: DeliveryPending, Payload: json.RawMessage(`{}`)})
+	assert.NoError(t, err)
+
+	assert.NoError(t, dao.DeleteSpreadsheet("devchallenge-xx"))
+
+	// Pending deliveries are removed with their subscriptions
+	pending, err = dao.GetPendingDeliveries()
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+
+	webhooks, err = dao.GetWebhooks("devchallenge-xx", []string{"var1"})
+	assert.NoError(t, err)
+	assert.Empty(t, webhooks)
+
+	deliveries, err = dao.GetDeliveries(subId)
+	assert.NoError(t, err)
+	assert.Empty(t, deliveries)
+}
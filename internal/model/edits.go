@@ -0,0 +1,87 @@
+package model
+
+import "errors"
+
+// Number of edits of a spreadsheet kept to be undone, older ones are dropped.
+const maxUndoEdits = 100
+
+var ERROR_NO_EDIT = errors.New("No edit to undo or redo")
+
+type EditStack int
+
+const (
+	UndoStack EditStack = iota
+	RedoStack
+)
+
+func (s EditStack) String() string {
+	if s == RedoStack {
+		return "redo"
+	}
+	return "undo"
+}
+
+// Edit reverts a change of spreadsheet cells, it holds the values the cells
+// had before the change.
+type Edit struct {
+	RequestId string     `json:"requestId,omitempty"`
+	Cells     []EditCell `json:"cells"`
+}
+
+// EditCell is a value restored by an Edit, a cell which was missing before
+// the change is deleted.
+type EditCell struct {
+	CellId  string `json:"cellId"`
+	Value   string `json:"value,omitempty"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// ApplyEdit marks the batch as applying the top edit of the stack, the edit
+// is moved to the opposite stack reverting the batch. Every other batch writing
+// cells is pushed to the undo stack and clears the redo one.
+func (b *Batch) ApplyEdit(stack EditStack) {
+	b.edit = &stack
+}
+
+// editCells returns ids of the cells written by the batch.
+func (b *Batch) editCells() []string {
+	var cellIds []string
+	seen := make(map[string]struct{})
+	for _, op := range b.ops {
+		if op.kind != batchSetCell && op.kind != batchDeleteCell {
+			continue
+		}
+		if _, exists := seen[op.cellId]; !exists {
+			seen[op.cellId] = struct{}{}
+			cellIds = append(cellIds, op.cellId)
+		}
+	}
+
+	return cellIds
+}
+
+// revertEdit returns the edit reverting the batch given the values of its
+// cells before the batch is applied, missing cells are absent in values.
+func (b *Batch) revertEdit(values map[string]string) Edit {
+	edit := Edit{RequestId: b.origin.RequestId}
+	for _, cellId := range b.editCells() {
+		value, exists := values[cellId]
+		edit.Cells = append(edit.Cells, EditCell{CellId: cellId, Value: value, Deleted: !exists})
+	}
+
+	return edit
+}
+
+// editStacks returns the stack the edit reverting the batch is pushed to and
+// the stack its top edit is popped from, nil when nothing is popped. The redo
+// stack is cleared by the ordinary changes only.
+func (b *Batch) editStacks() (push EditStack, pop *EditStack, clearRedo bool) {
+	if b.edit == nil {
+		return UndoStack, nil, true
+	}
+
+	if *b.edit == UndoStack {
+		return RedoStack, b.edit, false
+	}
+	return UndoStack, b.edit, false
+}
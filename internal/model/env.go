@@ -0,0 +1,84 @@
+package model
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// NewDaoFromEnv selects the storage backend from the environment: BOLT_PATH
+// for the embedded file, POSTGRES_DSN for Postgres, Redis at REDIS_ADDR
+// otherwise. The returned function releases the backend.
+func NewDaoFromEnv() (Dao, func(), error) {
+	var boltPath = os.Getenv("BOLT_PATH")
+	var postgresDsn = os.Getenv("POSTGRES_DSN")
+
+	switch {
+	case boltPath != "":
+		dao, err := NewBoltDao(boltPath)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		log.Printf("Using embedded storage %q", boltPath)
+		return dao, func() { dao.Close() }, nil
+	case postgresDsn != "":
+		dao, err := NewPostgresDao(postgresDsn)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		log.Print("Using Postgres storage")
+		return dao, dao.Close, nil
+	}
+
+	dao, closeDao := NewRedisDaoFromEnv()
+	return dao, closeDao, nil
+}
+
+// NewRedisDaoFromEnv connects to Redis configured by RedisOptionsFromEnv, keys
+// are prefixed with REDIS_KEY_PREFIX or DefaultRedisKeyPrefix when it is not
+// set.
+func NewRedisDaoFromEnv() (*RedisDao, func()) {
+	var prefix = os.Getenv("REDIS_KEY_PREFIX")
+	if prefix == "" {
+		prefix = DefaultRedisKeyPrefix
+	}
+
+	rdb := NewRedisClient(RedisOptionsFromEnv())
+	return NewRedisDaoWithPrefix(rdb, prefix), func() { rdb.Close() }
+}
+
+// RedisOptionsFromEnv reads the comma separated REDIS_ADDR list, Sentinel is
+// used when REDIS_MASTER_NAME is set and Redis Cluster when REDIS_CLUSTER is
+// true or several addresses are given. REDIS_PASSWORD and
+// REDIS_SENTINEL_PASSWORD are optional.
+func RedisOptionsFromEnv() (opts *redis.UniversalOptions, cluster bool) {
+	opts = &redis.UniversalOptions{
+		Addrs:            strings.Split(os.Getenv("REDIS_ADDR"), ","),
+		MasterName:       os.Getenv("REDIS_MASTER_NAME"),
+		Password:         os.Getenv("REDIS_PASSWORD"),
+		SentinelPassword: os.Getenv("REDIS_SENTINEL_PASSWORD"),
+	}
+
+	cluster, _ = strconv.ParseBool(os.Getenv("REDIS_CLUSTER"))
+	return opts, cluster
+}
+
+// NewRedisClient creates the client selected by the options. A cluster could
+// be reached through a single seed address, so it can be forced.
+func NewRedisClient(opts *redis.UniversalOptions, cluster bool) redis.UniversalClient {
+	switch {
+	case opts.MasterName != "":
+		log.Printf("Using Redis Sentinel master %q", opts.MasterName)
+		return redis.NewFailoverClient(opts.Failover())
+	case cluster || len(opts.Addrs) > 1:
+		log.Print("Using Redis Cluster")
+		return redis.NewClusterClient(opts.Cluster())
+	}
+
+	return redis.NewClient(opts.Simple())
+}
@@ -0,0 +1,13 @@
+package model
+
+// MaxCellEvents is the number of the latest changes kept in the event log of
+// a cell, subscribers reconnecting later receive the current result instead.
+const MaxCellEvents = 100
+
+// PublishCellChanges logs the changes in the event logs of their cells and
+// notifies the subscribers of the cells within the batch, so the event ids and
+// the notifications follow the order of the updates. The event ids are set on
+// the elements of changes once the batch is applied.
+func (b *Batch) PublishCellChanges(changes []CellChange) {
+	b.events = changes
+}
@@ -0,0 +1,89 @@
+package model
+
+import "time"
+
+// CellVersion is an entry of the cell history, every stored or deleted value
+// is a new version. Versions of a cell are numbered from 1.
+type CellVersion struct {
+	Version   int
+	Value     string
+	Deleted   bool
+	Timestamp time.Time
+	Author    string
+	RequestId string
+}
+
+// historyEntry is the serialized history entry of the key-value backends.
+type historyEntry struct {
+	CellId    string    `json:"cellId"`
+	Value     string    `json:"value"`
+	Deleted   bool      `json:"deleted,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	Author    string    `json:"author,omitempty"`
+	RequestId string    `json:"requestId,omitempty"`
+}
+
+func (e historyEntry) version(version int) CellVersion {
+	return CellVersion{
+		Version:   version,
+		Value:     e.Value,
+		Deleted:   e.Deleted,
+		Timestamp: e.Timestamp,
+		Author:    e.Author,
+		RequestId: e.RequestId,
+	}
+}
+
+// historyEntries returns the history entries of the batch cell writes.
+func (b *Batch) historyEntries(now time.Time) []historyEntry {
+	var entries []historyEntry
+	for _, op := range b.ops {
+		if op.kind != batchSetCell && op.kind != batchDeleteCell {
+			continue
+		}
+
+		entries = append(entries, historyEntry{
+			CellId:    op.cellId,
+			Value:     op.value,
+			Deleted:   op.kind == batchDeleteCell,
+			Timestamp: now,
+			Author:    b.origin.Author,
+			RequestId: b.origin.RequestId,
+		})
+	}
+
+	return entries
+}
+
+// CellsSnapshot is a copy of spreadsheet cells, e.g. as they were at some
+// moment. It serves cell reads of a formula solver instead of the Dao.
+type CellsSnapshot map[string]string
+
+func (s CellsSnapshot) GetCell(_ string, cellId string) (string, error) {
+	value, exists := s[cellId]
+	if !exists {
+		return "", ERROR_NO_CELL
+	}
+
+	return value, nil
+}
+
+func (s CellsSnapshot) GetCells(_ string, cellIds []string) (map[string]string, error) {
+	cells := make(map[string]string, len(cellIds))
+	for _, cellId := range cellIds {
+		if value, exists := s[cellId]; exists {
+			cells[cellId] = value
+		}
+	}
+
+	return cells, nil
+}
+
+func (s CellsSnapshot) GetAllCells(_ string) (map[string]string, error) {
+	cells := make(map[string]string, len(s))
+	for cellId, value := range s {
+		cells[cellId] = value
+	}
+
+	return cells, nil
+}
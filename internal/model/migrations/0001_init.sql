@@ -0,0 +1,23 @@
+CREATE TABLE cells (
+    spreadsheet_id TEXT NOT NULL,
+    cell_id        TEXT NOT NULL,
+    value          TEXT NOT NULL,
+    PRIMARY KEY (spreadsheet_id, cell_id)
+);
+
+-- Reverse dependency index: dependant_id formula references cell_id.
+CREATE TABLE dependencies (
+    spreadsheet_id TEXT NOT NULL,
+    cell_id        TEXT NOT NULL,
+    dependant_id   TEXT NOT NULL,
+    PRIMARY KEY (spreadsheet_id, cell_id, dependant_id)
+);
+
+CREATE TABLE subscriptions (
+    id             BIGSERIAL PRIMARY KEY,
+    spreadsheet_id TEXT NOT NULL,
+    cell_id        TEXT NOT NULL,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX subscriptions_cell_idx ON subscriptions (spreadsheet_id, cell_id);
@@ -0,0 +1,10 @@
+CREATE TABLE spreadsheets (
+    id         TEXT PRIMARY KEY,
+    title      TEXT NOT NULL DEFAULT '',
+    owner      TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Register spreadsheets created before the registry existed.
+INSERT INTO spreadsheets (id) SELECT DISTINCT spreadsheet_id FROM cells;
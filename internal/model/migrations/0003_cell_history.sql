@@ -0,0 +1,14 @@
+-- Every stored or deleted cell value, versions of a cell are numbered from 1.
+CREATE TABLE cell_history (
+    spreadsheet_id TEXT NOT NULL,
+    cell_id        TEXT NOT NULL,
+    version        INTEGER NOT NULL,
+    value          TEXT NOT NULL,
+    deleted        BOOLEAN NOT NULL DEFAULT false,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT now(),
+    author         TEXT NOT NULL DEFAULT '',
+    request_id     TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (spreadsheet_id, cell_id, version)
+);
+
+CREATE INDEX cell_history_created_idx ON cell_history (spreadsheet_id, created_at);
@@ -0,0 +1,9 @@
+-- Undo and redo stacks of spreadsheet edits, the latest edit has the greatest id.
+CREATE TABLE edits (
+    id             BIGSERIAL PRIMARY KEY,
+    spreadsheet_id TEXT NOT NULL,
+    stack          TEXT NOT NULL,
+    edit           JSONB NOT NULL
+);
+
+CREATE INDEX edits_stack_idx ON edits (spreadsheet_id, stack, id);
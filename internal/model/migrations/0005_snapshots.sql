@@ -0,0 +1,8 @@
+CREATE TABLE snapshots (
+    spreadsheet_id TEXT NOT NULL,
+    name           TEXT NOT NULL,
+    author         TEXT NOT NULL DEFAULT '',
+    created_at     TIMESTAMPTZ NOT NULL,
+    cells          JSONB NOT NULL,
+    PRIMARY KEY (spreadsheet_id, name)
+);
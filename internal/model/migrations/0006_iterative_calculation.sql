@@ -0,0 +1 @@
+ALTER TABLE spreadsheets ADD COLUMN iterative_calculation JSONB NOT NULL DEFAULT '{}';
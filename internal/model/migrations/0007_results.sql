@@ -0,0 +1,6 @@
+CREATE TABLE results (
+    spreadsheet_id TEXT NOT NULL,
+    cell_id        TEXT NOT NULL,
+    result         JSONB NOT NULL,
+    PRIMARY KEY (spreadsheet_id, cell_id)
+);
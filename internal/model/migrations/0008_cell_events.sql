@@ -0,0 +1,9 @@
+-- Latest changes of every cell published to the subscribers, ids increase.
+CREATE TABLE cell_events (
+    id             BIGSERIAL PRIMARY KEY,
+    spreadsheet_id TEXT NOT NULL,
+    cell_id        TEXT NOT NULL,
+    change         JSONB NOT NULL
+);
+
+CREATE INDEX cell_events_cell_idx ON cell_events (spreadsheet_id, cell_id, id);
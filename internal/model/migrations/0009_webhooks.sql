@@ -0,0 +1,15 @@
+-- Subscriptions delivered to a callback url, requests are signed with the
+-- secret.
+ALTER TABLE subscriptions ADD COLUMN callback_url TEXT, ADD COLUMN secret TEXT;
+
+CREATE INDEX subscriptions_webhooks_idx ON subscriptions (spreadsheet_id, cell_id) WHERE callback_url IS NOT NULL;
+
+-- Latest webhook deliveries of every subscription, ids increase.
+CREATE TABLE webhook_deliveries (
+    id              BIGSERIAL PRIMARY KEY,
+    subscription_id BIGINT NOT NULL,
+    spreadsheet_id  TEXT NOT NULL,
+    delivery        JSONB NOT NULL
+);
+
+CREATE INDEX webhook_deliveries_subscription_idx ON webhook_deliveries (subscription_id, id);
@@ -0,0 +1,2 @@
+-- Pending webhook deliveries are resumed on startup.
+CREATE INDEX webhook_deliveries_pending_idx ON webhook_deliveries (subscription_id, id) WHERE delivery->>'status' = 'pending';
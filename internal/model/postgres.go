@@ -0,0 +1,1112 @@
+package model
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed migrations/*.sql
+var postgresMigrations embed.FS
+
+// Channel used by NOTIFY, cell ids are sent in the payload as channel names
+// are limited to 63 bytes.
+const postgresNotifyChannel = "cell_changes"
+
+const postgresListenRetryDelay = 1 * time.Second
+
+// PostgresDao stores spreadsheets in relational tables, cell change
+// notifications are delivered with LISTEN/NOTIFY.
+type PostgresDao struct {
+	pool   *pgxpool.Pool
+	pubsub *localPubSub
+
+	listenOnce   sync.Once
+	listenCtx    context.Context
+	listenCancel context.CancelFunc
+}
+
+// postgresQuerier is implemented by both the pool and a transaction.
+type postgresQuerier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+}
+
+// postgresNotification is the payload of pg_notify, it is limited to
+// postgresNotifyPayloadLimit bytes.
+type postgresNotification struct {
+	SpreadsheetId string `json:"spreadsheetId"`
+	CellChange
+}
+
+const postgresNotifyPayloadLimit = 7999
+
+func NewPostgresDao(dsn string) (*PostgresDao, error) {
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	if err := MigratePostgres(pool); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	listenCtx, listenCancel := context.WithCancel(ctx)
+
+	return &PostgresDao{
+		pool:         pool,
+		pubsub:       newLocalPubSub(),
+		listenCtx:    listenCtx,
+		listenCancel: listenCancel,
+	}, nil
+}
+
+func (dao *PostgresDao) Close() {
+	dao.listenCancel()
+	dao.pool.Close()
+}
+
+// MigratePostgres applies pending migrations in order, each one in its own
+// transaction. Concurrent service instances are serialized by an advisory lock.
+func MigratePostgres(pool *pgxpool.Pool) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock(hashtext('schema_migrations'))"); err != nil {
+		return err
+	}
+	defer conn.Exec(ctx, "SELECT pg_advisory_unlock(hashtext('schema_migrations'))")
+
+	if _, err := conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    TEXT PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`); err != nil {
+		return err
+	}
+
+	names, err := fs.Glob(postgresMigrations, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		version := strings.TrimSuffix(strings.TrimPrefix(name, "migrations/"), ".sql")
+
+		var applied bool
+		if err := conn.QueryRow(ctx,
+			"SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)",
+			version).Scan(&applied); err != nil {
+			return err
+		}
+		if applied {
+			continue
+		}
+
+		sql, err := postgresMigrations.ReadFile(name)
+		if err != nil {
+			return err
+		}
+
+		err = pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, string(sql)); err != nil {
+				return err
+			}
+			_, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", version)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		log.Printf("Applied migration %s", version)
+	}
+
+	return nil
+}
+
+func (dao *PostgresDao) IsSpreadsheetExists(spreadsheetId string) (bool, error) {
+	var exists bool
+	err := dao.pool.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM cells WHERE spreadsheet_id = $1)",
+		strings.ToLower(spreadsheetId)).Scan(&exists)
+
+	return exists, err
+}
+
+func (dao *PostgresDao) GetSpreadeetKeys(spreadsheetId string) ([]string, error) {
+	rows, _ := dao.pool.Query(ctx,
+		"SELECT cell_id FROM cells WHERE spreadsheet_id = $1",
+		strings.ToLower(spreadsheetId))
+
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+func (dao *PostgresDao) SetCell(spreadsheetId string, cellId string, value string) error {
+	return postgresSetCell(dao.pool, spreadsheetId, cellId, value)
+}
+
+func postgresSetCell(db postgresQuerier, spreadsheetId string, cellId string, value string) error {
+	_, err := db.Exec(ctx,
+		`INSERT INTO cells (spreadsheet_id, cell_id, value) VALUES ($1, $2, $3)
+		ON CONFLICT (spreadsheet_id, cell_id) DO UPDATE SET value = EXCLUDED.value`,
+		strings.ToLower(spreadsheetId), strings.ToLower(cellId), value)
+
+	return err
+}
+
+func postgresDeleteCell(db postgresQuerier, spreadsheetId string, cellId string) error {
+	_, err := db.Exec(ctx,
+		"DELETE FROM cells WHERE spreadsheet_id = $1 AND cell_id = $2",
+		strings.ToLower(spreadsheetId), strings.ToLower(cellId))
+
+	return err
+}
+
+func (dao *PostgresDao) GetCell(spreadsheetId string, cellId string) (string, error) {
+	var value string
+	err := dao.pool.QueryRow(ctx,
+		"SELECT value FROM cells WHERE spreadsheet_id = $1 AND cell_id = $2",
+		strings.ToLower(spreadsheetId), strings.ToLower(cellId)).Scan(&value)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ERROR_NO_CELL
+	}
+
+	return value, err
+}
+
+func (dao *PostgresDao) GetAllCells(spreadsheetId string) (map[string]string, error) {
+	rows, err := dao.pool.Query(ctx,
+		"SELECT cell_id, value FROM cells WHERE spreadsheet_id = $1",
+		strings.ToLower(spreadsheetId))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cells := make(map[string]string)
+	for rows.Next() {
+		var cellId, value string
+		if err := rows.Scan(&cellId, &value); err != nil {
+			return nil, err
+		}
+		cells[cellId] = value
+	}
+
+	return cells, rows.Err()
+}
+
+func (dao *PostgresDao) GetCells(spreadsheetId string, cellIds []string) (map[string]string, error) {
+	ids := make([]string, len(cellIds))
+	for i, cellId := range cellIds {
+		ids[i] = strings.ToLower(cellId)
+	}
+
+	rows, err := dao.pool.Query(ctx,
+		"SELECT cell_id, value FROM cells WHERE spreadsheet_id = $1 AND cell_id = ANY($2)",
+		strings.ToLower(spreadsheetId), ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cells := make(map[string]string, len(ids))
+	for rows.Next() {
+		var cellId, value string
+		if err := rows.Scan(&cellId, &value); err != nil {
+			return nil, err
+		}
+		cells[cellId] = value
+	}
+
+	return cells, rows.Err()
+}
+
+func (dao *PostgresDao) GetResult(spreadsheetId string, cellId string) (Result, error) {
+	var result Result
+	err := dao.pool.QueryRow(ctx,
+		"SELECT result FROM results WHERE spreadsheet_id = $1 AND cell_id = $2",
+		strings.ToLower(spreadsheetId), strings.ToLower(cellId)).Scan(&result)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Result{}, ERROR_NO_RESULT
+	}
+
+	return result, err
+}
+
+func (dao *PostgresDao) GetResults(spreadsheetId string, cellIds []string) (map[string]Result, error) {
+	ids := make([]string, len(cellIds))
+	for i, cellId := range cellIds {
+		ids[i] = strings.ToLower(cellId)
+	}
+
+	rows, err := dao.pool.Query(ctx,
+		"SELECT cell_id, result FROM results WHERE spreadsheet_id = $1 AND cell_id = ANY($2)",
+		strings.ToLower(spreadsheetId), ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make(map[string]Result, len(ids))
+	for rows.Next() {
+		var cellId string
+		var result Result
+		if err := rows.Scan(&cellId, &result); err != nil {
+			return nil, err
+		}
+		results[cellId] = result
+	}
+
+	return results, rows.Err()
+}
+
+func (dao *PostgresDao) GetAllResults(spreadsheetId string) (map[string]Result, error) {
+	rows, err := dao.pool.Query(ctx,
+		"SELECT cell_id, result FROM results WHERE spreadsheet_id = $1",
+		strings.ToLower(spreadsheetId))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make(map[string]Result)
+	for rows.Next() {
+		var cellId string
+		var result Result
+		if err := rows.Scan(&cellId, &result); err != nil {
+			return nil, err
+		}
+		results[cellId] = result
+	}
+
+	return results, rows.Err()
+}
+
+// GetSpreadsheetState joins the cells with their results and the registry
+// entry in a single statement.
+func (dao *PostgresDao) GetSpreadsheetState(spreadsheetId string) (SpreadsheetState, error) {
+	state := SpreadsheetState{
+		Cells:   make(map[string]string),
+		Results: make(map[string]Result),
+	}
+
+	rows, err := dao.pool.Query(ctx,
+		`SELECT c.cell_id, c.value, r.result, s.iterative_calculation
+			FROM cells c
+			LEFT JOIN results r ON r.spreadsheet_id = c.spreadsheet_id AND r.cell_id = c.cell_id
+			LEFT JOIN spreadsheets s ON s.id = c.spreadsheet_id
+			WHERE c.spreadsheet_id = $1`,
+		strings.ToLower(spreadsheetId))
+	if err != nil {
+		return state, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cellId, value string
+		var result *Result
+		var iteration *IterativeCalculation
+		if err := rows.Scan(&cellId, &value, &result, &iteration); err != nil {
+			return state, err
+		}
+
+		state.Cells[cellId] = value
+		if result != nil {
+			state.Results[cellId] = *result
+		}
+		if iteration != nil {
+			state.IterativeCalculation = *iteration
+		}
+	}
+
+	return state, rows.Err()
+}
+
+func (dao *PostgresDao) GetDependants(spreadsheetId string, cellId string) ([]string, error) {
+	rows, _ := dao.pool.Query(ctx,
+		"SELECT dependant_id FROM dependencies WHERE spreadsheet_id = $1 AND cell_id = $2",
+		strings.ToLower(spreadsheetId), strings.ToLower(cellId))
+
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+func (dao *PostgresDao) GetDependencyIndex(spreadsheetId string) (map[string][]string, error) {
+	rows, err := dao.pool.Query(ctx,
+		"SELECT cell_id, dependant_id FROM dependencies WHERE spreadsheet_id = $1",
+		strings.ToLower(spreadsheetId))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	index := make(map[string][]string)
+	for rows.Next() {
+		var cellId, dependantId string
+		if err := rows.Scan(&cellId, &dependantId); err != nil {
+			return nil, err
+		}
+		index[cellId] = append(index[cellId], dependantId)
+	}
+
+	return index, rows.Err()
+}
+
+// GetDependantsGraph walks the dependencies by a recursive query.
+func (dao *PostgresDao) GetDependantsGraph(spreadsheetId string, cellIds []string) (map[string][]string, error) {
+	ids := make([]string, len(cellIds))
+	for i, cellId := range cellIds {
+		ids[i] = strings.ToLower(cellId)
+	}
+
+	rows, err := dao.pool.Query(ctx, `
+		WITH RECURSIVE affected(cell_id) AS (
+			SELECT unnest($2::text[])
+			UNION
+			SELECT d.dependant_id FROM dependencies d
+			JOIN affected a ON d.cell_id = a.cell_id
+			WHERE d.spreadsheet_id = $1
+		)
+		SELECT d.cell_id, d.dependant_id FROM dependencies d
+		JOIN affected a ON d.cell_id = a.cell_id
+		WHERE d.spreadsheet_id = $1`,
+		strings.ToLower(spreadsheetId), ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	graph := make(map[string][]string)
+	for rows.Next() {
+		var cellId, dependantId string
+		if err := rows.Scan(&cellId, &dependantId); err != nil {
+			return nil, err
+		}
+		graph[cellId] = append(graph[cellId], dependantId)
+	}
+
+	return graph, rows.Err()
+}
+
+func (dao *PostgresDao) AddDependatFormula(spreadsheetId string, cellId string, dependsOn []string) error {
+	return postgresAddDependatFormula(dao.pool, spreadsheetId, cellId, dependsOn)
+}
+
+func postgresAddDependatFormula(db postgresQuerier, spreadsheetId string, cellId string, dependsOn []string) error {
+	cellId = strings.ToLower(cellId)
+	batch := &pgx.Batch{}
+	for _, dependantCellId := range dependsOn {
+		if strings.ToLower(dependantCellId) == cellId {
+			continue
+		}
+
+		batch.Queue(
+			`INSERT INTO dependencies (spreadsheet_id, cell_id, dependant_id) VALUES ($1, $2, $3)
+			ON CONFLICT DO NOTHING`,
+			strings.ToLower(spreadsheetId), strings.ToLower(dependantCellId), cellId)
+	}
+	if batch.Len() == 0 {
+		return nil
+	}
+
+	return db.SendBatch(ctx, batch).Close()
+}
+
+func (dao *PostgresDao) DeleteDependatFormula(spreadsheetId string, cellId string, dependsOn []string) error {
+	return postgresDeleteDependatFormula(dao.pool, spreadsheetId, cellId, dependsOn)
+}
+
+func postgresDeleteDependatFormula(db postgresQuerier, spreadsheetId string, cellId string, dependsOn []string) error {
+	dependsOnLower := make([]string, len(dependsOn))
+	for i := range dependsOn {
+		dependsOnLower[i] = strings.ToLower(dependsOn[i])
+	}
+
+	_, err := db.Exec(ctx,
+		`DELETE FROM dependencies
+		WHERE spreadsheet_id = $1 AND cell_id = ANY($2) AND dependant_id = $3`,
+		strings.ToLower(spreadsheetId), dependsOnLower, strings.ToLower(cellId))
+
+	return err
+}
+
+// Update holds a transaction scoped advisory lock of the spreadsheet while fn
+// validates the change, so concurrent updates of the same spreadsheet are
+// serialized across service instances.
+func (dao *PostgresDao) Update(spreadsheetId string, fn func(batch *Batch) error) error {
+	return pgx.BeginFunc(ctx, dao.pool, func(tx pgx.Tx) error {
+		if err := postgresLockSpreadsheet(tx, spreadsheetId); err != nil {
+			return err
+		}
+
+		batch := &Batch{}
+		if err := fn(batch); err != nil {
+			return err
+		}
+
+		if batch.Empty() {
+			return nil
+		}
+
+		if err := postgresApplyBatch(tx, spreadsheetId, batch); err != nil {
+			return err
+		}
+		return postgresAppendCellEvents(tx, spreadsheetId, batch.events)
+	})
+}
+
+func postgresLockSpreadsheet(tx pgx.Tx, spreadsheetId string) error {
+	_, err := tx.Exec(ctx,
+		"SELECT pg_advisory_xact_lock(hashtext($1))",
+		strings.ToLower(spreadsheetId))
+
+	return err
+}
+
+func postgresApplyBatch(db postgresQuerier, spreadsheetId string, batch *Batch) error {
+	if err := postgresPushEdit(db, spreadsheetId, batch); err != nil {
+		return err
+	}
+
+	for _, op := range batch.ops {
+		var err error
+		switch op.kind {
+		case batchSetCell:
+			err = postgresSetCell(db, spreadsheetId, op.cellId, op.value)
+		case batchDeleteCell:
+			err = postgresDeleteCell(db, spreadsheetId, op.cellId)
+		case batchAddDependants:
+			err = postgresAddDependatFormula(db, spreadsheetId, op.cellId, op.dependsOn)
+		case batchDeleteDependants:
+			err = postgresDeleteDependatFormula(db, spreadsheetId, op.cellId, op.dependsOn)
+		case batchSetResult:
+			_, err = db.Exec(ctx,
+				`INSERT INTO results (spreadsheet_id, cell_id, result) VALUES ($1, $2, $3)
+				ON CONFLICT (spreadsheet_id, cell_id) DO UPDATE SET result = EXCLUDED.result`,
+				strings.ToLower(spreadsheetId), op.cellId, op.value)
+		case batchDeleteResult:
+			_, err = db.Exec(ctx,
+				"DELETE FROM results WHERE spreadsheet_id = $1 AND cell_id = $2",
+				strings.ToLower(spreadsheetId), op.cellId)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := postgresAppendHistory(db, spreadsheetId, batch); err != nil {
+		return err
+	}
+
+	return postgresUpdateRegistry(db, spreadsheetId, batch)
+}
+
+// postgresPushEdit records the edit reverting the batch, it reads the cell
+// values so it is called before the batch is applied.
+func postgresPushEdit(db postgresQuerier, spreadsheetId string, batch *Batch) error {
+	cellIds := batch.editCells()
+	if len(cellIds) == 0 {
+		return nil
+	}
+	spreadsheetId = strings.ToLower(spreadsheetId)
+
+	rows, err := db.Query(ctx,
+		"SELECT cell_id, value FROM cells WHERE spreadsheet_id = $1 AND cell_id = ANY($2)",
+		spreadsheetId, cellIds)
+	if err != nil {
+		return err
+	}
+
+	// The rows are closed before the batch is sent over the same connection.
+	values := make(map[string]string, len(cellIds))
+	var cellId, value string
+	_, err = pgx.ForEachRow(rows, []any{&cellId, &value}, func() error {
+		values[cellId] = value
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	push, pop, clearRedo := batch.editStacks()
+	pgBatch := &pgx.Batch{}
+	if pop != nil {
+		pgBatch.Queue(
+			`DELETE FROM edits WHERE id = (
+				SELECT max(id) FROM edits WHERE spreadsheet_id = $1 AND stack = $2
+			)`,
+			spreadsheetId, pop.String())
+	}
+	if clearRedo {
+		pgBatch.Queue("DELETE FROM edits WHERE spreadsheet_id = $1 AND stack = $2",
+			spreadsheetId, RedoStack.String())
+	}
+	pgBatch.Queue("INSERT INTO edits (spreadsheet_id, stack, edit) VALUES ($1, $2, $3)",
+		spreadsheetId, push.String(), batch.revertEdit(values))
+	pgBatch.Queue(
+		`DELETE FROM edits WHERE spreadsheet_id = $1 AND stack = $2 AND id NOT IN (
+			SELECT id FROM edits WHERE spreadsheet_id = $1 AND stack = $2
+			ORDER BY id DESC LIMIT $3
+		)`,
+		spreadsheetId, push.String(), maxUndoEdits)
+
+	return db.SendBatch(ctx, pgBatch).Close()
+}
+
+func (dao *PostgresDao) GetEdit(spreadsheetId string, stack EditStack) (Edit, error) {
+	var edit Edit
+	err := dao.pool.QueryRow(ctx,
+		`SELECT edit FROM edits WHERE spreadsheet_id = $1 AND stack = $2
+		ORDER BY id DESC LIMIT 1`,
+		strings.ToLower(spreadsheetId), stack.String()).Scan(&edit)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Edit{}, ERROR_NO_EDIT
+	}
+
+	return edit, err
+}
+
+func (dao *PostgresDao) CreateSnapshot(spreadsheetId string, snapshot Snapshot) error {
+	tag, err := dao.pool.Exec(ctx,
+		`INSERT INTO snapshots (spreadsheet_id, name, author, created_at, cells) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT DO NOTHING`,
+		strings.ToLower(spreadsheetId), strings.ToLower(snapshot.Name), snapshot.Author,
+		snapshot.CreatedAt, snapshot.Cells)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ERROR_SNAPSHOT_EXISTS
+	}
+
+	return nil
+}
+
+const postgresSnapshotQuery = "SELECT name, author, created_at, cells FROM snapshots "
+
+func (dao *PostgresDao) ListSnapshots(spreadsheetId string) ([]Snapshot, error) {
+	rows, _ := dao.pool.Query(ctx,
+		postgresSnapshotQuery+`WHERE spreadsheet_id = $1 ORDER BY created_at, name COLLATE "C"`,
+		strings.ToLower(spreadsheetId))
+
+	return pgx.CollectRows(rows, scanSnapshot)
+}
+
+func (dao *PostgresDao) GetSnapshot(spreadsheetId string, name string) (Snapshot, error) {
+	rows, _ := dao.pool.Query(ctx,
+		postgresSnapshotQuery+"WHERE spreadsheet_id = $1 AND name = $2",
+		strings.ToLower(spreadsheetId), strings.ToLower(name))
+
+	snapshot, err := pgx.CollectOneRow(rows, scanSnapshot)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Snapshot{}, ERROR_NO_SNAPSHOT
+	}
+
+	return snapshot, err
+}
+
+func scanSnapshot(row pgx.CollectableRow) (Snapshot, error) {
+	var snapshot Snapshot
+	err := row.Scan(&snapshot.Name, &snapshot.Author, &snapshot.CreatedAt, &snapshot.Cells)
+
+	return snapshot, err
+}
+
+// postgresAppendHistory relies on the spreadsheet lock to number versions,
+// entries are timestamped with the transaction time like the registry.
+func postgresAppendHistory(db postgresQuerier, spreadsheetId string, batch *Batch) error {
+	entries := batch.historyEntries(time.Time{})
+	if len(entries) == 0 {
+		return nil
+	}
+
+	pgBatch := &pgx.Batch{}
+	for _, entry := range entries {
+		pgBatch.Queue(
+			`INSERT INTO cell_history (spreadsheet_id, cell_id, version, value, deleted, author, request_id)
+			SELECT $1, $2, COALESCE(MAX(version), 0) + 1, $3, $4, $5, $6
+			FROM cell_history WHERE spreadsheet_id = $1 AND cell_id = $2`,
+			strings.ToLower(spreadsheetId), entry.CellId, entry.Value, entry.Deleted,
+			entry.Author, entry.RequestId)
+	}
+
+	return db.SendBatch(ctx, pgBatch).Close()
+}
+
+func (dao *PostgresDao) GetCellHistory(spreadsheetId string, cellId string) ([]CellVersion, error) {
+	rows, _ := dao.pool.Query(ctx,
+		`SELECT version, value, deleted, created_at, author, request_id FROM cell_history
+		WHERE spreadsheet_id = $1 AND cell_id = $2 ORDER BY version`,
+		strings.ToLower(spreadsheetId), strings.ToLower(cellId))
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (CellVersion, error) {
+		var version CellVersion
+		err := row.Scan(&version.Version, &version.Value, &version.Deleted,
+			&version.Timestamp, &version.Author, &version.RequestId)
+
+		return version, err
+	})
+}
+
+func (dao *PostgresDao) GetCellsAt(spreadsheetId string, at time.Time) (map[string]string, error) {
+	rows, err := dao.pool.Query(ctx,
+		`SELECT cell_id, value FROM (
+			SELECT DISTINCT ON (cell_id) cell_id, value, deleted FROM cell_history
+			WHERE spreadsheet_id = $1 AND created_at <= $2
+			ORDER BY cell_id, version DESC
+		) latest WHERE NOT deleted`,
+		strings.ToLower(spreadsheetId), at)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cells := make(map[string]string)
+	for rows.Next() {
+		var cellId, value string
+		if err := rows.Scan(&cellId, &value); err != nil {
+			return nil, err
+		}
+		cells[cellId] = value
+	}
+
+	return cells, rows.Err()
+}
+
+func postgresUpdateRegistry(db postgresQuerier, spreadsheetId string, batch *Batch) error {
+	_, err := db.Exec(ctx,
+		`INSERT INTO spreadsheets (id, owner, title, iterative_calculation)
+		VALUES ($1, $2, COALESCE($3::text, ''), COALESCE($4::jsonb, '{}'))
+		ON CONFLICT (id) DO UPDATE SET
+			updated_at = now(),
+			title = COALESCE($3::text, spreadsheets.title),
+			iterative_calculation = COALESCE($4::jsonb, spreadsheets.iterative_calculation)`,
+		strings.ToLower(spreadsheetId), batch.origin.Author, batch.title, batch.iteration)
+
+	return err
+}
+
+// Ids are compared with the "C" collation to be ordered bytewise like in the
+// other backends.
+const postgresSpreadsheetInfoQuery = `SELECT s.id, s.title, s.owner, s.created_at, s.updated_at,
+	s.iterative_calculation, (SELECT count(*) FROM cells c WHERE c.spreadsheet_id = s.id)
+	FROM spreadsheets s `
+
+func (dao *PostgresDao) ListSpreadsheets(prefix string, after string, limit int) ([]SpreadsheetInfo, error) {
+	rows, _ := dao.pool.Query(ctx,
+		postgresSpreadsheetInfoQuery+
+			`WHERE starts_with(s.id, $1) AND s.id COLLATE "C" > $2
+			ORDER BY s.id COLLATE "C" LIMIT $3`,
+		strings.ToLower(prefix), strings.ToLower(after), limit)
+
+	return pgx.CollectRows(rows, scanSpreadsheetInfo)
+}
+
+func (dao *PostgresDao) GetSpreadsheetInfo(spreadsheetId string) (SpreadsheetInfo, error) {
+	rows, _ := dao.pool.Query(ctx,
+		postgresSpreadsheetInfoQuery+"WHERE s.id = $1",
+		strings.ToLower(spreadsheetId))
+
+	info, err := pgx.CollectOneRow(rows, scanSpreadsheetInfo)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return SpreadsheetInfo{}, ERROR_NO_SPREADSHEET
+	}
+
+	return info, err
+}
+
+func (dao *PostgresDao) GetIterativeCalculation(spreadsheetId string) (IterativeCalculation, error) {
+	var iteration IterativeCalculation
+	err := dao.pool.QueryRow(ctx,
+		"SELECT iterative_calculation FROM spreadsheets WHERE id = $1",
+		strings.ToLower(spreadsheetId)).Scan(&iteration)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return iteration, nil
+	}
+
+	return iteration, err
+}
+
+func scanSpreadsheetInfo(row pgx.CollectableRow) (SpreadsheetInfo, error) {
+	var info SpreadsheetInfo
+	err := row.Scan(&info.Id, &info.Title, &info.Owner, &info.CreatedAt, &info.UpdatedAt,
+		&info.IterativeCalculation, &info.CellCount)
+
+	return info, err
+}
+
+func (dao *PostgresDao) DeleteSpreadsheet(spreadsheetId string) error {
+	return pgx.BeginFunc(ctx, dao.pool, func(tx pgx.Tx) error {
+		if err := postgresLockSpreadsheet(tx, spreadsheetId); err != nil {
+			return err
+		}
+
+		for _, table := range []string{"cells", "results", "dependencies", "subscriptions", "cell_history", "edits", "snapshots", "cell_events", "webhook_deliveries"} {
+			if _, err := tx.Exec(ctx,
+				"DELETE FROM "+table+" WHERE spreadsheet_id = $1",
+				strings.ToLower(spreadsheetId)); err != nil {
+				return err
+			}
+		}
+
+		_, err := tx.Exec(ctx, "DELETE FROM spreadsheets WHERE id = $1", strings.ToLower(spreadsheetId))
+		return err
+	})
+}
+
+func (dao *PostgresDao) CreateSubscription(spreadsheetId string, cellId string) (string, error) {
+	var idVal int64
+	err := dao.pool.QueryRow(ctx,
+		"INSERT INTO subscriptions (spreadsheet_id, cell_id) VALUES ($1, $2) RETURNING id",
+		strings.ToLower(spreadsheetId), strings.ToLower(cellId)).Scan(&idVal)
+	if err != nil {
+		return "", err
+	}
+
+	return strconv.FormatInt(idVal, 16), nil
+}
+
+func (dao *PostgresDao) CreateWebhook(spreadsheetId string, cellId string, url string, secret string) (string, error) {
+	var idVal int64
+	err := dao.pool.QueryRow(ctx,
+		"INSERT INTO subscriptions (spreadsheet_id, cell_id, callback_url, secret) VALUES ($1, $2, $3, $4) RETURNING id",
+		strings.ToLower(spreadsheetId), strings.ToLower(cellId), url, secret).Scan(&idVal)
+	if err != nil {
+		return "", err
+	}
+
+	return strconv.FormatInt(idVal, 16), nil
+}
+
+func (dao *PostgresDao) GetSubscription(subId string) (map[string]string, error) {
+	idVal, err := strconv.ParseInt(subId, 16, 64)
+	if err != nil {
+		return nil, ERROR_NO_SUBSCRIPTION
+	}
+
+	var spreadsheetId, cellId string
+	var callbackUrl, secret *string
+	err = dao.pool.QueryRow(ctx,
+		"SELECT spreadsheet_id, cell_id, callback_url, secret FROM subscriptions WHERE id = $1",
+		idVal).Scan(&spreadsheetId, &cellId, &callbackUrl, &secret)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ERROR_NO_SUBSCRIPTION
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string]string{
+		"spreadsheetId": spreadsheetId,
+		"cellId":        cellId,
+	}
+	if callbackUrl != nil {
+		data["callbackUrl"] = *callbackUrl
+		data["secret"] = *secret
+	}
+
+	return data, nil
+}
+
+func (dao *PostgresDao) GetWebhooks(spreadsheetId string, cellIds []string) ([]Webhook, error) {
+	lower := make([]string, len(cellIds))
+	for i, cellId := range cellIds {
+		lower[i] = strings.ToLower(cellId)
+	}
+
+	rows, err := dao.pool.Query(ctx, `SELECT id, cell_id, callback_url, secret FROM subscriptions
+		WHERE spreadsheet_id = $1 AND cell_id = ANY($2) AND callback_url IS NOT NULL ORDER BY id`,
+		strings.ToLower(spreadsheetId), lower)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []Webhook
+	for rows.Next() {
+		var idVal int64
+		webhook := Webhook{SpreadsheetId: strings.ToLower(spreadsheetId)}
+		if err := rows.Scan(&idVal, &webhook.CellId, &webhook.Url, &webhook.Secret); err != nil {
+			return nil, err
+		}
+		webhook.SubscriptionId = strconv.FormatInt(idVal, 16)
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, rows.Err()
+}
+
+// SaveDelivery numbers new deliveries by the table sequence.
+func (dao *PostgresDao) SaveDelivery(delivery Delivery) (Delivery, error) {
+	subIdVal, err := strconv.ParseInt(delivery.SubscriptionId, 16, 64)
+	if err != nil {
+		return Delivery{}, ERROR_NO_SUBSCRIPTION
+	}
+
+	err = pgx.BeginFunc(ctx, dao.pool, func(tx pgx.Tx) error {
+		if delivery.Id == 0 {
+			err := tx.QueryRow(ctx,
+				"INSERT INTO webhook_deliveries (subscription_id, spreadsheet_id, delivery) VALUES ($1, $2, '{}') RETURNING id",
+				subIdVal, strings.ToLower(delivery.SpreadsheetId)).Scan(&delivery.Id)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.Exec(ctx, `DELETE FROM webhook_deliveries
+				WHERE subscription_id = $1 AND id <= (
+					SELECT id FROM webhook_deliveries WHERE subscription_id = $1
+					ORDER BY id DESC OFFSET $2 LIMIT 1)`,
+				subIdVal, MaxDeliveries)
+			if err != nil {
+				return err
+			}
+		}
+
+		data, err := json.Marshal(delivery)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, "UPDATE webhook_deliveries SET delivery = $2 WHERE id = $1", delivery.Id, string(data))
+		return err
+	})
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	return delivery, nil
+}
+
+func (dao *PostgresDao) GetDeliveries(subId string) ([]Delivery, error) {
+	subIdVal, err := strconv.ParseInt(subId, 16, 64)
+	if err != nil {
+		return nil, ERROR_NO_SUBSCRIPTION
+	}
+
+	rows, err := dao.pool.Query(ctx,
+		"SELECT delivery FROM webhook_deliveries WHERE subscription_id = $1 ORDER BY id", subIdVal)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []Delivery{}
+	for rows.Next() {
+		var delivery Delivery
+		if err := rows.Scan(&delivery); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+func (dao *PostgresDao) GetPendingDeliveries() ([]Delivery, error) {
+	rows, err := dao.pool.Query(ctx,
+		"SELECT delivery FROM webhook_deliveries WHERE delivery->>'status' = $1 ORDER BY subscription_id, id", DeliveryPending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []Delivery
+	for rows.Next() {
+		var delivery Delivery
+		if err := rows.Scan(&delivery); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sortDeliveries(deliveries)
+
+	return deliveries, nil
+}
+
+func (dao *PostgresDao) Subscribe(subId string) (Subscriber, error) {
+	data, err := dao.GetSubscription(subId)
+	if err != nil {
+		return nil, err
+	}
+
+	dao.startListening()
+
+	return dao.pubsub.Subscribe(subscriptionPubSubKey(data["spreadsheetId"], data["cellId"])), nil
+}
+
+func (dao *PostgresDao) SubscribeSpreadsheet(spreadsheetId string) (Subscriber, error) {
+	dao.startListening()
+
+	return dao.pubsub.Subscribe(spreadsheetPubSubKey(strings.ToLower(spreadsheetId))), nil
+}
+
+// postgresAppendCellEvents inserts the changes with the ids given by the table
+// sequence and notifies the subscribers on commit. Updates of the spreadsheet
+// are serialized by its lock, so the ids are committed and notified in their
+// order. The ids are set on changes.
+func postgresAppendCellEvents(db postgresQuerier, spreadsheetId string, changes []CellChange) error {
+	for i := range changes {
+		changes[i].CellId = strings.ToLower(changes[i].CellId)
+		changes[i].EventId = 0
+		err := db.QueryRow(ctx,
+			"INSERT INTO cell_events (spreadsheet_id, cell_id, change) VALUES ($1, $2, $3) RETURNING id",
+			strings.ToLower(spreadsheetId), changes[i].CellId, marshalCellChange(changes[i])).Scan(&changes[i].EventId)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(ctx, `DELETE FROM cell_events
+			WHERE spreadsheet_id = $1 AND cell_id = $2 AND id <= (
+				SELECT id FROM cell_events WHERE spreadsheet_id = $1 AND cell_id = $2
+				ORDER BY id DESC OFFSET $3 LIMIT 1)`,
+			strings.ToLower(spreadsheetId), changes[i].CellId, MaxCellEvents)
+		if err != nil {
+			return err
+		}
+
+		if err := postgresNotifyCellChange(db, spreadsheetId, changes[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (dao *PostgresDao) GetCellEvents(spreadsheetId string, cellId string) ([]CellChange, error) {
+	rows, err := dao.pool.Query(ctx,
+		"SELECT id, change FROM cell_events WHERE spreadsheet_id = $1 AND cell_id = $2 ORDER BY id",
+		strings.ToLower(spreadsheetId), strings.ToLower(cellId))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []CellChange{}
+	for rows.Next() {
+		var id int64
+		var event CellChange
+		if err := rows.Scan(&id, &event); err != nil {
+			return nil, err
+		}
+		event.EventId = id
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+func (dao *PostgresDao) NotifyCellChange(spreadsheetId string, change CellChange) error {
+	return postgresNotifyCellChange(dao.pool, spreadsheetId, change)
+}
+
+// postgresNotifyCellChange sends the change with pg_notify, within a
+// transaction it is delivered on commit.
+func postgresNotifyCellChange(db postgresQuerier, spreadsheetId string, change CellChange) error {
+	notification := postgresNotification{
+		SpreadsheetId: strings.ToLower(spreadsheetId),
+		CellChange:    change,
+	}
+	notification.CellId = strings.ToLower(change.CellId)
+
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	if len(payload) > postgresNotifyPayloadLimit {
+		notification.Old, notification.New, notification.Truncated = nil, nil, true
+		if payload, err = json.Marshal(notification); err != nil {
+			return err
+		}
+	}
+
+	_, err = db.Exec(ctx, "SELECT pg_notify($1, $2)", postgresNotifyChannel, string(payload))
+	return err
+}
+
+// startListening starts the listener with the first subscription and waits
+// a while for LISTEN so the following notifications are received.
+func (dao *PostgresDao) startListening() {
+	dao.listenOnce.Do(func() {
+		listening := make(chan struct{})
+		go dao.listen(dao.listenCtx, listening)
+
+		select {
+		case <-listening:
+		case <-time.After(postgresListenRetryDelay):
+		}
+	})
+}
+
+// listen holds a dedicated connection subscribed to the notification channel
+// and forwards notifications to the in-process subscribers, reconnecting on
+// failures until ctx is cancelled. listening is closed once LISTEN is issued.
+func (dao *PostgresDao) listen(ctx context.Context, listening chan struct{}) {
+	var listeningOnce sync.Once
+	onListen := func() {
+		listeningOnce.Do(func() { close(listening) })
+	}
+
+	for ctx.Err() == nil {
+		if err := dao.listenConn(ctx, onListen); err != nil && ctx.Err() == nil {
+			log.Printf("Postgres listener failure: %v", err)
+			time.Sleep(postgresListenRetryDelay)
+		}
+	}
+}
+
+func (dao *PostgresDao) listenConn(ctx context.Context, onListen func()) error {
+	poolConn, err := dao.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// The connection stays in the LISTEN state, do not return it to the pool.
+	conn := poolConn.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+postgresNotifyChannel); err != nil {
+		return err
+	}
+	onListen()
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var cell postgresNotification
+		if err := json.Unmarshal([]byte(notification.Payload), &cell); err != nil {
+			log.Printf("Invalid notification payload %q: %v", notification.Payload, err)
+			continue
+		}
+
+		dao.pubsub.PublishCellChange(cell.SpreadsheetId, cell.CellChange)
+	}
+}
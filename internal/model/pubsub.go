@@ -0,0 +1,106 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+)
+
+const localSubscriberBuffer = 64
+
+var ERROR_SUBSCRIBER_CLOSED = errors.New("Subscriber closed")
+
+// localPubSub is an in-process replacement of Redis PUBLISH/SUBSCRIBE for the
+// embedded storage backends.
+type localPubSub struct {
+	mu       sync.Mutex
+	channels map[string]map[*localSubscriber]struct{}
+}
+
+func newLocalPubSub() *localPubSub {
+	return &localPubSub{
+		channels: make(map[string]map[*localSubscriber]struct{}),
+	}
+}
+
+func (p *localPubSub) Subscribe(channel string) *localSubscriber {
+	s := &localSubscriber{
+		pubsub:   p,
+		channel:  channel,
+		messages: make(chan string, localSubscriberBuffer),
+		done:     make(chan struct{}),
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, exists := p.channels[channel]; !exists {
+		p.channels[channel] = make(map[*localSubscriber]struct{})
+	}
+	p.channels[channel][s] = struct{}{}
+
+	return s
+}
+
+// Publish delivers message to every subscriber of the channel. Like Redis it
+// does not wait for slow subscribers: a message is dropped when the
+// subscriber buffer is full.
+func (p *localPubSub) Publish(channel string, message string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for s := range p.channels[channel] {
+		select {
+		case s.messages <- message:
+		default:
+		}
+	}
+}
+
+// PublishCellChange delivers the change to the subscribers of the cell and of
+// its spreadsheet.
+func (p *localPubSub) PublishCellChange(spreadsheetId string, change CellChange) {
+	message := marshalCellChange(change)
+	p.Publish(subscriptionPubSubKey(spreadsheetId, strings.ToLower(change.CellId)), message)
+	p.Publish(spreadsheetPubSubKey(spreadsheetId), message)
+}
+
+func (p *localPubSub) unsubscribe(s *localSubscriber) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.channels[s.channel], s)
+	if len(p.channels[s.channel]) == 0 {
+		delete(p.channels, s.channel)
+	}
+}
+
+type localSubscriber struct {
+	pubsub   *localPubSub
+	channel  string
+	messages chan string
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func (s *localSubscriber) ReceiveMessage(ctx context.Context) (string, error) {
+	select {
+	case msg := <-s.messages:
+		return msg, nil
+	case <-s.done:
+		return "", ERROR_SUBSCRIBER_CLOSED
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func (s *localSubscriber) Close() error {
+	s.closeOnce.Do(func() {
+		s.pubsub.unsubscribe(s)
+		close(s.done)
+	})
+
+	return nil
+}
@@ -0,0 +1,1154 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisDao works with a single Redis, Sentinel managed failover or Redis
+// Cluster. Transactions only touch keys of a single spreadsheet, which share
+// a hash slot, keys shared by spreadsheets are written outside of them.
+type RedisDao struct {
+	rdb  redis.UniversalClient
+	keys redisKeys
+}
+
+func NewRedisDao(rdb redis.UniversalClient) *RedisDao {
+	return NewRedisDaoWithPrefix(rdb, DefaultRedisKeyPrefix)
+}
+
+// NewRedisDaoWithPrefix creates the Dao with all of its keys under the
+// prefix, so several services could share a Redis database.
+func NewRedisDaoWithPrefix(rdb redis.UniversalClient, prefix string) *RedisDao {
+	return &RedisDao{
+		rdb:  rdb,
+		keys: redisKeys{prefix: prefix},
+	}
+}
+
+func (dao *RedisDao) IsSpreadsheetExists(spreadsheetId string) (bool, error) {
+	val, err := dao.rdb.Exists(ctx, dao.keys.cells(spreadsheetId)).Result()
+	if err != nil {
+		return false, err
+	}
+
+	return val == 1, nil
+}
+
+func (dao *RedisDao) GetSpreadeetKeys(spreadsheetId string) ([]string, error) {
+	return dao.rdb.HKeys(ctx, dao.keys.cells(spreadsheetId)).Result()
+}
+
+func (dao *RedisDao) SetCell(spreadsheetId string, cellId string, value string) error {
+	return dao.setCell(dao.rdb, spreadsheetId, cellId, value)
+}
+
+func (dao *RedisDao) setCell(rdb redis.Cmdable, spreadsheetId string, cellId string, value string) error {
+	if err := rdb.HSet(ctx, dao.keys.cells(spreadsheetId), strings.ToLower(cellId), value).Err(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (dao *RedisDao) deleteCell(rdb redis.Cmdable, spreadsheetId string, cellId string) error {
+	return rdb.HDel(ctx, dao.keys.cells(spreadsheetId), strings.ToLower(cellId)).Err()
+}
+
+func (dao *RedisDao) GetCell(spreadsheetId string, cellId string) (string, error) {
+	value, err := dao.rdb.HGet(ctx, dao.keys.cells(spreadsheetId), strings.ToLower(cellId)).Result()
+	if err == redis.Nil {
+		return "", ERROR_NO_CELL
+	}
+
+	return value, err
+}
+
+func (dao *RedisDao) GetAllCells(spreadsheetId string) (map[string]string, error) {
+	return dao.rdb.HGetAll(ctx, dao.keys.cells(spreadsheetId)).Result()
+}
+
+func (dao *RedisDao) GetCells(spreadsheetId string, cellIds []string) (map[string]string, error) {
+	cells := make(map[string]string, len(cellIds))
+	if len(cellIds) == 0 {
+		return cells, nil
+	}
+
+	fields := make([]string, len(cellIds))
+	for i, cellId := range cellIds {
+		fields[i] = strings.ToLower(cellId)
+	}
+
+	values, err := dao.rdb.HMGet(ctx, dao.keys.cells(spreadsheetId), fields...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, value := range values {
+		if value, ok := value.(string); ok {
+			cells[fields[i]] = value
+		}
+	}
+
+	return cells, nil
+}
+
+func (dao *RedisDao) GetResult(spreadsheetId string, cellId string) (Result, error) {
+	data, err := dao.rdb.HGet(ctx, dao.keys.results(spreadsheetId), strings.ToLower(cellId)).Result()
+	if err == redis.Nil {
+		return Result{}, ERROR_NO_RESULT
+	}
+	if err != nil {
+		return Result{}, err
+	}
+
+	return unmarshalResult(data)
+}
+
+func (dao *RedisDao) GetResults(spreadsheetId string, cellIds []string) (map[string]Result, error) {
+	results := make(map[string]Result, len(cellIds))
+	if len(cellIds) == 0 {
+		return results, nil
+	}
+
+	fields := make([]string, len(cellIds))
+	for i, cellId := range cellIds {
+		fields[i] = strings.ToLower(cellId)
+	}
+
+	data, err := dao.rdb.HMGet(ctx, dao.keys.results(spreadsheetId), fields...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, value := range data {
+		if value, ok := value.(string); ok {
+			if results[fields[i]], err = unmarshalResult(value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return results, nil
+}
+
+func (dao *RedisDao) GetAllResults(spreadsheetId string) (map[string]Result, error) {
+	data, err := dao.rdb.HGetAll(ctx, dao.keys.results(spreadsheetId)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(map[string]Result, len(data))
+	for cellId, value := range data {
+		if results[cellId], err = unmarshalResult(value); err != nil {
+			return nil, err
+		}
+	}
+
+	return results, nil
+}
+
+// GetSpreadsheetState reads the keys of the spreadsheet in MULTI/EXEC, they
+// share the hash slot of the spreadsheet.
+func (dao *RedisDao) GetSpreadsheetState(spreadsheetId string) (SpreadsheetState, error) {
+	var state SpreadsheetState
+	var cellsCmd, resultsCmd *redis.MapStringStringCmd
+	var iterationCmd *redis.StringCmd
+
+	_, err := dao.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		cellsCmd = pipe.HGetAll(ctx, dao.keys.cells(spreadsheetId))
+		resultsCmd = pipe.HGetAll(ctx, dao.keys.results(spreadsheetId))
+		iterationCmd = pipe.HGet(ctx, dao.keys.info(spreadsheetId), "iteration")
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return state, err
+	}
+
+	state.Cells = cellsCmd.Val()
+	state.Results = make(map[string]Result, len(resultsCmd.Val()))
+	for cellId, value := range resultsCmd.Val() {
+		if _, exists := state.Cells[cellId]; !exists {
+			continue
+		}
+		if state.Results[cellId], err = unmarshalResult(value); err != nil {
+			return state, err
+		}
+	}
+
+	if data, err := iterationCmd.Result(); err == nil {
+		err = json.Unmarshal([]byte(data), &state.IterativeCalculation)
+		if err != nil {
+			return state, err
+		}
+	} else if err != redis.Nil {
+		return state, err
+	}
+
+	return state, nil
+}
+
+func (dao *RedisDao) GetDependants(spreadsheetId string, cellId string) ([]string, error) {
+	return dao.rdb.SMembers(ctx, dao.keys.dependants(spreadsheetId, cellId)).Result()
+}
+
+// GetDependencyIndex reads the dependant sets listed in the spreadsheet
+// dependants index. Cells are not removed from the index when their set gets
+// empty, such sets are skipped.
+func (dao *RedisDao) GetDependencyIndex(spreadsheetId string) (map[string][]string, error) {
+	cellIds, err := dao.rdb.SMembers(ctx, dao.keys.dependantsIndex(spreadsheetId)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	cmds := make([]*redis.StringSliceCmd, len(cellIds))
+	_, err = dao.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, cellId := range cellIds {
+			cmds[i] = pipe.SMembers(ctx, dao.keys.dependants(spreadsheetId, cellId))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[string][]string)
+	for i, cellId := range cellIds {
+		if dependants := cmds[i].Val(); len(dependants) > 0 {
+			index[cellId] = dependants
+		}
+	}
+
+	return index, nil
+}
+
+// dependantsGraphScript walks the dependant sets from the cells given after
+// the dependant key prefix in ARGV and returns every non-empty set prepended
+// by its cell. The dependant keys share the hash slot of KEYS[1], the
+// spreadsheet dependants index.
+var dependantsGraphScript = redis.NewScript(`
+local prefix = ARGV[1]
+local visited = {}
+local queue = {}
+for i = 2, #ARGV do
+	if not visited[ARGV[i]] then
+		visited[ARGV[i]] = true
+		queue[#queue + 1] = ARGV[i]
+	end
+end
+
+local graph = {}
+local i = 1
+while i <= #queue do
+	local cellId = queue[i]
+	local escaped = string.gsub(cellId, '[%%:{}]', function(c)
+		return string.format('%%%02X', string.byte(c))
+	end)
+	local dependants = redis.call('SMEMBERS', prefix .. escaped)
+	if #dependants > 0 then
+		local entry = {cellId}
+		for _, dependantId in ipairs(dependants) do
+			entry[#entry + 1] = dependantId
+			if not visited[dependantId] then
+				visited[dependantId] = true
+				queue[#queue + 1] = dependantId
+			end
+		end
+		graph[#graph + 1] = entry
+	end
+	i = i + 1
+end
+
+return graph
+`)
+
+// GetDependantsGraph walks the dependant sets by a script, so the whole
+// subgraph is read in a single round trip.
+func (dao *RedisDao) GetDependantsGraph(spreadsheetId string, cellIds []string) (map[string][]string, error) {
+	args := make([]interface{}, 0, len(cellIds)+1)
+	args = append(args, dao.keys.dependants(spreadsheetId, ""))
+	for _, cellId := range cellIds {
+		args = append(args, strings.ToLower(cellId))
+	}
+
+	entries, err := dependantsGraphScript.Run(ctx, dao.rdb, []string{dao.keys.dependantsIndex(spreadsheetId)}, args...).Slice()
+	if err != nil {
+		return nil, err
+	}
+
+	graph := make(map[string][]string, len(entries))
+	for _, entry := range entries {
+		ids, ok := entry.([]interface{})
+		if !ok || len(ids) == 0 {
+			continue
+		}
+
+		cellId, _ := ids[0].(string)
+		dependants := make([]string, 0, len(ids)-1)
+		for _, id := range ids[1:] {
+			if dependantId, ok := id.(string); ok {
+				dependants = append(dependants, dependantId)
+			}
+		}
+		graph[cellId] = dependants
+	}
+
+	return graph, nil
+}
+
+func (dao *RedisDao) AddDependatFormula(spreadsheetId string, cellId string, dependsOn []string) error {
+	return dao.addDependatFormula(dao.rdb, spreadsheetId, cellId, dependsOn)
+}
+
+func (dao *RedisDao) addDependatFormula(rdb redis.Cmdable, spreadsheetId string, cellId string, dependsOn []string) error {
+	cellId = strings.ToLower(cellId)
+	for _, dependantCellId := range dependsOn {
+		dependantCellId = strings.ToLower(dependantCellId)
+		if dependantCellId == cellId {
+			continue
+		}
+
+		err := rdb.SAdd(ctx, dao.keys.dependants(spreadsheetId, dependantCellId), cellId).Err()
+		if err != nil {
+			return err
+		}
+
+		err = rdb.SAdd(ctx, dao.keys.dependantsIndex(spreadsheetId), dependantCellId).Err()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (dao *RedisDao) DeleteDependatFormula(spreadsheetId string, cellId string, dependsOn []string) error {
+	return dao.deleteDependatFormula(dao.rdb, spreadsheetId, cellId, dependsOn)
+}
+
+func (dao *RedisDao) deleteDependatFormula(rdb redis.Cmdable, spreadsheetId string, cellId string, dependsOn []string) error {
+	for _, dependantCellId := range dependsOn {
+		err := rdb.SRem(ctx, dao.keys.dependants(spreadsheetId, dependantCellId), strings.ToLower(cellId)).Err()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Update watches the spreadsheet hash and registry entry while fn validates
+// the change, the collected batch is executed in MULTI/EXEC. Every batch
+// writes the registry entry, so a concurrent update invalidates the
+// transaction and fn is retried.
+func (dao *RedisDao) Update(spreadsheetId string, fn func(batch *Batch) error) error {
+	txf := func(tx *redis.Tx) error {
+		batch := &Batch{}
+		if err := fn(batch); err != nil {
+			return err
+		}
+
+		if batch.Empty() {
+			return nil
+		}
+
+		values, err := dao.getEditValues(tx, spreadsheetId, batch)
+		if err != nil {
+			return err
+		}
+
+		if err := dao.register(spreadsheetId); err != nil {
+			return err
+		}
+
+		var events *redis.Cmd
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if err := dao.applyBatch(pipe, spreadsheetId, batch); err != nil {
+				return err
+			}
+			if err := dao.pushEdit(pipe, spreadsheetId, batch, values); err != nil {
+				return err
+			}
+			events = dao.publishCellEvents(pipe, spreadsheetId, batch.events)
+			return nil
+		})
+		if err != nil || events == nil {
+			return err
+		}
+
+		last, err := events.Int64()
+		if err != nil {
+			return err
+		}
+		for i := range batch.events {
+			batch.events[i].EventId = last - int64(len(batch.events)-1-i)
+		}
+
+		return nil
+	}
+
+	for i := 0; i < maxUpdateRetries; i++ {
+		err := dao.rdb.Watch(ctx, txf, dao.keys.cells(spreadsheetId), dao.keys.info(spreadsheetId))
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+
+	return ERROR_UPDATE_CONFLICT
+}
+
+func (dao *RedisDao) applyBatch(rdb redis.Cmdable, spreadsheetId string, batch *Batch) error {
+	now := time.Now().UTC()
+
+	for _, op := range batch.ops {
+		var err error
+		switch op.kind {
+		case batchSetCell:
+			err = dao.setCell(rdb, spreadsheetId, op.cellId, op.value)
+		case batchDeleteCell:
+			err = dao.deleteCell(rdb, spreadsheetId, op.cellId)
+		case batchAddDependants:
+			err = dao.addDependatFormula(rdb, spreadsheetId, op.cellId, op.dependsOn)
+		case batchDeleteDependants:
+			err = dao.deleteDependatFormula(rdb, spreadsheetId, op.cellId, op.dependsOn)
+		case batchSetResult:
+			err = rdb.HSet(ctx, dao.keys.results(spreadsheetId), op.cellId, op.value).Err()
+		case batchDeleteResult:
+			err = rdb.HDel(ctx, dao.keys.results(spreadsheetId), op.cellId).Err()
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := dao.appendHistory(rdb, spreadsheetId, batch.historyEntries(now)); err != nil {
+		return err
+	}
+
+	return dao.updateInfo(rdb, spreadsheetId, batch, now)
+}
+
+// getEditValues reads values of the cells written by the batch, they are read
+// by the watching connection before the transaction.
+func (dao *RedisDao) getEditValues(tx *redis.Tx, spreadsheetId string, batch *Batch) (map[string]string, error) {
+	cellIds := batch.editCells()
+	if len(cellIds) == 0 {
+		return nil, nil
+	}
+
+	data, err := tx.HMGet(ctx, dao.keys.cells(spreadsheetId), cellIds...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string, len(cellIds))
+	for i, value := range data {
+		if value, ok := value.(string); ok {
+			values[cellIds[i]] = value
+		}
+	}
+
+	return values, nil
+}
+
+// pushEdit records the edit reverting the batch on the undo or redo stack.
+func (dao *RedisDao) pushEdit(rdb redis.Cmdable, spreadsheetId string, batch *Batch, values map[string]string) error {
+	if values == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(batch.revertEdit(values))
+	if err != nil {
+		return err
+	}
+
+	push, pop, clearRedo := batch.editStacks()
+	if pop != nil {
+		if err := rdb.LPop(ctx, dao.keys.edits(spreadsheetId, *pop)).Err(); err != nil && err != redis.Nil {
+			return err
+		}
+	}
+	if clearRedo {
+		if err := rdb.Del(ctx, dao.keys.edits(spreadsheetId, RedoStack)).Err(); err != nil {
+			return err
+		}
+	}
+
+	pushKey := dao.keys.edits(spreadsheetId, push)
+	if err := rdb.LPush(ctx, pushKey, string(data)).Err(); err != nil {
+		return err
+	}
+
+	return rdb.LTrim(ctx, pushKey, 0, maxUndoEdits-1).Err()
+}
+
+func (dao *RedisDao) GetEdit(spreadsheetId string, stack EditStack) (Edit, error) {
+	data, err := dao.rdb.LIndex(ctx, dao.keys.edits(spreadsheetId, stack), 0).Result()
+	if err == redis.Nil {
+		return Edit{}, ERROR_NO_EDIT
+	}
+	if err != nil {
+		return Edit{}, err
+	}
+
+	var edit Edit
+	err = json.Unmarshal([]byte(data), &edit)
+
+	return edit, err
+}
+
+func (dao *RedisDao) CreateSnapshot(spreadsheetId string, snapshot Snapshot) error {
+	snapshot.Name = strings.ToLower(snapshot.Name)
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	created, err := dao.rdb.HSetNX(ctx, dao.keys.snapshots(spreadsheetId), snapshot.Name, string(data)).Result()
+	if err != nil {
+		return err
+	}
+	if !created {
+		return ERROR_SNAPSHOT_EXISTS
+	}
+
+	return nil
+}
+
+func (dao *RedisDao) ListSnapshots(spreadsheetId string) ([]Snapshot, error) {
+	data, err := dao.rdb.HVals(ctx, dao.keys.snapshots(spreadsheetId)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]Snapshot, len(data))
+	for i := range data {
+		if err := json.Unmarshal([]byte(data[i]), &snapshots[i]); err != nil {
+			return nil, err
+		}
+	}
+	sortSnapshots(snapshots)
+
+	return snapshots, nil
+}
+
+func (dao *RedisDao) GetSnapshot(spreadsheetId string, name string) (Snapshot, error) {
+	data, err := dao.rdb.HGet(ctx, dao.keys.snapshots(spreadsheetId), strings.ToLower(name)).Result()
+	if err == redis.Nil {
+		return Snapshot{}, ERROR_NO_SNAPSHOT
+	}
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	var snapshot Snapshot
+	err = json.Unmarshal([]byte(data), &snapshot)
+
+	return snapshot, err
+}
+
+// appendHistory pushes entries to the cell lists, used to read a cell history,
+// and to the spreadsheet sorted set scored by microseconds, used to restore
+// cells at some moment.
+func (dao *RedisDao) appendHistory(rdb redis.Cmdable, spreadsheetId string, entries []historyEntry) error {
+	for _, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+
+		if err := rdb.RPush(ctx, dao.keys.cellHistory(spreadsheetId, entry.CellId), string(data)).Err(); err != nil {
+			return err
+		}
+
+		err = rdb.ZAdd(ctx, dao.keys.history(spreadsheetId), redis.Z{
+			Score:  float64(entry.Timestamp.UnixMicro()),
+			Member: string(data),
+		}).Err()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (dao *RedisDao) GetCellHistory(spreadsheetId string, cellId string) ([]CellVersion, error) {
+	data, err := dao.rdb.LRange(ctx, dao.keys.cellHistory(spreadsheetId, cellId), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]CellVersion, len(data))
+	for i := range data {
+		var entry historyEntry
+		if err := json.Unmarshal([]byte(data[i]), &entry); err != nil {
+			return nil, err
+		}
+		versions[i] = entry.version(i + 1)
+	}
+
+	return versions, nil
+}
+
+func (dao *RedisDao) GetCellsAt(spreadsheetId string, at time.Time) (map[string]string, error) {
+	data, err := dao.rdb.ZRangeByScore(ctx, dao.keys.history(spreadsheetId), &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(at.UnixMicro(), 10),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	cells := make(map[string]string)
+	for _, member := range data {
+		var entry historyEntry
+		if err := json.Unmarshal([]byte(member), &entry); err != nil {
+			return nil, err
+		}
+
+		if entry.Deleted {
+			delete(cells, entry.CellId)
+		} else {
+			cells[entry.CellId] = entry.Value
+		}
+	}
+
+	return cells, nil
+}
+
+// register adds the spreadsheet to the registry sorted set. The set is shared
+// by spreadsheets, so it is written before the transaction of the spreadsheet
+// keys; ids without the info hash are skipped by the listing. Ids have equal
+// scores, so they are ordered lexicographically and listed with ZRANGEBYLEX
+// instead of KEYS.
+func (dao *RedisDao) register(spreadsheetId string) error {
+	return dao.rdb.ZAdd(ctx, dao.keys.registry(), redis.Z{Member: strings.ToLower(spreadsheetId)}).Err()
+}
+
+func (dao *RedisDao) updateInfo(rdb redis.Cmdable, spreadsheetId string, batch *Batch, updatedAt time.Time) error {
+	infoKey := dao.keys.info(spreadsheetId)
+	now := updatedAt.Format(time.RFC3339Nano)
+
+	if err := rdb.HSetNX(ctx, infoKey, "createdAt", now).Err(); err != nil {
+		return err
+	}
+
+	if err := rdb.HSetNX(ctx, infoKey, "owner", batch.origin.Author).Err(); err != nil {
+		return err
+	}
+
+	values := []interface{}{"updatedAt", now}
+	if batch.title != nil {
+		values = append(values, "title", *batch.title)
+	}
+	if batch.iteration != nil {
+		iteration, err := json.Marshal(batch.iteration)
+		if err != nil {
+			return err
+		}
+		values = append(values, "iteration", iteration)
+	}
+
+	return rdb.HSet(ctx, infoKey, values...).Err()
+}
+
+func (dao *RedisDao) ListSpreadsheets(prefix string, after string, limit int) ([]SpreadsheetInfo, error) {
+	prefix = strings.ToLower(prefix)
+	after = strings.ToLower(after)
+
+	min, max := "-", "+"
+	if prefix != "" {
+		min = "[" + prefix
+		// 0xff never occurs in UTF-8, every id with the prefix sorts before.
+		max = "[" + prefix + "\xff"
+	}
+	if after != "" && after >= prefix {
+		min = "(" + after
+	}
+
+	ids, err := dao.rdb.ZRangeByLex(ctx, dao.keys.registry(), &redis.ZRangeBy{
+		Min:   min,
+		Max:   max,
+		Count: int64(limit),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return dao.getSpreadsheetInfos(ids)
+}
+
+func (dao *RedisDao) GetSpreadsheetInfo(spreadsheetId string) (SpreadsheetInfo, error) {
+	infos, err := dao.getSpreadsheetInfos([]string{strings.ToLower(spreadsheetId)})
+	if err != nil {
+		return SpreadsheetInfo{}, err
+	}
+	if len(infos) == 0 {
+		return SpreadsheetInfo{}, ERROR_NO_SPREADSHEET
+	}
+
+	return infos[0], nil
+}
+
+func (dao *RedisDao) GetIterativeCalculation(spreadsheetId string) (IterativeCalculation, error) {
+	var iteration IterativeCalculation
+
+	data, err := dao.rdb.HGet(ctx, dao.keys.info(spreadsheetId), "iteration").Result()
+	if err == redis.Nil {
+		return iteration, nil
+	}
+	if err != nil {
+		return iteration, err
+	}
+
+	err = json.Unmarshal([]byte(data), &iteration)
+	return iteration, err
+}
+
+// getSpreadsheetInfos fetches registry entries of the spreadsheets in a single
+// round trip, unregistered spreadsheets are skipped.
+func (dao *RedisDao) getSpreadsheetInfos(ids []string) ([]SpreadsheetInfo, error) {
+	infoCmds := make([]*redis.MapStringStringCmd, len(ids))
+	countCmds := make([]*redis.IntCmd, len(ids))
+
+	_, err := dao.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			infoCmds[i] = pipe.HGetAll(ctx, dao.keys.info(id))
+			countCmds[i] = pipe.HLen(ctx, dao.keys.cells(id))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]SpreadsheetInfo, 0, len(ids))
+	for i, id := range ids {
+		data := infoCmds[i].Val()
+		if len(data) == 0 {
+			continue
+		}
+
+		info := SpreadsheetInfo{
+			Id:        id,
+			Title:     data["title"],
+			Owner:     data["owner"],
+			CellCount: int(countCmds[i].Val()),
+		}
+		if info.CreatedAt, err = time.Parse(time.RFC3339Nano, data["createdAt"]); err != nil {
+			return nil, err
+		}
+		if info.UpdatedAt, err = time.Parse(time.RFC3339Nano, data["updatedAt"]); err != nil {
+			return nil, err
+		}
+		if iteration, exists := data["iteration"]; exists {
+			if err := json.Unmarshal([]byte(iteration), &info.IterativeCalculation); err != nil {
+				return nil, err
+			}
+		}
+
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+// DeleteSpreadsheet watches the spreadsheet hash and its subscriptions set
+// while looking up the keys to delete, retrying on concurrent modification.
+// Subscriptions and the registry entry are shared by spreadsheets, they are
+// removed once the spreadsheet keys are deleted.
+func (dao *RedisDao) DeleteSpreadsheet(spreadsheetId string) error {
+	cellsKey := dao.keys.cells(spreadsheetId)
+	subsKey := dao.keys.sheetSubscriptions(spreadsheetId)
+	indexKey := dao.keys.dependantsIndex(spreadsheetId)
+
+	var subIds []string
+	txf := func(tx *redis.Tx) error {
+		historyKey := dao.keys.history(spreadsheetId)
+		keys := []string{cellsKey, dao.keys.results(spreadsheetId), subsKey, indexKey, historyKey, dao.keys.info(spreadsheetId),
+			dao.keys.edits(spreadsheetId, UndoStack), dao.keys.edits(spreadsheetId, RedoStack),
+			dao.keys.snapshots(spreadsheetId), dao.keys.eventId(spreadsheetId), dao.keys.eventsIndex(spreadsheetId),
+			dao.keys.sheetWebhooks(spreadsheetId)}
+
+		cellIds, err := tx.SMembers(ctx, indexKey).Result()
+		if err != nil {
+			return err
+		}
+		for _, cellId := range cellIds {
+			keys = append(keys, dao.keys.dependants(spreadsheetId, cellId))
+		}
+
+		eventCellIds, err := tx.SMembers(ctx, dao.keys.eventsIndex(spreadsheetId)).Result()
+		if err != nil {
+			return err
+		}
+		for _, cellId := range eventCellIds {
+			keys = append(keys, dao.keys.events(spreadsheetId, cellId))
+		}
+
+		history, err := tx.ZRange(ctx, historyKey, 0, -1).Result()
+		if err != nil {
+			return err
+		}
+		historyCells := make(map[string]struct{})
+		for _, member := range history {
+			var entry historyEntry
+			if err := json.Unmarshal([]byte(member), &entry); err != nil {
+				return err
+			}
+			historyCells[entry.CellId] = struct{}{}
+		}
+		for cellId := range historyCells {
+			keys = append(keys, dao.keys.cellHistory(spreadsheetId, cellId))
+		}
+
+		subIds, err = tx.SMembers(ctx, subsKey).Result()
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			return pipe.Del(ctx, keys...).Err()
+		})
+		return err
+	}
+
+	err := ERROR_UPDATE_CONFLICT
+	for i := 0; i < maxUpdateRetries && err == ERROR_UPDATE_CONFLICT; i++ {
+		err = dao.rdb.Watch(ctx, txf, cellsKey, subsKey, indexKey)
+		if err == redis.TxFailedErr {
+			err = ERROR_UPDATE_CONFLICT
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, subId := range subIds {
+		for _, key := range []string{dao.keys.subscription(subId), dao.keys.deliveryId(subId), dao.keys.deliveries(subId)} {
+			if err := dao.rdb.Del(ctx, key).Err(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return dao.rdb.ZRem(ctx, dao.keys.registry(), strings.ToLower(spreadsheetId)).Err()
+}
+
+func (dao *RedisDao) CreateSubscription(spreadsheetId string, cellId string) (string, error) {
+	return dao.createSubscription(spreadsheetId, cellId)
+}
+
+// CreateWebhook indexes the subscription in the spreadsheet webhooks set.
+func (dao *RedisDao) CreateWebhook(spreadsheetId string, cellId string, url string, secret string) (string, error) {
+	id, err := dao.createSubscription(spreadsheetId, cellId, "callbackUrl", url, "secret", secret)
+	if err != nil {
+		return "", err
+	}
+
+	if err := dao.rdb.SAdd(ctx, dao.keys.sheetWebhooks(spreadsheetId), id).Err(); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+func (dao *RedisDao) createSubscription(spreadsheetId string, cellId string, fields ...string) (string, error) {
+	idVal, err := dao.rdb.Incr(ctx, dao.keys.subscriptionCounter()).Result()
+	if err != nil {
+		return "", err
+	}
+
+	id := strconv.FormatInt(idVal, 16)
+
+	values := append([]string{
+		"spreadsheetId",
+		strings.ToLower(spreadsheetId),
+		"cellId",
+		strings.ToLower(cellId)}, fields...)
+	if err := dao.rdb.HSet(ctx, dao.keys.subscription(id), values).Err(); err != nil {
+		return "", err
+	}
+
+	if err := dao.rdb.SAdd(ctx, dao.keys.sheetSubscriptions(spreadsheetId), id).Err(); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// GetWebhooks reads every webhook subscription of the spreadsheet in a
+// single pipeline, there are few of them.
+func (dao *RedisDao) GetWebhooks(spreadsheetId string, cellIds []string) ([]Webhook, error) {
+	subIds, err := dao.rdb.SMembers(ctx, dao.keys.sheetWebhooks(spreadsheetId)).Result()
+	if err != nil || len(subIds) == 0 {
+		return nil, err
+	}
+
+	cmds := make([]*redis.MapStringStringCmd, len(subIds))
+	_, err = dao.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, subId := range subIds {
+			cmds[i] = pipe.HGetAll(ctx, dao.keys.subscription(subId))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cells := make(map[string]bool, len(cellIds))
+	for _, cellId := range cellIds {
+		cells[strings.ToLower(cellId)] = true
+	}
+
+	var webhooks []Webhook
+	for i, cmd := range cmds {
+		if webhook, ok := WebhookFromSubscription(subIds[i], cmd.Val()); ok && cells[webhook.CellId] {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	sort.Slice(webhooks, func(i, j int) bool { return webhooks[i].SubscriptionId < webhooks[j].SubscriptionId })
+
+	return webhooks, nil
+}
+
+// SaveDelivery drops the delivery MaxDeliveries ids older than a new one.
+// Pending deliveries are indexed in the pending set.
+func (dao *RedisDao) SaveDelivery(delivery Delivery) (Delivery, error) {
+	if delivery.Id == 0 {
+		id, err := dao.rdb.Incr(ctx, dao.keys.deliveryId(delivery.SubscriptionId)).Result()
+		if err != nil {
+			return Delivery{}, err
+		}
+		delivery.Id = id
+
+		if id > MaxDeliveries {
+			err := dao.rdb.HDel(ctx, dao.keys.deliveries(delivery.SubscriptionId), strconv.FormatInt(id-MaxDeliveries, 10)).Err()
+			if err != nil {
+				return Delivery{}, err
+			}
+			err = dao.rdb.SRem(ctx, dao.keys.pendingDeliveries(), pendingDeliveryMember(delivery.SubscriptionId, id-MaxDeliveries)).Err()
+			if err != nil {
+				return Delivery{}, err
+			}
+		}
+	}
+
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	err = dao.rdb.HSet(ctx, dao.keys.deliveries(delivery.SubscriptionId), strconv.FormatInt(delivery.Id, 10), data).Err()
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	member := pendingDeliveryMember(delivery.SubscriptionId, delivery.Id)
+	if delivery.Status == DeliveryPending {
+		err = dao.rdb.SAdd(ctx, dao.keys.pendingDeliveries(), member).Err()
+	} else {
+		err = dao.rdb.SRem(ctx, dao.keys.pendingDeliveries(), member).Err()
+	}
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	return delivery, nil
+}
+
+func pendingDeliveryMember(subId string, id int64) string {
+	return subId + ":" + strconv.FormatInt(id, 10)
+}
+
+// GetPendingDeliveries reads the indexed deliveries, members of the removed
+// subscriptions are dropped from the pending set.
+func (dao *RedisDao) GetPendingDeliveries() ([]Delivery, error) {
+	members, err := dao.rdb.SMembers(ctx, dao.keys.pendingDeliveries()).Result()
+	if err != nil || len(members) == 0 {
+		return nil, err
+	}
+
+	cmds := make([]*redis.StringCmd, len(members))
+	_, err = dao.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, member := range members {
+			subId, id, _ := strings.Cut(member, ":")
+			cmds[i] = pipe.HGet(ctx, dao.keys.deliveries(subId), id)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	var deliveries []Delivery
+	for i, cmd := range cmds {
+		data, err := cmd.Result()
+		if err == redis.Nil {
+			if err := dao.rdb.SRem(ctx, dao.keys.pendingDeliveries(), members[i]).Err(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var delivery Delivery
+		if err := json.Unmarshal([]byte(data), &delivery); err != nil {
+			return nil, err
+		}
+		if delivery.Status == DeliveryPending {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	sortDeliveries(deliveries)
+
+	return deliveries, nil
+}
+
+func (dao *RedisDao) GetDeliveries(subId string) ([]Delivery, error) {
+	data, err := dao.rdb.HVals(ctx, dao.keys.deliveries(subId)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]Delivery, len(data))
+	for i := range data {
+		if err := json.Unmarshal([]byte(data[i]), &deliveries[i]); err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].Id < deliveries[j].Id })
+
+	return deliveries, nil
+}
+
+func (dao *RedisDao) GetSubscription(subId string) (map[string]string, error) {
+	data, err := dao.rdb.HGetAll(ctx, dao.keys.subscription(subId)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, ERROR_NO_SUBSCRIPTION
+	}
+
+	return data, nil
+}
+
+func (dao *RedisDao) Subscribe(subId string) (Subscriber, error) {
+	data, err := dao.GetSubscription(subId)
+	if err != nil {
+		return nil, err
+	}
+
+	pubsub := dao.rdb.Subscribe(
+		ctx,
+		dao.keys.pubsub(data["spreadsheetId"], data["cellId"]),
+	)
+
+	return newRedisSubscriber(pubsub), nil
+}
+
+func (dao *RedisDao) SubscribeSpreadsheet(spreadsheetId string) (Subscriber, error) {
+	pubsub := dao.rdb.PSubscribe(ctx, dao.keys.pubsubPattern(spreadsheetId))
+
+	return newRedisSubscriber(pubsub), nil
+}
+
+// publishCellEventsScript reserves the event ids, appends the changes to the
+// event logs and publishes them at once, so the events are logged and
+// published in the order of their ids. KEYS are the event id, the events
+// index and the event log of every change, ARGV the log length followed by
+// the cell id, the channel and the JSON without event id of every change.
+// Returns the last reserved id.
+var publishCellEventsScript = redis.NewScript(`
+local max = tonumber(ARGV[1])
+local n = #KEYS - 2
+local last = redis.call('INCRBY', KEYS[1], n)
+for i = 1, n do
+	local key = KEYS[i + 2]
+	local event = '{"eventId":' .. string.format('%d', last - n + i) .. ',' .. string.sub(ARGV[3 * i + 1], 2)
+	redis.call('RPUSH', key, event)
+	redis.call('LTRIM', key, -max, -1)
+	redis.call('SADD', KEYS[2], ARGV[3 * i - 1])
+	redis.call('PUBLISH', ARGV[3 * i], event)
+end
+return last
+`)
+
+// publishCellEvents queues the script logging and publishing the changes in
+// the transaction, it is sent as is as a missing script can not be loaded
+// within MULTI. Returns nil without changes.
+func (dao *RedisDao) publishCellEvents(pipe redis.Pipeliner, spreadsheetId string, changes []CellChange) *redis.Cmd {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	keys := []string{dao.keys.eventId(spreadsheetId), dao.keys.eventsIndex(spreadsheetId)}
+	args := []interface{}{MaxCellEvents}
+	for _, change := range changes {
+		change.EventId = 0
+		keys = append(keys, dao.keys.events(spreadsheetId, change.CellId))
+		args = append(args, strings.ToLower(change.CellId), dao.keys.pubsub(spreadsheetId, change.CellId), marshalCellChange(change))
+	}
+
+	return publishCellEventsScript.Eval(ctx, pipe, keys, args...)
+}
+
+func (dao *RedisDao) GetCellEvents(spreadsheetId string, cellId string) ([]CellChange, error) {
+	data, err := dao.rdb.LRange(ctx, dao.keys.events(spreadsheetId, cellId), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]CellChange, len(data))
+	for i := range data {
+		if err := json.Unmarshal([]byte(data[i]), &events[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return events, nil
+}
+
+func (dao *RedisDao) NotifyCellChange(spreadsheetId string, change CellChange) error {
+	return dao.rdb.Publish(ctx, dao.keys.pubsub(spreadsheetId, change.CellId), marshalCellChange(change)).Err()
+}
+
+// redisSubscriber reads messages through the go-redis channel as blocking
+// PubSub.ReceiveMessage does not respect context cancellation.
+type redisSubscriber struct {
+	pubsub   *redis.PubSub
+	messages <-chan *redis.Message
+}
+
+func newRedisSubscriber(pubsub *redis.PubSub) *redisSubscriber {
+	return &redisSubscriber{
+		pubsub:   pubsub,
+		messages: pubsub.Channel(),
+	}
+}
+
+func (s *redisSubscriber) ReceiveMessage(ctx context.Context) (string, error) {
+	select {
+	case msg, ok := <-s.messages:
+		if !ok {
+			return "", ERROR_SUBSCRIBER_CLOSED
+		}
+		return msg.Payload, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func (s *redisSubscriber) Close() error {
+	return s.pubsub.Close()
+}
@@ -0,0 +1,179 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+// Cluster and Sentinel tests are executed against local Redis processes given
+// by the environment, e.g. a cluster started with the create-cluster script of
+// the Redis distribution and a Sentinel monitoring a single Redis:
+//
+//	utils/create-cluster/create-cluster start && utils/create-cluster/create-cluster create
+//	REDIS_CLUSTER_TEST_ADDRS=localhost:30001,localhost:30002,localhost:30003 go test ./internal/model/
+//
+//	redis-server --port 6380 &
+//	printf 'port 26379\nsentinel monitor mymaster 127.0.0.1 6380 1\n' > sentinel.conf && redis-sentinel sentinel.conf &
+//	REDIS_SENTINEL_TEST_ADDRS=localhost:26379 REDIS_SENTINEL_TEST_MASTER=mymaster go test ./internal/model/
+//
+// Every test works under its own key prefix, so the databases are not flushed.
+func prepareRedisFromEnv(t *testing.T, addrsEnv string, cluster bool) *RedisDao {
+	addrs := os.Getenv(addrsEnv)
+	if addrs == "" {
+		t.Skipf("%s is not set", addrsEnv)
+	}
+
+	rdb := NewRedisClient(&redis.UniversalOptions{
+		Addrs:      strings.Split(addrs, ","),
+		MasterName: os.Getenv("REDIS_SENTINEL_TEST_MASTER"),
+	}, cluster)
+	t.Cleanup(func() { rdb.Close() })
+
+	return NewRedisDaoWithPrefix(rdb, fmt.Sprintf("test-%s-%d", t.Name(), time.Now().UnixNano()))
+}
+
+func testRedisDeployment(t *testing.T, prepare func(t *testing.T) *RedisDao) {
+	t.Run("Cells", func(t *testing.T) { testDaoCells(t, prepare(t)) })
+	t.Run("Dependants", func(t *testing.T) { testDaoDependants(t, prepare(t)) })
+	t.Run("Subscription", func(t *testing.T) { testDaoSubscription(t, prepare(t)) })
+	t.Run("SubscribeSpreadsheet", func(t *testing.T) { testDaoSubscribeSpreadsheet(t, prepare(t)) })
+	t.Run("Update", func(t *testing.T) { testDaoUpdate(t, prepare(t)) })
+	t.Run("DependencyIndex", func(t *testing.T) { testDaoDependencyIndex(t, prepare(t)) })
+	t.Run("DependantsGraph", func(t *testing.T) { testDaoDependantsGraph(t, prepare(t)) })
+	t.Run("DeleteSpreadsheet", func(t *testing.T) { testDaoDeleteSpreadsheet(t, prepare(t)) })
+	t.Run("Registry", func(t *testing.T) { testDaoRegistry(t, prepare(t)) })
+	t.Run("History", func(t *testing.T) { testDaoHistory(t, prepare(t)) })
+	t.Run("Edits", func(t *testing.T) { testDaoEdits(t, prepare(t)) })
+	t.Run("Snapshots", func(t *testing.T) { testDaoSnapshots(t, prepare(t)) })
+	t.Run("IterativeCalculation", func(t *testing.T) { testDaoIterativeCalculation(t, prepare(t)) })
+	t.Run("Results", func(t *testing.T) { testDaoResults(t, prepare(t)) })
+	t.Run("SpreadsheetState", func(t *testing.T) { testDaoSpreadsheetState(t, prepare(t)) })
+	t.Run("CellEvents", func(t *testing.T) { testDaoCellEvents(t, prepare(t)) })
+	t.Run("Webhooks", func(t *testing.T) { testDaoWebhooks(t, prepare(t)) })
+}
+
+func TestRedisCluster(t *testing.T) {
+	testRedisDeployment(t, func(t *testing.T) *RedisDao {
+		return prepareRedisFromEnv(t, "REDIS_CLUSTER_TEST_ADDRS", true)
+	})
+}
+
+func TestRedisSentinel(t *testing.T) {
+	testRedisDeployment(t, func(t *testing.T) *RedisDao {
+		return prepareRedisFromEnv(t, "REDIS_SENTINEL_TEST_ADDRS", false)
+	})
+}
+
+// slotCheckHook fails the test when a multi-key command or a transaction
+// touches keys of different hash slots, which Redis Cluster rejects.
+type slotCheckHook struct {
+	t *testing.T
+}
+
+func redisHashTag(key string) string {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			return key[start+1 : start+1+end]
+		}
+	}
+
+	return key
+}
+
+func redisCmdKeys(cmd redis.Cmder) []interface{} {
+	args := cmd.Args()
+	if len(args) < 2 {
+		return nil
+	}
+
+	switch cmd.Name() {
+	case "watch", "del":
+		return args[1:]
+	case "multi", "exec":
+		return nil
+	case "eval", "evalsha":
+		// The script is followed by the number of keys and the keys
+		numKeys, _ := strconv.Atoi(fmt.Sprint(args[2]))
+		return args[3 : 3+numKeys]
+	}
+
+	return args[1:2]
+}
+
+func (h slotCheckHook) assertSingleSlot(keys []interface{}) {
+	for _, key := range keys {
+		assert.Equal(h.t, redisHashTag(fmt.Sprint(keys[0])), redisHashTag(fmt.Sprint(key)), "keys %v", keys)
+	}
+}
+
+func (h slotCheckHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h slotCheckHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		h.assertSingleSlot(redisCmdKeys(cmd))
+		return next(ctx, cmd)
+	}
+}
+
+func (h slotCheckHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if len(cmds) > 0 && cmds[0].Name() == "multi" {
+			var keys []interface{}
+			for _, cmd := range cmds {
+				keys = append(keys, redisCmdKeys(cmd)...)
+			}
+			h.assertSingleSlot(keys)
+		} else {
+			for _, cmd := range cmds {
+				h.assertSingleSlot(redisCmdKeys(cmd))
+			}
+		}
+		return next(ctx, cmds)
+	}
+}
+
+func TestRedisSingleSlotTransactions(t *testing.T) {
+	testRedisDeployment(t, func(t *testing.T) *RedisDao {
+		server := miniredis.RunT(t)
+		rdb := redis.NewClient(&redis.Options{Addr: server.Addr()})
+		rdb.AddHook(slotCheckHook{t})
+		t.Cleanup(func() { rdb.Close() })
+
+		return NewRedisDao(rdb)
+	})
+}
+
+func TestRedisOptionsFromEnv(t *testing.T) {
+	t.Setenv("REDIS_ADDR", "localhost:26379,localhost:26380")
+	t.Setenv("REDIS_MASTER_NAME", "mymaster")
+	t.Setenv("REDIS_CLUSTER", "")
+
+	opts, cluster := RedisOptionsFromEnv()
+	assert.Equal(t, []string{"localhost:26379", "localhost:26380"}, opts.Addrs)
+	assert.Equal(t, "mymaster", opts.MasterName)
+	assert.False(t, cluster)
+
+	t.Setenv("REDIS_ADDR", "localhost:30001")
+	t.Setenv("REDIS_MASTER_NAME", "")
+	t.Setenv("REDIS_CLUSTER", "true")
+
+	opts, cluster = RedisOptionsFromEnv()
+	assert.Equal(t, []string{"localhost:30001"}, opts.Addrs)
+	assert.True(t, cluster)
+
+	rdb := NewRedisClient(opts, cluster)
+	defer rdb.Close()
+	_, isCluster := rdb.(*redis.ClusterClient)
+	assert.True(t, isCluster)
+}
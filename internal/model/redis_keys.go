@@ -0,0 +1,159 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+const DefaultRedisKeyPrefix = "spreadsheet"
+
+// redisKeys builds the Redis key schema, every key starts with the prefix:
+//
+//	<prefix>:registry                            sorted set of spreadsheet ids
+//	<prefix>:subscription:counter                last subscription id
+//	<prefix>:subscription:<id>                   subscription hash
+//	<prefix>:subscription:<id>:delivery-id       last webhook delivery id
+//	<prefix>:subscription:<id>:deliveries        webhook deliveries by id hash
+//	<prefix>:deliveries:pending                  pending <subscription>:<id> set
+//	<prefix>:sheet:{<sheet>}:cells               cell values hash
+//	<prefix>:sheet:{<sheet>}:results             materialized cell results hash
+//	<prefix>:sheet:{<sheet>}:info                registry entry hash
+//	<prefix>:sheet:{<sheet>}:subscriptions       subscription ids set
+//	<prefix>:sheet:{<sheet>}:webhooks            webhook subscription ids set
+//	<prefix>:sheet:{<sheet>}:dependants          cells having dependants set
+//	<prefix>:sheet:{<sheet>}:dependants:<cell>   dependants of the cell set
+//	<prefix>:sheet:{<sheet>}:history             history entries by time sorted set
+//	<prefix>:sheet:{<sheet>}:history:<cell>      history entries of the cell list
+//	<prefix>:sheet:{<sheet>}:undo                edits to undo list, latest first
+//	<prefix>:sheet:{<sheet>}:redo                edits to redo list, latest first
+//	<prefix>:sheet:{<sheet>}:snapshots           snapshots by name hash
+//	<prefix>:sheet:{<sheet>}:event-id            last event id
+//	<prefix>:sheet:{<sheet>}:events              cells having events set
+//	<prefix>:sheet:{<sheet>}:events:<cell>       latest changes of the cell list
+//	<prefix>:pubsub:{<sheet>}:<cell>             cell change channel
+//
+// Identifiers are lowercased and escaped, so they can not leave their segment
+// or the {} hash tag which keeps keys of a spreadsheet in a single Redis
+// Cluster slot.
+type redisKeys struct {
+	prefix string
+}
+
+// redisKeyEscape percent-encodes characters having a meaning in the schema.
+func redisKeyEscape(id string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(id) {
+		switch r {
+		case '%', ':', '{', '}':
+			fmt.Fprintf(&b, "%%%02X", r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+func (k redisKeys) sheet(spreadsheetId string, suffix string) string {
+	return fmt.Sprintf("%s:sheet:{%s}:%s", k.prefix, redisKeyEscape(spreadsheetId), suffix)
+}
+
+func (k redisKeys) cells(spreadsheetId string) string {
+	return k.sheet(spreadsheetId, "cells")
+}
+
+func (k redisKeys) results(spreadsheetId string) string {
+	return k.sheet(spreadsheetId, "results")
+}
+
+func (k redisKeys) info(spreadsheetId string) string {
+	return k.sheet(spreadsheetId, "info")
+}
+
+func (k redisKeys) sheetSubscriptions(spreadsheetId string) string {
+	return k.sheet(spreadsheetId, "subscriptions")
+}
+
+func (k redisKeys) dependantsIndex(spreadsheetId string) string {
+	return k.sheet(spreadsheetId, "dependants")
+}
+
+func (k redisKeys) dependants(spreadsheetId string, cellId string) string {
+	return k.sheet(spreadsheetId, "dependants:"+redisKeyEscape(cellId))
+}
+
+func (k redisKeys) history(spreadsheetId string) string {
+	return k.sheet(spreadsheetId, "history")
+}
+
+func (k redisKeys) cellHistory(spreadsheetId string, cellId string) string {
+	return k.sheet(spreadsheetId, "history:"+redisKeyEscape(cellId))
+}
+
+func (k redisKeys) edits(spreadsheetId string, stack EditStack) string {
+	return k.sheet(spreadsheetId, stack.String())
+}
+
+func (k redisKeys) snapshots(spreadsheetId string) string {
+	return k.sheet(spreadsheetId, "snapshots")
+}
+
+func (k redisKeys) eventId(spreadsheetId string) string {
+	return k.sheet(spreadsheetId, "event-id")
+}
+
+func (k redisKeys) eventsIndex(spreadsheetId string) string {
+	return k.sheet(spreadsheetId, "events")
+}
+
+func (k redisKeys) events(spreadsheetId string, cellId string) string {
+	return k.sheet(spreadsheetId, "events:"+redisKeyEscape(cellId))
+}
+
+// pubsubPattern matches the channels of every cell of the spreadsheet, glob
+// characters of the id are escaped.
+func (k redisKeys) pubsubPattern(spreadsheetId string) string {
+	var b strings.Builder
+	for _, r := range redisKeyEscape(spreadsheetId) {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+
+	return fmt.Sprintf("%s:pubsub:{%s}:*", k.prefix, b.String())
+}
+
+func (k redisKeys) registry() string {
+	return k.prefix + ":registry"
+}
+
+func (k redisKeys) subscriptionCounter() string {
+	return k.prefix + ":subscription:counter"
+}
+
+// Subscription ids are hexadecimal, the key can not collide with the counter.
+func (k redisKeys) sheetWebhooks(spreadsheetId string) string {
+	return k.sheet(spreadsheetId, "webhooks")
+}
+
+func (k redisKeys) deliveryId(subId string) string {
+	return k.subscription(subId) + ":delivery-id"
+}
+
+func (k redisKeys) deliveries(subId string) string {
+	return k.subscription(subId) + ":deliveries"
+}
+
+func (k redisKeys) pendingDeliveries() string {
+	return k.prefix + ":deliveries:pending"
+}
+
+func (k redisKeys) subscription(id string) string {
+	return fmt.Sprintf("%s:subscription:%s", k.prefix, id)
+}
+
+func (k redisKeys) pubsub(spreadsheetId string, cellId string) string {
+	return fmt.Sprintf("%s:pubsub:{%s}:%s", k.prefix, redisKeyEscape(spreadsheetId), redisKeyEscape(cellId))
+}
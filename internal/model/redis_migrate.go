@@ -0,0 +1,185 @@
+package model
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Keys of the legacy layout, spreadsheet ids were used as keys as is.
+const (
+	legacySubscriptionCounterKey = "subscription:counter"
+	legacySubscriptionPrefix     = "subscription:"
+	legacySheetSubscriptionsKey  = "subscription:sheet:"
+	legacyRegistryIndexKey       = "registry:index"
+	legacyRegistryPrefix         = "registry:sheet:"
+)
+
+// RedisMigrationStats counts the legacy keys handled by MigrateLegacyKeys.
+type RedisMigrationStats struct {
+	Spreadsheets  int
+	Dependants    int
+	Subscriptions int
+	Skipped       int
+}
+
+// MigrateLegacyKeys copies spreadsheets stored with the legacy unprefixed key
+// layout to the current schema, legacy keys are removed when deleteOld is set.
+// Legacy keys are told apart by their types and fields, so it must run while
+// the service is stopped. Keys already under the prefix are left untouched,
+// the migration could be repeated.
+func (dao *RedisDao) MigrateLegacyKeys(deleteOld bool) (RedisMigrationStats, error) {
+	var stats RedisMigrationStats
+	sheets := make(map[string]struct{})
+
+	migrate := func(ctx context.Context, rdb redis.Cmdable) error {
+		iter := rdb.Scan(ctx, 0, "*", 1000).Iterator()
+		for iter.Next(ctx) {
+			key := iter.Val()
+			if strings.HasPrefix(key, dao.keys.prefix+":") {
+				continue
+			}
+
+			migrated, err := dao.migrateLegacyKey(key, &stats, sheets)
+			if err != nil {
+				return err
+			}
+			if !migrated {
+				log.Printf("Skipped unknown key %q", key)
+				stats.Skipped++
+				continue
+			}
+
+			if deleteOld {
+				if err := dao.rdb.Del(ctx, key).Err(); err != nil {
+					return err
+				}
+			}
+		}
+
+		return iter.Err()
+	}
+
+	// SCAN of a cluster client would visit a single node only.
+	var err error
+	if cluster, ok := dao.rdb.(*redis.ClusterClient); ok {
+		var mu sync.Mutex
+		err = cluster.ForEachMaster(ctx, func(ctx context.Context, master *redis.Client) error {
+			mu.Lock()
+			defer mu.Unlock()
+			return migrate(ctx, master)
+		})
+	} else {
+		err = migrate(ctx, dao.rdb)
+	}
+	if err != nil {
+		return stats, err
+	}
+
+	// Spreadsheets created before the registry existed get registered now.
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	for sheetId := range sheets {
+		_, err := dao.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.ZAdd(ctx, dao.keys.registry(), redis.Z{Member: sheetId})
+			pipe.HSetNX(ctx, dao.keys.info(sheetId), "createdAt", now)
+			pipe.HSetNX(ctx, dao.keys.info(sheetId), "updatedAt", now)
+			pipe.HSetNX(ctx, dao.keys.info(sheetId), "owner", "")
+			return nil
+		})
+		if err != nil {
+			return stats, err
+		}
+	}
+
+	return stats, nil
+}
+
+func (dao *RedisDao) migrateLegacyKey(key string, stats *RedisMigrationStats, sheets map[string]struct{}) (bool, error) {
+	keyType, err := dao.rdb.Type(ctx, key).Result()
+	if err != nil {
+		return false, err
+	}
+
+	switch {
+	case keyType == "string" && key == legacySubscriptionCounterKey:
+		counter, err := dao.rdb.Get(ctx, key).Int64()
+		if err != nil {
+			return false, err
+		}
+
+		current, err := dao.rdb.Get(ctx, dao.keys.subscriptionCounter()).Int64()
+		if err != nil && err != redis.Nil {
+			return false, err
+		}
+		if counter > current {
+			if err := dao.rdb.Set(ctx, dao.keys.subscriptionCounter(), counter, 0).Err(); err != nil {
+				return false, err
+			}
+		}
+
+		return true, nil
+
+	case keyType == "hash":
+		data, err := dao.rdb.HGetAll(ctx, key).Result()
+		if err != nil {
+			return false, err
+		}
+
+		// Spreadsheets may be named like the other legacy keys, hashes are
+		// told apart by their fields. Cell ids are stored in lower case and
+		// can not collide with the camel case fields.
+		switch {
+		case strings.HasPrefix(key, legacySubscriptionPrefix) && data["spreadsheetId"] != "" && data["cellId"] != "":
+			stats.Subscriptions++
+			subId := strings.TrimPrefix(key, legacySubscriptionPrefix)
+			return true, dao.rdb.HSet(ctx, dao.keys.subscription(subId), data).Err()
+
+		case strings.HasPrefix(key, legacyRegistryPrefix) && data["createdAt"] != "":
+			sheetId := strings.TrimPrefix(key, legacyRegistryPrefix)
+			sheets[sheetId] = struct{}{}
+			return true, dao.rdb.HSet(ctx, dao.keys.info(sheetId), data).Err()
+		}
+
+		stats.Spreadsheets++
+		sheets[key] = struct{}{}
+		return true, dao.rdb.HSet(ctx, dao.keys.cells(key), data).Err()
+
+	case keyType == "set" && strings.Contains(key, "/"):
+		// Cell ids can not contain "/", the last one separates the spreadsheet.
+		sep := strings.LastIndex(key, "/")
+		dependants, err := dao.rdb.SMembers(ctx, key).Result()
+		if err != nil {
+			return false, err
+		}
+
+		stats.Dependants++
+		_, err = dao.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, dependantId := range dependants {
+				if err := dao.addDependatFormula(pipe, key[:sep], dependantId, []string{key[sep+1:]}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		return true, err
+
+	case keyType == "set" && strings.HasPrefix(key, legacySheetSubscriptionsKey):
+		subIds, err := dao.rdb.SMembers(ctx, key).Result()
+		if err != nil {
+			return false, err
+		}
+
+		sheetId := strings.TrimPrefix(key, legacySheetSubscriptionsKey)
+		return true, dao.rdb.SAdd(ctx, dao.keys.sheetSubscriptions(sheetId), subIds).Err()
+
+	case keyType == "zset" && key == legacyRegistryIndexKey:
+		// Rebuilt from the registry entries.
+		return true, nil
+	}
+
+	return false, nil
+}
@@ -0,0 +1,230 @@
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func prepareRedis(t *testing.T) *RedisDao {
+	server := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	return NewRedisDao(rdb)
+}
+
+func TestRedisCells(t *testing.T) {
+	testDaoCells(t, prepareRedis(t))
+}
+
+func TestRedisDependants(t *testing.T) {
+	testDaoDependants(t, prepareRedis(t))
+}
+
+func TestRedisSubscription(t *testing.T) {
+	testDaoSubscription(t, prepareRedis(t))
+}
+
+func TestRedisSubscribeSpreadsheet(t *testing.T) {
+	testDaoSubscribeSpreadsheet(t, prepareRedis(t))
+}
+
+func TestRedisUpdate(t *testing.T) {
+	testDaoUpdate(t, prepareRedis(t))
+}
+
+func TestRedisDependencyIndex(t *testing.T) {
+	testDaoDependencyIndex(t, prepareRedis(t))
+}
+
+func TestRedisDependantsGraph(t *testing.T) {
+	testDaoDependantsGraph(t, prepareRedis(t))
+}
+
+func TestRedisDeleteSpreadsheet(t *testing.T) {
+	testDaoDeleteSpreadsheet(t, prepareRedis(t))
+}
+
+func TestRedisRegistry(t *testing.T) {
+	testDaoRegistry(t, prepareRedis(t))
+}
+
+func TestRedisHistory(t *testing.T) {
+	testDaoHistory(t, prepareRedis(t))
+}
+
+func TestRedisEdits(t *testing.T) {
+	testDaoEdits(t, prepareRedis(t))
+}
+
+func TestRedisSnapshots(t *testing.T) {
+	testDaoSnapshots(t, prepareRedis(t))
+}
+
+func TestRedisIterativeCalculation(t *testing.T) {
+	testDaoIterativeCalculation(t, prepareRedis(t))
+}
+
+func TestRedisResults(t *testing.T) {
+	testDaoResults(t, prepareRedis(t))
+}
+
+func TestRedisSpreadsheetState(t *testing.T) {
+	testDaoSpreadsheetState(t, prepareRedis(t))
+}
+
+func TestRedisCellEvents(t *testing.T) {
+	testDaoCellEvents(t, prepareRedis(t))
+}
+
+func TestRedisWebhooks(t *testing.T) {
+	testDaoWebhooks(t, prepareRedis(t))
+}
+
+func TestRedisKeySchema(t *testing.T) {
+	keys := redisKeys{prefix: "spreadsheet"}
+
+	assert.Equal(t, "spreadsheet:sheet:{devchallenge-xx}:cells", keys.cells("DevChallenge-XX"))
+	assert.Equal(t, "spreadsheet:sheet:{devchallenge-xx}:dependants:var1", keys.dependants("devchallenge-xx", "VAR1"))
+	assert.Equal(t, "spreadsheet:sheet:{a%7D%3Acells}:cells", keys.cells("a}:cells"))
+	assert.Equal(t, "spreadsheet:pubsub:{a%25b}:c%7Bd", keys.pubsub("a%b", "c{d"))
+	assert.Equal(t, `spreadsheet:pubsub:{a\*b\[c\]%7D}:*`, keys.pubsubPattern("A*b[c]}"))
+}
+
+func TestRedisKeyCollisions(t *testing.T) {
+	dao := prepareRedis(t)
+
+	for _, sheetId := range []string{"subscription:counter", "registry", "a}:cells", "{a}"} {
+		assert.NoError(t, dao.Update(sheetId, func(batch *Batch) error {
+			batch.SetCell("var1", "1")
+			batch.SetCell("var:2", "=var1")
+			batch.AddDependatFormula("var:2", []string{"var1"})
+			return nil
+		}))
+	}
+
+	id, err := dao.CreateSubscription("subscription:counter", "var1")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", id)
+
+	for _, sheetId := range []string{"subscription:counter", "registry", "a}:cells", "{a}"} {
+		cells, err := dao.GetAllCells(sheetId)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"var1": "1", "var:2": "=var1"}, cells)
+
+		index, err := dao.GetDependencyIndex(sheetId)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string][]string{"var1": {"var:2"}}, index)
+	}
+
+	infos, err := dao.ListSpreadsheets("", "", 10)
+	assert.NoError(t, err)
+	assert.Len(t, infos, 4)
+}
+
+func TestRedisKeyPrefix(t *testing.T) {
+	server := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	dao := NewRedisDaoWithPrefix(rdb, "one")
+	otherDao := NewRedisDaoWithPrefix(rdb, "two")
+
+	assert.NoError(t, dao.SetCell("devchallenge-xx", "var1", "1"))
+
+	exists, err := otherDao.IsSpreadsheetExists("devchallenge-xx")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	for _, key := range server.Keys() {
+		assert.True(t, strings.HasPrefix(key, "one:"), key)
+	}
+}
+
+func TestRedisMigrateLegacyKeys(t *testing.T) {
+	server := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	server.HSet("devchallenge-xx", "var1", "1")
+	server.HSet("devchallenge-xx", "var2", "=var1")
+	server.SAdd("devchallenge-xx/var1", "var2")
+	server.Set("subscription:counter", "10")
+	server.HSet("subscription:a", "spreadsheetId", "devchallenge-xx")
+	server.HSet("subscription:a", "cellId", "var2")
+	server.SAdd("subscription:sheet:devchallenge-xx", "a")
+	server.Lpush("unknown", "value")
+
+	dao := NewRedisDao(rdb)
+	stats, err := dao.MigrateLegacyKeys(true)
+	assert.NoError(t, err)
+	assert.Equal(t, RedisMigrationStats{Spreadsheets: 1, Dependants: 1, Subscriptions: 1, Skipped: 1}, stats)
+
+	cells, err := dao.GetAllCells("devchallenge-xx")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"var1": "1", "var2": "=var1"}, cells)
+
+	index, err := dao.GetDependencyIndex("devchallenge-xx")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{"var1": {"var2"}}, index)
+
+	data, err := dao.GetSubscription("a")
+	assert.NoError(t, err)
+	assert.Equal(t, "var2", data["cellId"])
+
+	id, err := dao.CreateSubscription("devchallenge-xx", "var1")
+	assert.NoError(t, err)
+	assert.Equal(t, "b", id)
+
+	info, err := dao.GetSpreadsheetInfo("devchallenge-xx")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, info.CellCount)
+
+	assert.False(t, server.Exists("devchallenge-xx"))
+	assert.True(t, server.Exists("unknown"))
+
+	assert.NoError(t, dao.DeleteSpreadsheet("devchallenge-xx"))
+	_, err = dao.GetSubscription("a")
+	assert.Equal(t, ERROR_NO_SUBSCRIPTION, err)
+}
+
+func TestRedisMigrateLegacyKeysSubscriptionName(t *testing.T) {
+	server := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	server.HSet("subscription:1", "var1", "1")
+	server.HSet("subscription:1", "var2", "=var1")
+	server.SAdd("subscription:1/var1", "var2")
+	server.HSet("subscription:2", "spreadsheetId", "subscription:1")
+	server.HSet("subscription:2", "cellId", "var2")
+	server.SAdd("subscription:sheet:subscription:1", "2")
+
+	dao := NewRedisDao(rdb)
+	stats, err := dao.MigrateLegacyKeys(true)
+	assert.NoError(t, err)
+	assert.Equal(t, RedisMigrationStats{Spreadsheets: 1, Dependants: 1, Subscriptions: 1}, stats)
+
+	cells, err := dao.GetAllCells("subscription:1")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"var1": "1", "var2": "=var1"}, cells)
+
+	index, err := dao.GetDependencyIndex("subscription:1")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{"var1": {"var2"}}, index)
+
+	data, err := dao.GetSubscription("2")
+	assert.NoError(t, err)
+	assert.Equal(t, "subscription:1", data["spreadsheetId"])
+
+	_, err = dao.GetSubscription("1")
+	assert.Equal(t, ERROR_NO_SUBSCRIPTION, err)
+
+	exists, err := dao.IsSpreadsheetExists("subscription:1")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+}
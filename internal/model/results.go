@@ -0,0 +1,54 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+var ERROR_NO_RESULT = errors.New("Result is not materialized")
+
+// Result is the evaluated cell materialized at write time, so a read does
+// not evaluate formulas. Value is the raw cell value the result belongs to.
+type Result struct {
+	Value  string `json:"value"`
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+// CellChange is the notification of a changed cell result. Old is absent
+// when the cell had no materialized result, New when the cell is deleted.
+// Truncated changes omit both results as they do not fit the notification,
+// subscribers read the cell instead. EventId is assigned by the event log,
+// the ids of a spreadsheet increase.
+type CellChange struct {
+	EventId   int64   `json:"eventId,omitempty"`
+	CellId    string  `json:"cellId"`
+	Old       *Result `json:"old,omitempty"`
+	New       *Result `json:"new,omitempty"`
+	Truncated bool    `json:"truncated,omitempty"`
+}
+
+// SetResult stores the result of the cell together with the batch cells.
+func (b *Batch) SetResult(cellId string, result Result) {
+	data, _ := json.Marshal(result)
+	b.ops = append(b.ops, batchOp{kind: batchSetResult, cellId: strings.ToLower(cellId), value: string(data)})
+}
+
+// DeleteResult removes the result of the cell, the cell is evaluated on read.
+func (b *Batch) DeleteResult(cellId string) {
+	b.ops = append(b.ops, batchOp{kind: batchDeleteResult, cellId: strings.ToLower(cellId)})
+}
+
+func marshalCellChange(change CellChange) string {
+	change.CellId = strings.ToLower(change.CellId)
+	data, _ := json.Marshal(change)
+	return string(data)
+}
+
+func unmarshalResult(data string) (Result, error) {
+	var result Result
+	err := json.Unmarshal([]byte(data), &result)
+
+	return result, err
+}
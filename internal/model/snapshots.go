@@ -0,0 +1,29 @@
+package model
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+var ERROR_NO_SNAPSHOT = errors.New("Unknown snapshot")
+var ERROR_SNAPSHOT_EXISTS = errors.New("Snapshot already exists")
+
+// Snapshot is a named copy of the raw cell values of a spreadsheet. Names are
+// case insensitive and unique within the spreadsheet.
+type Snapshot struct {
+	Name      string            `json:"name"`
+	Author    string            `json:"author,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+	Cells     map[string]string `json:"cells"`
+}
+
+// sortSnapshots orders snapshots from the oldest one.
+func sortSnapshots(snapshots []Snapshot) {
+	sort.Slice(snapshots, func(i, j int) bool {
+		if !snapshots[i].CreatedAt.Equal(snapshots[j].CreatedAt) {
+			return snapshots[i].CreatedAt.Before(snapshots[j].CreatedAt)
+		}
+		return snapshots[i].Name < snapshots[j].Name
+	})
+}
@@ -0,0 +1,73 @@
+package model
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// MaxDeliveries is the number of the latest webhook deliveries kept for a
+// subscription, failed ones included.
+const MaxDeliveries = 100
+
+// Statuses of a webhook delivery, failed deliveries are given up after the
+// last attempt and form the dead-letter list.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook is a subscription delivering the changes of the cell to the
+// callback url, requests are signed with the secret.
+type Webhook struct {
+	SubscriptionId string
+	SpreadsheetId  string
+	CellId         string
+	Url            string
+	Secret         string
+}
+
+// Delivery is a cell change sent to a webhook with the outcome of its
+// attempts. Ids increase within a subscription.
+type Delivery struct {
+	Id             int64           `json:"id"`
+	SubscriptionId string          `json:"subscriptionId"`
+	SpreadsheetId  string          `json:"spreadsheetId"`
+	CellId         string          `json:"cellId"`
+	EventId        int64           `json:"eventId,omitempty"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	ResponseStatus int             `json:"responseStatus,omitempty"`
+	Error          string          `json:"error,omitempty"`
+	Payload        json.RawMessage `json:"payload"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	UpdatedAt      time.Time       `json:"updatedAt"`
+	NextAttemptAt  *time.Time      `json:"nextAttemptAt,omitempty"`
+}
+
+// sortDeliveries orders the deliveries by subscription and id.
+func sortDeliveries(deliveries []Delivery) {
+	sort.Slice(deliveries, func(i, j int) bool {
+		if deliveries[i].SubscriptionId != deliveries[j].SubscriptionId {
+			return deliveries[i].SubscriptionId < deliveries[j].SubscriptionId
+		}
+		return deliveries[i].Id < deliveries[j].Id
+	})
+}
+
+// WebhookFromSubscription returns the webhook of the subscription data,
+// ok is false for pull subscriptions.
+func WebhookFromSubscription(subId string, data map[string]string) (webhook Webhook, ok bool) {
+	if data["callbackUrl"] == "" {
+		return Webhook{}, false
+	}
+
+	return Webhook{
+		SubscriptionId: subId,
+		SpreadsheetId:  data["spreadsheetId"],
+		CellId:         data["cellId"],
+		Url:            data["callbackUrl"],
+		Secret:         data["secret"],
+	}, true
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"devchallenge.it/spreadsheet/internal/model"
+	"github.com/gorilla/mux"
+)
+
+type BatchUpsertPayload map[string]UpsertPayload
+
+// batchUpsert stores all the cells or none of them. Response contains result
+// of every cell, so the failing ones could be found.
+func (s *Service) batchUpsert(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sheetId := vars["sheet_id"]
+
+	contentType := r.Header.Get("Content-Type")
+	if strings.Compare(contentType, "application/json") != 0 {
+		log.Printf("Upsert invalid content type %s", contentType)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var payload BatchUpsertPayload
+	if err := NewJsonDecoder(r.Body).Decode(&payload); err != nil {
+		log.Printf("Body decode error: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if len(payload) == 0 {
+		log.Print("Batch upsert without cells")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	values := make(map[string]string, len(payload))
+	for cellId, cell := range payload {
+		if !IsVariable(cellId) {
+			log.Printf("Cell ID %q is not valid variable", cellId)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if IsReservedCellId(cellId) {
+			log.Printf("Cell ID %q is reserved", cellId)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		cellId = strings.ToLower(cellId)
+		if _, exists := values[cellId]; exists {
+			log.Printf("Cell ID %q is duplicated", cellId)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		values[cellId] = cell.Value
+	}
+
+	results, stored, err := s.storeCells(sheetId, requestOrigin(w, r), values)
+	if err != nil {
+		log.Print(err)
+		if err == model.ERROR_UPDATE_CONFLICT {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	resp := make(SpreadsheetResponse, len(results))
+	for cellId, cell := range results {
+		resp[cellId] = NewCellResponse(cell)
+	}
+
+	responseStatus := http.StatusUnprocessableEntity
+	if stored {
+		responseStatus = http.StatusCreated
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(responseStatus)
+	json.NewEncoder(w).Encode(&resp)
+}
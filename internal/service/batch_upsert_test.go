@@ -0,0 +1,148 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func PostCells(router *mux.Router, sheetId string, values map[string]string) *httptest.ResponseRecorder {
+	payload := make(BatchUpsertPayload)
+	for cellId, value := range values {
+		payload[cellId] = UpsertPayload{value}
+	}
+	jsonBody, _ := json.Marshal(payload)
+
+	request, _ := http.NewRequest(http.MethodPost, "/"+sheetId, bytes.NewReader(jsonBody))
+	request.Header.Add("Content-Type", "application/json")
+	response := httptest.NewRecorder()
+
+	router.ServeHTTP(response, request)
+
+	return response
+}
+
+func TestBatchUpsert(t *testing.T) {
+	router, dao := NewMiniredisTestContext(t)
+
+	response := PostCells(router, "devchallenge-xx", map[string]string{
+		"var3": "=var1 + var2",
+		"VAR2": "=var1 * 2",
+		"var1": "1",
+	})
+	assert.Equal(t, http.StatusCreated, response.Code)
+
+	var resp SpreadsheetResponse
+	json.NewDecoder(response.Body).Decode(&resp)
+
+	wantResp := SpreadsheetResponse{
+		"var1": CellResponse{Value: "1", Result: "1"},
+		"var2": CellResponse{Value: "=var1 * 2", Result: "2"},
+		"var3": CellResponse{Value: "=var1 + var2", Result: "3"},
+	}
+	if diff := deep.Equal(resp, wantResp); diff != nil {
+		t.Error(diff)
+	}
+
+	deps, err := dao.GetDependants("devchallenge-xx", "var1")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"var2", "var3"}, deps)
+}
+
+func TestBatchUpsertAllOrNothing(t *testing.T) {
+	router, dao := NewMiniredisTestContext(t)
+
+	response := PostCells(router, "devchallenge-xx", map[string]string{
+		"var1": "0",
+		"var2": "=1 / var1",
+		"var3": "=var1 + 1",
+	})
+	assert.Equal(t, http.StatusUnprocessableEntity, response.Code)
+
+	var resp SpreadsheetResponse
+	json.NewDecoder(response.Body).Decode(&resp)
+
+	assert.Len(t, resp, 3)
+	assert.Equal(t, "ERROR", resp["var2"].Result)
+	assert.NotNil(t, resp["var2"].Error)
+	assert.Equal(t, "1", resp["var3"].Result)
+	assert.Nil(t, resp["var3"].Error)
+
+	exists, err := dao.IsSpreadsheetExists("devchallenge-xx")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestBatchUpsertBreakDependant(t *testing.T) {
+	router, dao := NewMiniredisTestContext(t)
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "1").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var2", "=1 / var1").Code)
+
+	response := PostCells(router, "devchallenge-xx", map[string]string{
+		"var1": "0",
+		"var3": "2",
+	})
+	assert.Equal(t, http.StatusUnprocessableEntity, response.Code)
+
+	cells, err := dao.GetAllCells("devchallenge-xx")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"var1": "1", "var2": "=1 / var1"}, cells)
+
+	// Fixing the dependant in the same batch makes it valid
+	response = PostCells(router, "devchallenge-xx", map[string]string{
+		"var1": "0",
+		"var2": "=1 / (var1 + 1)",
+	})
+	assert.Equal(t, http.StatusCreated, response.Code)
+}
+
+func TestBatchUpsertInvalidPayload(t *testing.T) {
+	router, _ := NewMiniredisTestContext(t)
+
+	assert.Equal(t, http.StatusBadRequest, PostCells(router, "devchallenge-xx", map[string]string{}).Code)
+	assert.Equal(t, http.StatusBadRequest, PostCells(router, "devchallenge-xx", map[string]string{"var+1": "1"}).Code)
+	assert.Equal(t, http.StatusBadRequest, PostCells(router, "devchallenge-xx", map[string]string{
+		"var1": "1",
+		"VAR1": "2",
+	}).Code)
+}
+
+func TestBatchUpsertNotifiesOnce(t *testing.T) {
+	router, dao := NewMiniredisTestContext(t)
+
+	assert.Equal(t, http.StatusCreated, PostCells(router, "devchallenge-xx", map[string]string{
+		"var1": "1",
+		"var2": "2",
+		"var3": "=var1 + var2",
+	}).Code)
+
+	subId, err := dao.CreateSubscription("devchallenge-xx", "var3")
+	assert.NoError(t, err)
+	subscriber, err := dao.Subscribe(subId)
+	assert.NoError(t, err)
+	defer subscriber.Close()
+
+	assert.Equal(t, http.StatusCreated, PostCells(router, "devchallenge-xx", map[string]string{
+		"var1": "3",
+		"var2": "4",
+	}).Code)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = subscriber.ReceiveMessage(ctx)
+	assert.NoError(t, err)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = subscriber.ReceiveMessage(ctx)
+	assert.Error(t, err)
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"devchallenge.it/spreadsheet/internal/formula"
+	"devchallenge.it/spreadsheet/internal/model"
+	"github.com/gorilla/mux"
+)
+
+var errSpreadsheetExists = errors.New("Spreadsheet already exists")
+
+type CopyPayload struct {
+	Id string
+
+	// Makes EXTERNAL_REF urls of the source spreadsheet cells refer to the
+	// copy cells.
+	RewriteReferences bool `json:"rewrite_references"`
+}
+
+// copySpreadsheet creates a new spreadsheet with the cells and the settings
+// of the source one. The source cells are read at once, so the copy is
+// consistent while the source is written.
+func (s *Service) copySpreadsheet(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sheetId := vars["sheet_id"]
+
+	contentType := r.Header.Get("Content-Type")
+	if strings.Compare(contentType, "application/json") != 0 {
+		log.Printf("Copy invalid content type %s", contentType)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var payload CopyPayload
+	if err := NewJsonDecoder(r.Body).Decode(&payload); err != nil {
+		log.Printf("Body decode error: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if !isResourceName(payload.Id) || strings.EqualFold(payload.Id, sheetId) {
+		log.Printf("Copy id %q is not valid", payload.Id)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	cells, err := s.dao.GetAllCells(sheetId)
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if len(cells) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var source model.SpreadsheetInfo
+	if source, err = s.dao.GetSpreadsheetInfo(sheetId); err != nil && err != model.ERROR_NO_SPREADSHEET {
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if payload.RewriteReferences {
+		for cellId, value := range cells {
+			cells[cellId] = formula.RewriteExternalRefs(value, func(ref string) string {
+				return rewriteSpreadsheetRef(ref, sheetId, payload.Id)
+			})
+		}
+	}
+
+	origin := requestOrigin(w, r)
+	err = s.dao.Update(payload.Id, func(batch *model.Batch) error {
+		exists, err := s.dao.IsSpreadsheetExists(payload.Id)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return errSpreadsheetExists
+		}
+
+		batch.SetOrigin(origin)
+		batch.SetTitle(source.Title)
+		batch.SetIterativeCalculation(source.IterativeCalculation)
+		for cellId, value := range cells {
+			batch.SetCell(cellId, value)
+			updateDependencies(batch, cellId, "", value)
+		}
+
+		_, err = materializeSpreadsheet(batch, payload.Id, cells, nil, source.IterativeCalculation)
+		return err
+	})
+	if err != nil {
+		switch err {
+		case errSpreadsheetExists:
+			w.WriteHeader(http.StatusConflict)
+		case model.ERROR_UPDATE_CONFLICT:
+			log.Print(err)
+			w.WriteHeader(http.StatusConflict)
+		default:
+			log.Print(err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	info, err := s.dao.GetSpreadsheetInfo(payload.Id)
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	resp := NewSpreadsheetInfoResponse(info)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(&resp)
+}
+
+// rewriteSpreadsheetRef replaces the spreadsheet id of the cell url when it
+// refers to the given spreadsheet, e.g. http://host/api/v1/<from>/<cell>.
+// Other urls are returned as is.
+func rewriteSpreadsheetRef(ref string, from string, to string) string {
+	refUrl, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+
+	segments := strings.Split(refUrl.Path, "/")
+	if len(segments) < 2 || !strings.EqualFold(segments[len(segments)-2], from) {
+		return ref
+	}
+
+	segments[len(segments)-2] = url.PathEscape(to)
+	refUrl.Path = strings.Join(segments, "/")
+	refUrl.RawPath = ""
+
+	return refUrl.String()
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func PostCopy(router *mux.Router, sheetId string, payload CopyPayload) *httptest.ResponseRecorder {
+	jsonBody, _ := json.Marshal(payload)
+
+	request, _ := http.NewRequest(http.MethodPost, "/"+sheetId+"/copy", bytes.NewReader(jsonBody))
+	request.Header.Add("Content-Type", "application/json")
+	response := httptest.NewRecorder()
+
+	router.ServeHTTP(response, request)
+
+	return response
+}
+
+func TestCopySpreadsheet(t *testing.T) {
+	router, dao := NewMiniredisTestContext(t)
+
+	assert.Equal(t, http.StatusNotFound, PostCopy(router, "devchallenge-xx", CopyPayload{Id: "fork"}).Code)
+
+	assert.Equal(t, http.StatusCreated, PostCells(router, "devchallenge-xx", map[string]string{
+		"var1": "1",
+		"var2": "=var1 + 1",
+	}).Code)
+	// External references are stored as is, they are not resolved in tests
+	assert.NoError(t, dao.SetCell("devchallenge-xx", "var3", "=EXTERNAL_REF(http://localhost:8080/api/v1/devchallenge-xx/var1)"))
+
+	response := PostCopy(router, "devchallenge-xx", CopyPayload{Id: "Fork"})
+	assert.Equal(t, http.StatusCreated, response.Code)
+
+	var info SpreadsheetInfoResponse
+	json.NewDecoder(response.Body).Decode(&info)
+	assert.Equal(t, "fork", info.Id)
+	assert.Equal(t, 3, info.CellCount)
+
+	source, err := dao.GetAllCells("devchallenge-xx")
+	assert.NoError(t, err)
+	cells, err := dao.GetAllCells("fork")
+	assert.NoError(t, err)
+	assert.Equal(t, source, cells)
+
+	index, err := dao.GetDependencyIndex("fork")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{"var1": {"var2"}}, index)
+
+	// The fork is independent of the source
+	assert.Equal(t, http.StatusCreated, PostCell(router, "fork", "var1", "10").Code)
+	value, err := dao.GetCell("devchallenge-xx", "var1")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", value)
+
+	assert.Equal(t, http.StatusConflict, PostCopy(router, "devchallenge-xx", CopyPayload{Id: "fork"}).Code)
+	assert.Equal(t, http.StatusBadRequest, PostCopy(router, "devchallenge-xx", CopyPayload{Id: "DevChallenge-XX"}).Code)
+	assert.Equal(t, http.StatusBadRequest, PostCopy(router, "devchallenge-xx", CopyPayload{}).Code)
+}
+
+func TestCopySpreadsheetRewriteReferences(t *testing.T) {
+	router, dao := NewMiniredisTestContext(t)
+
+	assert.NoError(t, dao.SetCell("devchallenge-xx", "var1", "1"))
+	assert.NoError(t, dao.SetCell("devchallenge-xx", "var2", "=EXTERNAL_REF(http://localhost:8080/api/v1/DevChallenge-XX/var1) + 1"))
+	assert.NoError(t, dao.SetCell("devchallenge-xx", "var3", "=EXTERNAL_REF(http://localhost:8080/api/v1/devchallenge-yy/var1)"))
+
+	response := PostCopy(router, "devchallenge-xx", CopyPayload{Id: "fork", RewriteReferences: true})
+	assert.Equal(t, http.StatusCreated, response.Code)
+
+	cells, err := dao.GetAllCells("fork")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"var1": "1",
+		"var2": "=EXTERNAL_REF(http://localhost:8080/api/v1/fork/var1) + 1",
+		"var3": "=EXTERNAL_REF(http://localhost:8080/api/v1/devchallenge-yy/var1)",
+	}, cells)
+}
+
+func TestCopySpreadsheetConcurrentWrites(t *testing.T) {
+	router, dao := NewMiniredisTestContext(t)
+
+	assert.Equal(t, http.StatusCreated, PostCells(router, "devchallenge-xx", map[string]string{
+		"var1": "0",
+		"var2": "0",
+	}).Code)
+
+	// Both cells are always written together
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= 20; i++ {
+			PostCells(router, "devchallenge-xx", map[string]string{
+				"var1": fmt.Sprint(i),
+				"var2": fmt.Sprint(i),
+			})
+		}
+	}()
+
+	for i := 0; i < 10; i++ {
+		forkId := fmt.Sprintf("fork-%d", i)
+		assert.Equal(t, http.StatusCreated, PostCopy(router, "devchallenge-xx", CopyPayload{Id: forkId}).Code)
+
+		cells, err := dao.GetAllCells(forkId)
+		assert.NoError(t, err)
+		assert.Equal(t, cells["var1"], cells["var2"])
+	}
+	wg.Wait()
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"devchallenge.it/spreadsheet/internal/formula"
+	"devchallenge.it/spreadsheet/internal/model"
+	"github.com/gorilla/mux"
+)
+
+func (s *Service) deleteCell(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sheetId := vars["sheet_id"]
+	cellId := vars["cell_id"]
+
+	if !IsVariable(cellId) {
+		log.Printf("Cell ID %q is not valid variable", cellId)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	cascade := false
+	if cascadeParam := r.URL.Query().Get("cascade"); cascadeParam != "" {
+		var err error
+		cascade, err = strconv.ParseBool(cascadeParam)
+		if err != nil {
+			log.Printf("Invalid cascade parameter %q", cascadeParam)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	var resp CellResponse
+	var formulaError error
+	var changes []model.CellChange
+	found := true
+
+	origin := requestOrigin(w, r)
+	err := s.dao.Update(sheetId, func(batch *model.Batch) (err error) {
+		solver, err := s.newSolver(s.dao, sheetId)
+		if err != nil {
+			return
+		}
+
+		resp.Result, resp.Value, formulaError, err = solver.Solve(cellId)
+		if err != nil {
+			return
+		}
+
+		found = !formula.IsMissingCell(resp.Value, formulaError)
+		formulaError = nil
+		if !found {
+			return
+		}
+
+		solver.DeleteCell(cellId)
+		graph, affected, err := s.readDependants(sheetId, []string{cellId})
+		if err != nil {
+			return
+		}
+		materialized, err := s.dao.GetResults(sheetId, append([]string{cellId}, affected...))
+		if err != nil {
+			return
+		}
+		if !cascade {
+			formulaErrors, err := solveDependants(solver, affected)
+			if err != nil {
+				return err
+			}
+			if formulaError = brokenDependant(graph, cellId, formulaErrors, materialized); formulaError != nil {
+				return nil
+			}
+		}
+
+		batch.SetOrigin(origin)
+		batch.DeleteCell(cellId)
+		updateDependencies(batch, cellId, resp.Value, "")
+
+		if changes, err = changedResults(solver, materialized, []string{cellId}, affected); err != nil {
+			return
+		}
+		batch.PublishCellChanges(changes)
+
+		return materializeResults(batch, solver, materialized, append([]string{cellId}, affected...))
+	})
+	if err != nil {
+		log.Print(err)
+		if err == model.ERROR_UPDATE_CONFLICT {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if formulaError != nil {
+		resp.Error = new(string)
+		*resp.Error = formulaError.Error()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(&resp)
+		return
+	}
+
+	s.enqueueWebhooks(sheetId, changes)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Service) deleteSpreadsheet(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sheetId := vars["sheet_id"]
+
+	keys, err := s.dao.GetSpreadeetKeys(sheetId)
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if len(keys) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if err := s.dao.DeleteSpreadsheet(sheetId); err != nil {
+		log.Print(err)
+		if err == model.ERROR_UPDATE_CONFLICT {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Wake up subscribers of the removed cells so their streams are closed
+	for _, cellId := range keys {
+		s.dao.NotifyCellChange(sheetId, model.CellChange{CellId: cellId})
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"devchallenge.it/spreadsheet/internal/formula"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func Delete(router *mux.Router, path string) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest(http.MethodDelete, path, nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+
+	return response
+}
+
+func TestDeleteCell(t *testing.T) {
+	router, dao := NewMiniredisTestContext(t)
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "1").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var2", "=var1").Code)
+
+	assert.Equal(t, http.StatusNoContent, Delete(router, "/devchallenge-xx/VAR2").Code)
+	assert.Equal(t, http.StatusNotFound, Delete(router, "/devchallenge-xx/var2").Code)
+
+	deps, err := dao.GetDependants("devchallenge-xx", "var1")
+	assert.NoError(t, err)
+	assert.Empty(t, deps)
+
+	assert.Equal(t, http.StatusNoContent, Delete(router, "/devchallenge-xx/var1").Code)
+
+	exists, err := dao.IsSpreadsheetExists("devchallenge-xx")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestDeleteCellBreaksDependant(t *testing.T) {
+	router, dao := NewMiniredisTestContext(t)
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "1").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var2", "=var1 + 1").Code)
+
+	response := Delete(router, "/devchallenge-xx/var1")
+	assert.Equal(t, http.StatusUnprocessableEntity, response.Code)
+
+	var resp CellResponse
+	json.NewDecoder(response.Body).Decode(&resp)
+	assert.Equal(t, "1", resp.Value)
+	if assert.NotNil(t, resp.Error) {
+		assert.Equal(t, formula.REFERENCE_ERROR.Error(), *resp.Error)
+	}
+
+	value, err := dao.GetCell("devchallenge-xx", "var1")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", value)
+
+	assert.Equal(t, http.StatusBadRequest, Delete(router, "/devchallenge-xx/var1?cascade=maybe").Code)
+	assert.Equal(t, http.StatusNoContent, Delete(router, "/devchallenge-xx/var1?cascade=true").Code)
+
+	request, _ := http.NewRequest(http.MethodGet, "/devchallenge-xx/var2", nil)
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+
+	json.NewDecoder(response.Body).Decode(&resp)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, formula.REF, resp.Result)
+
+	// Restoring the cell repairs the dependant
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "2").Code)
+
+	result, _, formulaError, err := formula.NewSolver(dao, "devchallenge-xx").Solve("var2")
+	assert.NoError(t, err)
+	assert.NoError(t, formulaError)
+	assert.Equal(t, "3", result)
+}
+
+func TestDeleteSpreadsheet(t *testing.T) {
+	router, dao := NewMiniredisTestContext(t)
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "1").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var2", "=var1").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-yy", "var1", "1").Code)
+
+	subId, err := dao.CreateSubscription("devchallenge-xx", "var2")
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.StatusNoContent, Delete(router, "/DevChallenge-XX").Code)
+	assert.Equal(t, http.StatusNotFound, Delete(router, "/devchallenge-xx").Code)
+
+	exists, err := dao.IsSpreadsheetExists("devchallenge-xx")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	index, err := dao.GetDependencyIndex("devchallenge-xx")
+	assert.NoError(t, err)
+	assert.Empty(t, index)
+
+	_, err = dao.GetSubscription(subId)
+	assert.Error(t, err)
+
+	exists, err = dao.IsSpreadsheetExists("devchallenge-yy")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestUpsertMissingReference(t *testing.T) {
+	router, _ := NewMiniredisTestContext(t)
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "a", "1").Code)
+
+	// Cells that never existed are not reported as deleted references
+	response := PostCell(router, "devchallenge-xx", "var1", "=a+missing")
+	assert.Equal(t, http.StatusUnprocessableEntity, response.Code)
+
+	var resp CellResponse
+	json.NewDecoder(response.Body).Decode(&resp)
+	assert.Equal(t, formula.ERROR, resp.Result)
+	if assert.NotNil(t, resp.Error) {
+		assert.Equal(t, formula.NO_SUCH_CELL.Error(), *resp.Error)
+	}
+}
+
+func TestCascadeDeleteKeepsDependantsWritable(t *testing.T) {
+	router, _ := NewMiniredisTestContext(t)
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "a", "1").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "b", "2").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "c", "=a+b").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "d", "=c+1").Code)
+
+	assert.Equal(t, http.StatusNoContent, Delete(router, "/devchallenge-xx/a?cascade=true").Code)
+
+	// The dependant was broken by the delete, not by the sibling edit
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "b", "3").Code)
+
+	var resp CellResponse
+	for _, cellId := range []string{"c", "d"} {
+		request, _ := http.NewRequest(http.MethodGet, "/devchallenge-xx/"+cellId, nil)
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+
+		json.NewDecoder(response.Body).Decode(&resp)
+		assert.Equal(t, http.StatusOK, response.Code, cellId)
+		assert.Equal(t, formula.REF, resp.Result, cellId)
+	}
+
+	// Restoring the cell repairs the dependants
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "a", "1").Code)
+
+	request, _ := http.NewRequest(http.MethodGet, "/devchallenge-xx/d", nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+
+	json.NewDecoder(response.Body).Decode(&resp)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "5", resp.Result)
+}
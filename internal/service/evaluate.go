@@ -0,0 +1,108 @@
+package service
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+type EvaluatePayload struct {
+	// Values replacing the stored ones, new cells may be added.
+	Overrides map[string]string
+
+	// Cells to evaluate, all the spreadsheet cells with the overridden ones
+	// when empty.
+	Targets []string
+}
+
+// evaluate computes the cells as if the overrides were stored, nothing is
+// written and dependants are not validated.
+func (s *Service) evaluate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sheetId := vars["sheet_id"]
+
+	contentType := r.Header.Get("Content-Type")
+	if strings.Compare(contentType, "application/json") != 0 {
+		log.Printf("Evaluate invalid content type %s", contentType)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var payload EvaluatePayload
+	if err := NewJsonDecoder(r.Body).Decode(&payload); err != nil {
+		log.Printf("Body decode error: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	for cellId := range payload.Overrides {
+		if !IsVariable(cellId) {
+			log.Printf("Cell ID %q is not valid variable", cellId)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	for _, cellId := range payload.Targets {
+		if !IsVariable(cellId) {
+			log.Printf("Cell ID %q is not valid variable", cellId)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	exists, err := s.dao.IsSpreadsheetExists(sheetId)
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	solver, err := s.newSolver(s.dao, sheetId)
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	for cellId, value := range payload.Overrides {
+		solver.SetCell(cellId, value)
+	}
+
+	targets := make([]string, 0, len(payload.Targets))
+	for _, cellId := range payload.Targets {
+		targets = append(targets, strings.ToLower(cellId))
+	}
+
+	if len(targets) == 0 {
+		keys, err := s.dao.GetSpreadeetKeys(sheetId)
+		if err != nil {
+			log.Print(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		targets = append(targets, keys...)
+		for cellId := range payload.Overrides {
+			targets = append(targets, strings.ToLower(cellId))
+		}
+	}
+
+	resp, err := solveCells(solver, targets)
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(&resp)
+}
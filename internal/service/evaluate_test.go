@@ -0,0 +1,66 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func PostEvaluate(router *mux.Router, sheetId string, payload EvaluatePayload) *httptest.ResponseRecorder {
+	jsonBody, _ := json.Marshal(payload)
+
+	request, _ := http.NewRequest(http.MethodPost, "/"+sheetId+"/evaluate", bytes.NewReader(jsonBody))
+	request.Header.Add("Content-Type", "application/json")
+	response := httptest.NewRecorder()
+
+	router.ServeHTTP(response, request)
+
+	return response
+}
+
+func TestEvaluate(t *testing.T) {
+	router, dao := NewMiniredisTestContext(t)
+
+	assert.Equal(t, http.StatusNotFound, PostEvaluate(router, "devchallenge-xx", EvaluatePayload{}).Code)
+
+	assert.Equal(t, http.StatusCreated, PostCells(router, "devchallenge-xx", map[string]string{
+		"price":    "10",
+		"quantity": "3",
+		"total":    "=price * quantity",
+	}).Code)
+
+	response := PostEvaluate(router, "devchallenge-xx", EvaluatePayload{
+		Overrides: map[string]string{"Price": "12"},
+		Targets:   []string{"TOTAL"},
+	})
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	var resp SpreadsheetResponse
+	json.NewDecoder(response.Body).Decode(&resp)
+	assert.Equal(t, SpreadsheetResponse{"total": {Value: "=price * quantity", Result: "36"}}, resp)
+
+	// New cells are evaluated with the whole spreadsheet
+	response = PostEvaluate(router, "devchallenge-xx", EvaluatePayload{
+		Overrides: map[string]string{"quantity": "0", "discount": "=total / 2"},
+	})
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	resp = nil
+	json.NewDecoder(response.Body).Decode(&resp)
+	assert.Len(t, resp, 4)
+	assert.Equal(t, "0", resp["total"].Result)
+	assert.Equal(t, "0", resp["discount"].Result)
+
+	cells, err := dao.GetAllCells("devchallenge-xx")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"price": "10", "quantity": "3", "total": "=price * quantity"}, cells)
+
+	assert.Equal(t, http.StatusBadRequest, PostEvaluate(router, "devchallenge-xx", EvaluatePayload{
+		Targets: []string{"var+1"},
+	}).Code)
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"devchallenge.it/spreadsheet/internal/model"
+)
+
+// streamEvents sends the changes of a subscribed cell as Server-Sent Events.
+// A client reconnecting with Last-Event-ID receives the logged changes it
+// missed, otherwise or when the log does not reach back far enough it
+// receives the current result first.
+func (s *Service) streamEvents(w http.ResponseWriter, r *http.Request, subscriber model.Subscriber, subId, sheetId, cellId string) {
+	// The log is read after subscribing so no change is lost in between
+	events, err := s.dao.GetCellEvents(sheetId, cellId)
+	if err != nil {
+		log.Printf("Failed to get cell events: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var replay []model.CellChange
+	var lastId int64
+	if len(events) > 0 {
+		lastId = events[len(events)-1].EventId
+	}
+
+	after, err := strconv.ParseInt(r.Header.Get("Last-Event-ID"), 10, 64)
+	resumable := err == nil && after <= lastId &&
+		(len(events) < model.MaxCellEvents || events[0].EventId <= after)
+	if resumable {
+		for _, event := range events {
+			if event.EventId > after {
+				replay = append(replay, event)
+			}
+		}
+	}
+
+	var current *CellResult
+	if !resumable {
+		cell, err := s.readCell(sheetId, cellId)
+		if err != nil {
+			log.Printf("Failed to get cell: %s", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		current = &cell
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	f, _ := w.(http.Flusher)
+
+	if current != nil {
+		writeEvent(w, lastId, *current)
+	}
+	for _, event := range replay {
+		cell, err := s.changedCell(sheetId, cellId, event)
+		if err != nil {
+			log.Printf("Failed to get cell: %s", err)
+			return
+		}
+		writeEvent(w, event.EventId, cell)
+	}
+	f.Flush()
+
+	for {
+		ctx, cancel := context.WithTimeout(r.Context(), s.keepAlive)
+		msg, err := subscriber.ReceiveMessage(ctx)
+		cancel()
+		if err == context.DeadlineExceeded && r.Context().Err() == nil {
+			fmt.Fprint(w, ": keep-alive\n\n")
+			f.Flush()
+			continue
+		}
+		if err != nil {
+			log.Printf("Unexpected error: %v", err)
+			return
+		}
+
+		// The subscription is removed together with its spreadsheet
+		if _, err := s.dao.GetSubscription(subId); err == model.ERROR_NO_SUBSCRIPTION {
+			return
+		}
+
+		var change model.CellChange
+		if err := json.Unmarshal([]byte(msg), &change); err != nil {
+			log.Printf("Invalid cell change %q: %v", msg, err)
+		}
+
+		// Changes logged before the stream started are already sent
+		if change.EventId != 0 && change.EventId <= lastId {
+			continue
+		}
+
+		cell, err := s.changedCell(sheetId, cellId, change)
+		if err != nil {
+			log.Printf("Failed to get cell: %s", err)
+			return
+		}
+
+		writeEvent(w, change.EventId, cell)
+		f.Flush()
+		if change.EventId != 0 {
+			lastId = change.EventId
+		}
+	}
+}
+
+// writeEvent writes the cell as an event, the id is omitted for unlogged
+// changes.
+func writeEvent(w http.ResponseWriter, id int64, cell CellResult) {
+	if id != 0 {
+		fmt.Fprintf(w, "id: %d\n", id)
+	}
+
+	data, _ := json.Marshal(NewCellResponse(cell))
+	fmt.Fprintf(w, "data: %s\n\n", data)
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"devchallenge.it/spreadsheet/internal/model"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// subscribeEvents subscribes to the cell and opens its event stream,
+// lastEventId is sent unless empty.
+func subscribeEvents(t *testing.T, router *mux.Router, sheetId, cellId, lastEventId string) (*http.Response, *bufio.Reader) {
+	request, _ := http.NewRequest(http.MethodPost, "/"+sheetId+"/"+cellId+"/subscribe", nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	require.Equal(t, http.StatusCreated, response.Code)
+
+	var resp SubsribeResponse
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&resp))
+	hook, _ := url.Parse(resp.WebhookUrl)
+
+	server := httptest.NewServer(router)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(func() {
+		cancel()
+		server.Close()
+	})
+
+	stream, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+hook.Path, nil)
+	stream.Header.Set("Accept", "text/event-stream")
+	if lastEventId != "" {
+		stream.Header.Set("Last-Event-ID", lastEventId)
+	}
+
+	events, err := http.DefaultClient.Do(stream)
+	require.NoError(t, err)
+	t.Cleanup(func() { events.Body.Close() })
+
+	return events, bufio.NewReader(events.Body)
+}
+
+// readEvent returns the lines of the next event.
+func readEvent(t *testing.T, reader *bufio.Reader) string {
+	var lines []string
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		if line == "\n" {
+			return strings.Join(lines, "")
+		}
+		lines = append(lines, line)
+	}
+}
+
+func cellEvent(id int, value string) string {
+	return fmt.Sprintf("id: %d\ndata: {\"value\":%q,\"result\":%q}\n", id, value, value)
+}
+
+func TestStreamEvents(t *testing.T) {
+	router, _ := NewMiniredisTestContext(t)
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "1").Code)
+
+	response, events := subscribeEvents(t, router, "devchallenge-xx", "var1", "")
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+	assert.Equal(t, "no-cache", response.Header.Get("Cache-Control"))
+
+	// The current result comes first with the id of its change
+	assert.Equal(t, cellEvent(1, "1"), readEvent(t, events))
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "2").Code)
+	assert.Equal(t, cellEvent(2, "2"), readEvent(t, events))
+}
+
+func TestStreamEventsNewCell(t *testing.T) {
+	router, _ := NewMiniredisTestContext(t)
+
+	_, events := subscribeEvents(t, router, "devchallenge-xx", "var1", "")
+	assert.Equal(t, "data: {\"value\":\"\",\"result\":\"\",\"error\":\"No such cellId\"}\n", readEvent(t, events))
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "1").Code)
+	assert.Equal(t, cellEvent(1, "1"), readEvent(t, events))
+}
+
+func TestStreamEventsResume(t *testing.T) {
+	router, _ := NewMiniredisTestContext(t)
+
+	for _, value := range []string{"1", "2", "3"} {
+		assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", value).Code)
+	}
+
+	// Only the missed changes are replayed
+	_, events := subscribeEvents(t, router, "devchallenge-xx", "var1", "1")
+	assert.Equal(t, cellEvent(2, "2"), readEvent(t, events))
+	assert.Equal(t, cellEvent(3, "3"), readEvent(t, events))
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "4").Code)
+	assert.Equal(t, cellEvent(4, "4"), readEvent(t, events))
+}
+
+func TestStreamEventsResumeExpired(t *testing.T) {
+	router, _ := NewMiniredisTestContext(t)
+
+	for i := 1; i <= model.MaxCellEvents+2; i++ {
+		assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", fmt.Sprint(i)).Code)
+	}
+
+	// The log no longer holds the next change, the current result is sent
+	last := fmt.Sprint(model.MaxCellEvents + 2)
+	_, events := subscribeEvents(t, router, "devchallenge-xx", "var1", "1")
+	assert.Equal(t, cellEvent(model.MaxCellEvents+2, last), readEvent(t, events))
+
+	_, events = subscribeEvents(t, router, "devchallenge-xx", "var1", "invalid")
+	assert.Equal(t, cellEvent(model.MaxCellEvents+2, last), readEvent(t, events))
+}
+
+func TestStreamEventsKeepAlive(t *testing.T) {
+	_, dao := NewMiniredisTestContext(t)
+	router := mux.NewRouter()
+	s := NewService(router, dao)
+	s.keepAlive = 10 * time.Millisecond
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "1").Code)
+
+	_, events := subscribeEvents(t, router, "devchallenge-xx", "var1", "")
+	assert.Equal(t, cellEvent(1, "1"), readEvent(t, events))
+	assert.Equal(t, ": keep-alive\n", readEvent(t, events))
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "2").Code)
+	for {
+		if event := readEvent(t, events); event != ": keep-alive\n" {
+			assert.Equal(t, cellEvent(2, "2"), event)
+			break
+		}
+	}
+}
@@ -17,6 +17,20 @@ type CellResponse struct {
 	Error *string `json:"error,omitempty"`
 }
 
+func NewCellResponse(cell CellResult) CellResponse {
+	var errorMsg *string
+	if cell.FormulaError != nil {
+		errorMsg = new(string)
+		*errorMsg = cell.FormulaError.Error()
+	}
+
+	return CellResponse{
+		Value:  cell.Value,
+		Result: cell.Result,
+		Error:  errorMsg,
+	}
+}
+
 func (s *Service) getCell(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	sheetId := vars["sheet_id"]
@@ -28,30 +42,19 @@ func (s *Service) getCell(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	solver := formula.NewSolver(s.dao, sheetId)
-	result, value, formulaError, err := solver.Solve(cellId)
+	cell, err := s.readCell(sheetId, cellId)
 	if err != nil {
 		log.Printf("Failed to get cell: %s", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	if formulaError == formula.NO_SUCH_CELL {
+	if formula.IsMissingCell(cell.Value, cell.FormulaError) {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	var errorMsg *string
-	if formulaError != nil {
-		errorMsg = new(string)
-		*errorMsg = formulaError.Error()
-	}
-
-	resp := CellResponse{
-		Value:  value,
-		Result: result,
-		Error:  errorMsg,
-	}
+	resp := NewCellResponse(cell)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -13,7 +13,9 @@ import (
 func TestGetCell(t *testing.T) {
 	tctx := NewTestContext()
 
-	tctx.mock.ExpectHGet("devchallenge-xx", "var1").SetVal("1")
+	tctx.mock.ExpectHGet(testResultsKey, "var1").RedisNil()
+	expectIterativeCalculation(tctx.mock)
+	tctx.mock.ExpectHGet(testCellsKey, "var1").SetVal("1")
 
 	request, _ := http.NewRequest(http.MethodGet, "/devchallenge-xx/var1", nil)
 	response := httptest.NewRecorder()
@@ -39,7 +41,9 @@ func TestGetCell(t *testing.T) {
 func TestGetCellDoesntExists(t *testing.T) {
 	tctx := NewTestContext()
 
-	tctx.mock.ExpectHGet("devchallenge-xx", "var2").RedisNil()
+	tctx.mock.ExpectHGet(testResultsKey, "var2").RedisNil()
+	expectIterativeCalculation(tctx.mock)
+	tctx.mock.ExpectHGet(testCellsKey, "var2").RedisNil()
 
 	request, _ := http.NewRequest(http.MethodGet, "/devchallenge-xx/var2", nil)
 	response := httptest.NewRecorder()
@@ -65,9 +69,11 @@ func TestGetCellInvalidCellId(t *testing.T) {
 func TestGetCellComplexName(t *testing.T) {
 	tctx := NewTestContext()
 
-	tctx.mock.ExpectHGet("devchallenge-xx", "說").SetVal("=á._+拿")
-	tctx.mock.ExpectHGet("devchallenge-xx", "á._").SetVal("3")
-	tctx.mock.ExpectHGet("devchallenge-xx", "拿").SetVal("2")
+	tctx.mock.ExpectHGet(testResultsKey, "說").RedisNil()
+	expectIterativeCalculation(tctx.mock)
+	tctx.mock.ExpectHGet(testCellsKey, "說").SetVal("=á._+拿")
+	tctx.mock.ExpectHGet(testCellsKey, "á._").SetVal("3")
+	tctx.mock.ExpectHGet(testCellsKey, "拿").SetVal("2")
 
 	request, _ := http.NewRequest(http.MethodGet, "/devchallenge-xx/說", nil)
 	response := httptest.NewRecorder()
@@ -4,58 +4,84 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	"devchallenge.it/spreadsheet/internal/formula"
+	"devchallenge.it/spreadsheet/internal/model"
 	"github.com/gorilla/mux"
 )
 
 type SpreadsheetResponse map[string]CellResponse
 
+// getSpreadsheet evaluates all cells of the spreadsheet, the "at" RFC 3339
+// timestamp evaluates the cells as they were stored at the moment.
 func (s *Service) getSpreadsheet(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	sheetId := vars["sheet_id"]
 
-	exists, err := s.dao.IsSpreadsheetExists(sheetId)
-	if err != nil {
-		log.Print(err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+	var cells map[string]string
+	var results map[string]model.Result
+	var iteration model.IterativeCalculation
+
+	if atParam := r.URL.Query().Get("at"); atParam != "" {
+		at, err := time.Parse(time.RFC3339Nano, atParam)
+		if err != nil {
+			log.Printf("Invalid at %q: %v", atParam, err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if cells, err = s.dao.GetCellsAt(sheetId, at); err == nil {
+			iteration, err = s.dao.GetIterativeCalculation(sheetId)
+		}
+		if err != nil {
+			log.Print(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	} else {
+		// The cells and their results are read at once, so a concurrent
+		// update can not mix into the response
+		state, err := s.dao.GetSpreadsheetState(sheetId)
+		if err != nil {
+			log.Print(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		cells, results, iteration = state.Cells, state.Results, state.IterativeCalculation
 	}
 
-	if !exists {
+	if len(cells) == 0 {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	keys, err := s.dao.GetSpreadeetKeys(sheetId)
-	if err != nil {
-		log.Print(err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+	// Only the cells without materialized results are evaluated
+	resp := make(SpreadsheetResponse, len(cells))
+	var missing []string
+	for cellId := range cells {
+		if result, exists := results[cellId]; exists {
+			resp[cellId] = NewCellResponse(newMaterializedCellResult(result))
+		} else {
+			missing = append(missing, cellId)
+		}
 	}
 
-	resp := make(SpreadsheetResponse)
+	if len(missing) > 0 {
+		solver := formula.NewSolver(model.CellsSnapshot(cells), sheetId)
+		solver.SetIterativeCalculation(iteration)
 
-	solver := formula.NewSolver(s.dao, sheetId)
-	solver.LoadAllKeys()
-	for _, cellId := range keys {
-		result, value, formulaError, err := solver.Solve(cellId)
+		solved, err := solveCells(solver, missing)
 		if err != nil {
 			log.Print(err)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		var errorMsg *string
-		if formulaError != nil {
-			errorMsg = new(string)
-			*errorMsg = formulaError.Error()
-		}
-
-		resp[cellId] = CellResponse{
-			Result: result,
-			Value:  value,
-			Error:  errorMsg,
+		for cellId, cell := range solved {
+			resp[cellId] = cell
 		}
 	}
 
@@ -63,3 +89,28 @@ func (s *Service) getSpreadsheet(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(&resp)
 }
+
+// solveCells evaluates the cells with all the spreadsheet values loaded into
+// the solver, independent cells are evaluated in parallel.
+func solveCells(solver *formula.Solver, cellIds []string) (SpreadsheetResponse, error) {
+	if err := solver.LoadAllKeys(); err != nil {
+		return nil, err
+	}
+
+	cells, err := solver.SolveParallel(cellIds, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := make(SpreadsheetResponse, len(cellIds))
+	for _, cellId := range cellIds {
+		cell := cells[strings.ToLower(cellId)]
+		resp[cellId] = NewCellResponse(CellResult{
+			Result:       cell.Result,
+			Value:        cell.Value,
+			FormulaError: cell.FormulaError,
+		})
+	}
+
+	return resp, nil
+}
@@ -6,19 +6,25 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/go-redis/redismock/v9"
 	"github.com/go-test/deep"
 	"github.com/stretchr/testify/assert"
 )
 
+// expectSpreadsheetState expects the cells and their results read in a single
+// transaction, the iterative calculation is disabled.
+func expectSpreadsheetState(mock redismock.ClientMock, cells, results map[string]string) {
+	mock.ExpectTxPipeline()
+	mock.ExpectHGetAll(testCellsKey).SetVal(cells)
+	mock.ExpectHGetAll(testResultsKey).SetVal(results)
+	mock.ExpectHGet(testInfoKey, "iteration").SetVal(`{"enabled":false}`)
+	mock.ExpectTxPipelineExec()
+}
+
 func TestGetSpreadsheetExists(t *testing.T) {
 	tctx := NewTestContext()
 
-	tctx.mock.ExpectExists("devchallenge-xx").SetVal(1)
-	tctx.mock.ExpectHKeys("devchallenge-xx").SetVal([]string{"var1"})
-	tctx.mock.ExpectHGetAll("devchallenge-xx").SetVal(
-		map[string]string{
-			"var1": "1",
-		})
+	expectSpreadsheetState(tctx.mock, map[string]string{"var1": "1"}, map[string]string{})
 
 	request, _ := http.NewRequest(http.MethodGet, "/devchallenge-xx", nil)
 	response := httptest.NewRecorder()
@@ -45,7 +51,7 @@ func TestGetSpreadsheetExists(t *testing.T) {
 func TestGetSpreadsheetDoesntExists(t *testing.T) {
 	tctx := NewTestContext()
 
-	tctx.mock.ExpectExists("devchallenge-xx").SetVal(0)
+	expectSpreadsheetState(tctx.mock, map[string]string{}, map[string]string{})
 
 	request, _ := http.NewRequest(http.MethodGet, "/devchallenge-xx", nil)
 	response := httptest.NewRecorder()
@@ -61,16 +67,12 @@ func TestGetSpreadsheetDoesntExists(t *testing.T) {
 func TestGetSpreadsheetPreload(t *testing.T) {
 	tctx := NewTestContext()
 
-	tctx.mock.ExpectExists("devchallenge-xx").SetVal(1)
-	tctx.mock.ExpectHKeys("devchallenge-xx").SetVal(
-		[]string{
-			"var1", "var2", "var3", "var4"})
-	tctx.mock.ExpectHGetAll("devchallenge-xx").SetVal(map[string]string{
+	expectSpreadsheetState(tctx.mock, map[string]string{
 		"var1": "=var2+var3",
 		"var2": "=var3 + var3 - var3 - var3 + var4",
 		"var3": "=var4-var4+0",
 		"var4": "1",
-	})
+	}, map[string]string{})
 
 	request, _ := http.NewRequest(http.MethodGet, "/devchallenge-xx", nil)
 	response := httptest.NewRecorder()
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"encoding/json"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"devchallenge.it/spreadsheet/internal/formula"
+	"devchallenge.it/spreadsheet/internal/model"
+	"github.com/gorilla/mux"
+)
+
+type GoalSeekPayload struct {
+	// Cell which result should be equal to the value.
+	Target string
+	Value  string
+
+	// Cell which value is changed, it must hold a number or be missing.
+	Input string
+
+	// Allowed difference of the target result from the value, 1e-9 when empty.
+	Tolerance     string
+	MaxIterations int `json:"max_iterations"`
+
+	// Store the found input value like an upserted one.
+	Commit bool
+}
+
+type GoalSeekStepResponse struct {
+	Input  string `json:"input"`
+	Result string `json:"result"`
+}
+
+type GoalSeekResponse struct {
+	// Found value of the input cell.
+	Value  string                 `json:"value,omitempty"`
+	Result string                 `json:"result,omitempty"`
+	Trace  []GoalSeekStepResponse `json:"trace"`
+	Error  *string                `json:"error,omitempty"`
+}
+
+// goalSeek looks for the input cell value making the target cell result equal
+// to the desired value. The tried inputs are evaluated in memory with the
+// cells read at once, the found one is stored only on commit.
+func (s *Service) goalSeek(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sheetId := vars["sheet_id"]
+
+	contentType := r.Header.Get("Content-Type")
+	if strings.Compare(contentType, "application/json") != 0 {
+		log.Printf("Goal seek invalid content type %s", contentType)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var payload GoalSeekPayload
+	if err := NewJsonDecoder(r.Body).Decode(&payload); err != nil {
+		log.Printf("Body decode error: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if !IsVariable(payload.Target) || !IsVariable(payload.Input) {
+		log.Printf("Cell IDs %q, %q are not valid variables", payload.Target, payload.Input)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	seek := formula.GoalSeek{
+		Target:        strings.ToLower(payload.Target),
+		Input:         strings.ToLower(payload.Input),
+		MaxIterations: payload.MaxIterations,
+	}
+
+	var err error
+	if seek.Goal, _, err = big.ParseFloat(payload.Value, 10, 64, big.ToNearestEven); err != nil {
+		log.Printf("Goal seek value %q is not a number", payload.Value)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if payload.Tolerance != "" {
+		if seek.Tolerance, _, err = big.ParseFloat(payload.Tolerance, 10, 64, big.ToNearestEven); err != nil || seek.Tolerance.Sign() < 0 {
+			log.Printf("Goal seek tolerance %q is not valid", payload.Tolerance)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	cells, err := s.dao.GetAllCells(sheetId)
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if len(cells) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if seek.Iteration, err = s.dao.GetIterativeCalculation(sheetId); err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	steps, err := seek.Run(model.CellsSnapshot(cells), sheetId)
+	if err != nil && err != formula.GOAL_SEEK_INPUT_ERROR && err != formula.GOAL_SEEK_RESULT_ERROR && err != formula.GOAL_SEEK_NOT_CONVERGED {
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	resp := GoalSeekResponse{Trace: make([]GoalSeekStepResponse, len(steps))}
+	for i, step := range steps {
+		resp.Trace[i] = GoalSeekStepResponse{Input: step.Input, Result: step.Result}
+	}
+
+	responseStatus := http.StatusOK
+	if err != nil {
+		responseStatus = http.StatusUnprocessableEntity
+		resp.Error = new(string)
+		*resp.Error = err.Error()
+	} else {
+		found := steps[len(steps)-1]
+		resp.Value, resp.Result = found.Input, found.Result
+
+		if payload.Commit {
+			_, _, formulaError, err := s.storeCell(sheetId, requestOrigin(w, r), seek.Input, found.Input)
+			if err != nil {
+				log.Print(err)
+				if err == model.ERROR_UPDATE_CONFLICT {
+					w.WriteHeader(http.StatusConflict)
+					return
+				}
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			if formulaError == nil {
+				responseStatus = http.StatusCreated
+			} else {
+				responseStatus = http.StatusUnprocessableEntity
+				resp.Error = new(string)
+				*resp.Error = formulaError.Error()
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(responseStatus)
+	json.NewEncoder(w).Encode(&resp)
+}
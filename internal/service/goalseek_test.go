@@ -0,0 +1,94 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func PostGoalSeek(router *mux.Router, sheetId string, payload GoalSeekPayload) *httptest.ResponseRecorder {
+	jsonBody, _ := json.Marshal(payload)
+
+	request, _ := http.NewRequest(http.MethodPost, "/"+sheetId+"/goalseek", bytes.NewReader(jsonBody))
+	request.Header.Add("Content-Type", "application/json")
+	response := httptest.NewRecorder()
+
+	router.ServeHTTP(response, request)
+
+	return response
+}
+
+func TestGoalSeek(t *testing.T) {
+	router, dao := NewMiniredisTestContext(t)
+
+	payload := GoalSeekPayload{Target: "total", Value: "45", Input: "price"}
+	assert.Equal(t, http.StatusNotFound, PostGoalSeek(router, "devchallenge-xx", payload).Code)
+
+	assert.Equal(t, http.StatusCreated, PostCells(router, "devchallenge-xx", map[string]string{
+		"price":    "10",
+		"quantity": "3",
+		"total":    "=price * quantity",
+	}).Code)
+
+	response := PostGoalSeek(router, "devchallenge-xx", payload)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	var resp GoalSeekResponse
+	json.NewDecoder(response.Body).Decode(&resp)
+	assert.Equal(t, "15", resp.Value)
+	assert.Equal(t, "45", resp.Result)
+	assert.Equal(t, GoalSeekStepResponse{Input: "10", Result: "30"}, resp.Trace[0])
+	assert.Nil(t, resp.Error)
+
+	value, err := dao.GetCell("devchallenge-xx", "price")
+	assert.NoError(t, err)
+	assert.Equal(t, "10", value)
+
+	payload.Commit = true
+	assert.Equal(t, http.StatusCreated, PostGoalSeek(router, "devchallenge-xx", payload).Code)
+
+	value, err = dao.GetCell("devchallenge-xx", "price")
+	assert.NoError(t, err)
+	assert.Equal(t, "15", value)
+}
+
+func TestGoalSeekFailure(t *testing.T) {
+	router, dao := NewMiniredisTestContext(t)
+
+	assert.Equal(t, http.StatusCreated, PostCells(router, "devchallenge-xx", map[string]string{
+		"x":     "1",
+		"flat":  "=x * 0",
+		"total": "=x + 1",
+		"ratio": "=1 / (x - 2)",
+	}).Code)
+
+	assert.Equal(t, http.StatusBadRequest, PostGoalSeek(router, "devchallenge-xx", GoalSeekPayload{Target: "total", Value: "a", Input: "x"}).Code)
+	assert.Equal(t, http.StatusBadRequest, PostGoalSeek(router, "devchallenge-xx", GoalSeekPayload{Target: "total", Value: "1", Input: "-x"}).Code)
+
+	response := PostGoalSeek(router, "devchallenge-xx", GoalSeekPayload{Target: "flat", Value: "1", Input: "x", MaxIterations: 5})
+	assert.Equal(t, http.StatusUnprocessableEntity, response.Code)
+
+	var resp GoalSeekResponse
+	json.NewDecoder(response.Body).Decode(&resp)
+	assert.Empty(t, resp.Value)
+	assert.Len(t, resp.Trace, 2)
+	assert.NotNil(t, resp.Error)
+
+	// Found input breaking a dependant is not stored
+	response = PostGoalSeek(router, "devchallenge-xx", GoalSeekPayload{Target: "total", Value: "3", Input: "x", Commit: true})
+	assert.Equal(t, http.StatusUnprocessableEntity, response.Code)
+
+	resp = GoalSeekResponse{}
+	json.NewDecoder(response.Body).Decode(&resp)
+	assert.Equal(t, "2", resp.Value)
+	assert.NotNil(t, resp.Error)
+
+	value, err := dao.GetCell("devchallenge-xx", "x")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", value)
+}
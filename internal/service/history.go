@@ -0,0 +1,61 @@
+package service
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type CellVersionResponse struct {
+	Version   int       `json:"version"`
+	Value     string    `json:"value"`
+	Deleted   bool      `json:"deleted,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	Author    string    `json:"author,omitempty"`
+	RequestId string    `json:"request_id,omitempty"`
+}
+
+// getCellHistory lists every stored or deleted value of the cell, the oldest
+// version first.
+func (s *Service) getCellHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sheetId := vars["sheet_id"]
+	cellId := vars["cell_id"]
+
+	if !IsVariable(cellId) {
+		log.Printf("Cell ID %q is not valid variable", cellId)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	versions, err := s.dao.GetCellHistory(sheetId, cellId)
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if len(versions) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	resp := make([]CellVersionResponse, len(versions))
+	for i, version := range versions {
+		resp[i] = CellVersionResponse{
+			Version:   version.Version,
+			Value:     version.Value,
+			Deleted:   version.Deleted,
+			Timestamp: version.Timestamp,
+			Author:    version.Author,
+			RequestId: version.RequestId,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(&resp)
+}
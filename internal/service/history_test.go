@@ -0,0 +1,110 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func Get(router *mux.Router, path string) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest(http.MethodGet, path, nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+
+	return response
+}
+
+func TestGetCellHistory(t *testing.T) {
+	router, _ := NewMiniredisTestContext(t)
+
+	assert.Equal(t, http.StatusNotFound, Get(router, "/devchallenge-xx/var1/history").Code)
+
+	request, _ := http.NewRequest(http.MethodPost, "/devchallenge-xx/var1", CreateUpsertPayload("1"))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(AuthorHeader, "alice")
+	request.Header.Set(RequestIdHeader, "req-1")
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusCreated, response.Code)
+	assert.Equal(t, "req-1", response.Header().Get(RequestIdHeader))
+
+	response = PostCell(router, "devchallenge-xx", "var1", "2")
+	assert.Equal(t, http.StatusCreated, response.Code)
+	generatedId := response.Header().Get(RequestIdHeader)
+	assert.NotEmpty(t, generatedId)
+
+	assert.Equal(t, http.StatusNoContent, Delete(router, "/devchallenge-xx/var1").Code)
+
+	response = Get(router, "/DevChallenge-XX/VAR1/history")
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	var resp []CellVersionResponse
+	json.NewDecoder(response.Body).Decode(&resp)
+	if assert.Len(t, resp, 3) {
+		assert.Equal(t, CellVersionResponse{
+			Version:   1,
+			Value:     "1",
+			Timestamp: resp[0].Timestamp,
+			Author:    "alice",
+			RequestId: "req-1",
+		}, resp[0])
+		assert.Equal(t, "2", resp[1].Value)
+		assert.Equal(t, generatedId, resp[1].RequestId)
+		assert.Equal(t, 3, resp[2].Version)
+		assert.True(t, resp[2].Deleted)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, Get(router, "/devchallenge-xx/var+1/history").Code)
+}
+
+func TestGetSpreadsheetAt(t *testing.T) {
+	router, _ := NewMiniredisTestContext(t)
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "1").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var2", "=var1+1").Code)
+	time.Sleep(2 * time.Millisecond)
+	at := time.Now()
+	time.Sleep(2 * time.Millisecond)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "10").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var3", "3").Code)
+
+	response := Get(router, "/devchallenge-xx?at="+url.QueryEscape(at.Format(time.RFC3339Nano)))
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	var resp SpreadsheetResponse
+	json.NewDecoder(response.Body).Decode(&resp)
+	assert.Equal(t, SpreadsheetResponse{
+		"var1": {Value: "1", Result: "1"},
+		"var2": {Value: "=var1+1", Result: "2"},
+	}, resp)
+
+	response = Get(router, "/devchallenge-xx")
+	json.NewDecoder(response.Body).Decode(&resp)
+	assert.Equal(t, "11", resp["var2"].Result)
+
+	before := at.Add(-time.Hour).Format(time.RFC3339)
+	assert.Equal(t, http.StatusNotFound, Get(router, "/devchallenge-xx?at="+url.QueryEscape(before)).Code)
+	assert.Equal(t, http.StatusBadRequest, Get(router, "/devchallenge-xx?at=yesterday").Code)
+}
+
+func TestRequestIdWithoutRandomness(t *testing.T) {
+	router, _ := NewMiniredisTestContext(t)
+	FailRandom(t)
+
+	first := PostCell(router, "devchallenge-xx", "var1", "1")
+	assert.Equal(t, http.StatusCreated, first.Code)
+	second := PostCell(router, "devchallenge-xx", "var1", "2")
+	assert.Equal(t, http.StatusCreated, second.Code)
+
+	firstId := first.Header().Get(RequestIdHeader)
+	assert.NotEmpty(t, firstId)
+	assert.NotEqual(t, strings.Repeat("0", 16), firstId)
+	assert.NotEqual(t, firstId, second.Header().Get(RequestIdHeader))
+}
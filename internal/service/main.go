@@ -3,19 +3,27 @@ package service
 import (
 	"go/ast"
 	"net/http"
+	"strings"
+	"time"
 
 	"devchallenge.it/spreadsheet/internal/formula/parser"
 	"devchallenge.it/spreadsheet/internal/model"
 	"github.com/gorilla/mux"
 )
 
+// DefaultKeepAliveInterval is the idle time after which an event stream
+// sends a comment to keep proxies from closing the connection.
+const DefaultKeepAliveInterval = 15 * time.Second
+
 type Service struct {
-	dao            *model.Dao
+	dao            model.Dao
 	subscribeRoute *mux.Route
+	keepAlive      time.Duration
+	webhooks       *webhookWorker
 }
 
-func NewService(r *mux.Router, dao *model.Dao) *Service {
-	s := &Service{dao: dao}
+func NewService(r *mux.Router, dao model.Dao) *Service {
+	s := &Service{dao: dao, keepAlive: DefaultKeepAliveInterval, webhooks: newWebhookWorker()}
 	s.Mount(r)
 	return s
 }
@@ -26,6 +34,72 @@ func (s *Service) Mount(r *mux.Router) *mux.Router {
 			s.subscribeHook(w, r)
 		}).Methods(http.MethodGet)
 
+	r.HandleFunc("/sub/{subscribe_id}/deliveries",
+		func(w http.ResponseWriter, r *http.Request) {
+			s.listDeliveries(w, r, "")
+		}).Methods(http.MethodGet)
+
+	r.HandleFunc("/sub/{subscribe_id}/dead-letters",
+		func(w http.ResponseWriter, r *http.Request) {
+			s.listDeliveries(w, r, model.DeliveryFailed)
+		}).Methods(http.MethodGet)
+
+	// Only upgrade requests are matched, so "ws" remains a spreadsheet id.
+	r.Handle("/ws", s.newWebsocketHandler()).
+		Methods(http.MethodGet).
+		HeadersRegexp("Upgrade", "(?i)^websocket$")
+
+	r.HandleFunc("/",
+		func(w http.ResponseWriter, r *http.Request) {
+			s.listSpreadsheets(w, r)
+		}).Methods(http.MethodGet)
+
+	// Spreadsheet actions are matched before the cell routes.
+	r.HandleFunc("/{sheet_id}/undo",
+		func(w http.ResponseWriter, r *http.Request) {
+			s.undo(w, r)
+		}).Methods(http.MethodPost)
+
+	r.HandleFunc("/{sheet_id}/redo",
+		func(w http.ResponseWriter, r *http.Request) {
+			s.redo(w, r)
+		}).Methods(http.MethodPost)
+
+	r.HandleFunc("/{sheet_id}/copy",
+		func(w http.ResponseWriter, r *http.Request) {
+			s.copySpreadsheet(w, r)
+		}).Methods(http.MethodPost)
+
+	r.HandleFunc("/{sheet_id}/evaluate",
+		func(w http.ResponseWriter, r *http.Request) {
+			s.evaluate(w, r)
+		}).Methods(http.MethodPost)
+
+	r.HandleFunc("/{sheet_id}/goalseek",
+		func(w http.ResponseWriter, r *http.Request) {
+			s.goalSeek(w, r)
+		}).Methods(http.MethodPost)
+
+	r.HandleFunc("/{sheet_id}/snapshots",
+		func(w http.ResponseWriter, r *http.Request) {
+			s.createSnapshot(w, r)
+		}).Methods(http.MethodPost)
+
+	r.HandleFunc("/{sheet_id}/snapshots",
+		func(w http.ResponseWriter, r *http.Request) {
+			s.listSnapshots(w, r)
+		}).Methods(http.MethodGet)
+
+	r.HandleFunc("/{sheet_id}/snapshots/{name}",
+		func(w http.ResponseWriter, r *http.Request) {
+			s.getSnapshot(w, r)
+		}).Methods(http.MethodGet)
+
+	r.HandleFunc("/{sheet_id}/snapshots/{name}/restore",
+		func(w http.ResponseWriter, r *http.Request) {
+			s.restoreSnapshot(w, r)
+		}).Methods(http.MethodPost)
+
 	r.HandleFunc("/{sheet_id}/{cell_id}",
 		func(w http.ResponseWriter, r *http.Request) {
 			s.upsert(w, r)
@@ -36,20 +110,64 @@ func (s *Service) Mount(r *mux.Router) *mux.Router {
 			s.getCell(w, r)
 		}).Methods(http.MethodGet)
 
+	r.HandleFunc("/{sheet_id}/{cell_id}",
+		func(w http.ResponseWriter, r *http.Request) {
+			s.deleteCell(w, r)
+		}).Methods(http.MethodDelete)
+
 	r.HandleFunc("/{sheet_id}/{cell_id}/subscribe",
 		func(w http.ResponseWriter, r *http.Request) {
 			s.subscribeCell(w, r)
 		}).Methods(http.MethodPost)
 
+	r.HandleFunc("/{sheet_id}/{cell_id}/history",
+		func(w http.ResponseWriter, r *http.Request) {
+			s.getCellHistory(w, r)
+		}).Methods(http.MethodGet)
+
+	// The check is a query, so no cell id is taken by it.
+	r.HandleFunc("/{sheet_id}",
+		func(w http.ResponseWriter, r *http.Request) {
+			s.checkConsistency(w, r)
+		}).Methods(http.MethodGet).
+		Queries("consistency", "true")
+
 	r.HandleFunc("/{sheet_id}",
 		func(w http.ResponseWriter, r *http.Request) {
 			s.getSpreadsheet(w, r)
 		}).Methods(http.MethodGet)
 
+	r.HandleFunc("/{sheet_id}",
+		func(w http.ResponseWriter, r *http.Request) {
+			s.deleteSpreadsheet(w, r)
+		}).Methods(http.MethodDelete)
+
+	r.HandleFunc("/{sheet_id}",
+		func(w http.ResponseWriter, r *http.Request) {
+			s.batchUpsert(w, r)
+		}).Methods(http.MethodPost)
+
+	r.HandleFunc("/{sheet_id}",
+		func(w http.ResponseWriter, r *http.Request) {
+			s.updateSpreadsheetInfo(w, r)
+		}).Methods(http.MethodPatch)
+
 	r.HandleFunc("/{sheet_id}/{cell_id}", CorsHandler).Methods(http.MethodOptions)
 	r.HandleFunc("/{sheet_id}/{cell_id}/subscribe", CorsHandler).Methods(http.MethodOptions)
+	r.HandleFunc("/{sheet_id}/{cell_id}/history", CorsHandler).Methods(http.MethodOptions)
 	r.HandleFunc("/sub/{subscribe_id}", CorsHandler).Methods(http.MethodOptions)
+	r.HandleFunc("/sub/{subscribe_id}/deliveries", CorsHandler).Methods(http.MethodOptions)
+	r.HandleFunc("/sub/{subscribe_id}/dead-letters", CorsHandler).Methods(http.MethodOptions)
+	r.HandleFunc("/{sheet_id}/undo", CorsHandler).Methods(http.MethodOptions)
+	r.HandleFunc("/{sheet_id}/copy", CorsHandler).Methods(http.MethodOptions)
+	r.HandleFunc("/{sheet_id}/evaluate", CorsHandler).Methods(http.MethodOptions)
+	r.HandleFunc("/{sheet_id}/goalseek", CorsHandler).Methods(http.MethodOptions)
+	r.HandleFunc("/{sheet_id}/snapshots", CorsHandler).Methods(http.MethodOptions)
+	r.HandleFunc("/{sheet_id}/snapshots/{name}", CorsHandler).Methods(http.MethodOptions)
+	r.HandleFunc("/{sheet_id}/snapshots/{name}/restore", CorsHandler).Methods(http.MethodOptions)
+	r.HandleFunc("/{sheet_id}/redo", CorsHandler).Methods(http.MethodOptions)
 	r.HandleFunc("/{sheet_id}", CorsHandler).Methods(http.MethodOptions)
+	r.HandleFunc("/", CorsHandler).Methods(http.MethodOptions)
 	r.Use(mux.CORSMethodMiddleware(r))
 
 	return r
@@ -60,6 +178,24 @@ func CorsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Max-Age", "86400")
 }
 
+// reservedCellIds are the spreadsheet action routes, cells named after them
+// would be shadowed by the actions.
+var reservedCellIds = map[string]struct{}{
+	"undo":      {},
+	"redo":      {},
+	"copy":      {},
+	"evaluate":  {},
+	"goalseek":  {},
+	"snapshots": {},
+}
+
+// IsReservedCellId reports whether the cell id is taken by a spreadsheet
+// route, such cells are not created.
+func IsReservedCellId(cellId string) bool {
+	_, reserved := reservedCellIds[strings.ToLower(cellId)]
+	return reserved
+}
+
 func IsVariable(value string) bool {
 	tr, err := parser.ParseExpr(value, "")
 	if err != nil {
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"devchallenge.it/spreadsheet/internal/formula"
+	"devchallenge.it/spreadsheet/internal/model"
+)
+
+// RebuildDependencyIndex recomputes the dependency index of the spreadsheet
+// from the stored formulas, stale dependants are removed and missing ones
+// added.
+func RebuildDependencyIndex(dao model.Dao, sheetId string) (added int, removed int, err error) {
+	err = dao.Update(sheetId, func(batch *model.Batch) error {
+		added, removed = 0, 0
+
+		cells, err := dao.GetAllCells(sheetId)
+		if err != nil {
+			return err
+		}
+
+		index, err := dao.GetDependencyIndex(sheetId)
+		if err != nil {
+			return err
+		}
+
+		expected := make(map[string]map[string]struct{})
+		for cellId, value := range cells {
+			for _, dependencyId := range formula.Dependencies(value) {
+				if dependencyId == cellId {
+					continue
+				}
+				if _, exists := expected[dependencyId]; !exists {
+					expected[dependencyId] = make(map[string]struct{})
+				}
+				expected[dependencyId][cellId] = struct{}{}
+			}
+		}
+
+		for cellId, dependants := range index {
+			for _, dependantId := range dependants {
+				if _, exists := expected[cellId][dependantId]; exists {
+					delete(expected[cellId], dependantId)
+					continue
+				}
+
+				batch.DeleteDependatFormula(dependantId, []string{cellId})
+				removed++
+			}
+		}
+
+		for cellId, dependants := range expected {
+			for dependantId := range dependants {
+				batch.AddDependatFormula(dependantId, []string{cellId})
+				added++
+			}
+		}
+
+		return nil
+	})
+
+	return
+}
+
+// RebuildResults recomputes the materialized results of the spreadsheet, e.g.
+// of the spreadsheets stored before the results were materialized. Cells
+// depending on EXTERNAL_REF are left to be evaluated on read.
+func RebuildResults(dao model.Dao, sheetId string) (changed int, err error) {
+	err = dao.Update(sheetId, func(batch *model.Batch) error {
+		cells, err := dao.GetAllCells(sheetId)
+		if err != nil {
+			return err
+		}
+
+		results, err := dao.GetAllResults(sheetId)
+		if err != nil {
+			return err
+		}
+
+		iteration, err := dao.GetIterativeCalculation(sheetId)
+		if err != nil {
+			return err
+		}
+
+		changes, err := materializeSpreadsheet(batch, sheetId, cells, results, iteration)
+		changed = len(changes)
+		return err
+	})
+
+	return
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRebuildDependencyIndex(t *testing.T) {
+	router, dao := NewMiniredisTestContext(t)
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "1").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var2", "=var1").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var3", "=var2 + var1").Code)
+
+	// Corrupt the index: stale dependant of var1 and missing one of var2
+	assert.NoError(t, dao.AddDependatFormula("devchallenge-xx", "var4", []string{"var1"}))
+	assert.NoError(t, dao.DeleteDependatFormula("devchallenge-xx", "var3", []string{"var2"}))
+
+	added, removed, err := RebuildDependencyIndex(dao, "devchallenge-xx")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, added)
+	assert.Equal(t, 1, removed)
+
+	index, err := dao.GetDependencyIndex("devchallenge-xx")
+	assert.NoError(t, err)
+	assert.Len(t, index, 2)
+	assert.ElementsMatch(t, []string{"var2", "var3"}, index["var1"])
+	assert.ElementsMatch(t, []string{"var3"}, index["var2"])
+
+	added, removed, err = RebuildDependencyIndex(dao, "devchallenge-xx")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, added)
+	assert.Equal(t, 0, removed)
+}
+
+func TestUpsertRemovesStaleDependants(t *testing.T) {
+	router, dao := NewMiniredisTestContext(t)
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "1").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var2", "2").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "VAR3", "=var1").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var3", "=var2").Code)
+
+	deps, err := dao.GetDependants("devchallenge-xx", "var1")
+	assert.NoError(t, err)
+	assert.Empty(t, deps)
+
+	deps, err = dao.GetDependants("devchallenge-xx", "var2")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"var3"}, deps)
+}
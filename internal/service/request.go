@@ -0,0 +1,65 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"devchallenge.it/spreadsheet/internal/model"
+)
+
+// AuthorHeader identifies the user making a change. The service has no
+// authentication, the header is trusted as is.
+const AuthorHeader = "X-User"
+
+// RequestIdHeader correlates a change with the request made it, an id is
+// generated when the client does not send one.
+const RequestIdHeader = "X-Request-Id"
+
+// Maximal length of names given in payloads and used in urls, e.g. snapshot
+// names.
+const maxResourceNameLength = 128
+
+func isResourceName(name string) bool {
+	return name != "" && len(name) <= maxResourceNameLength && !strings.ContainsAny(name, "/?#")
+}
+
+func requestAuthor(r *http.Request) string {
+	return r.Header.Get(AuthorHeader)
+}
+
+// requestOrigin describes the change made by the request, the request id is
+// echoed in the response.
+func requestOrigin(w http.ResponseWriter, r *http.Request) model.Origin {
+	requestId := r.Header.Get(RequestIdHeader)
+	if requestId == "" {
+		requestId = newRequestId()
+	}
+	w.Header().Set(RequestIdHeader, requestId)
+
+	return model.Origin{
+		Author:    requestAuthor(r),
+		RequestId: requestId,
+	}
+}
+
+// requestIdSeq tells apart the request ids generated without randomness.
+var requestIdSeq atomic.Uint64
+
+// newRequestId returns a random id, the ids only correlate changes so a time
+// based one is used when the random source fails.
+func newRequestId() string {
+	id := make([]byte, 8)
+	if _, err := io.ReadFull(rand.Reader, id); err != nil {
+		log.Printf("Failed to generate random request id: %v", err)
+		return fmt.Sprintf("%x-%x", time.Now().UnixNano(), requestIdSeq.Add(1))
+	}
+
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,295 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"devchallenge.it/spreadsheet/internal/formula"
+	"devchallenge.it/spreadsheet/internal/model"
+	"github.com/gorilla/mux"
+)
+
+type ConsistencyMismatch struct {
+	// Absent when the result is not materialized or the cell is missing.
+	Materialized *CellResponse `json:"materialized"`
+	Computed     *CellResponse `json:"computed"`
+}
+
+type ConsistencyResponse struct {
+	Consistent bool                           `json:"consistent"`
+	Mismatches map[string]ConsistencyMismatch `json:"mismatches"`
+}
+
+// materializeResults stores results of the cells in the batch, they are
+// solved in topological order so every formula is evaluated once. Missing
+// cells and cells depending on EXTERNAL_REF lose their results, they are
+// evaluated on read. References to cells deleted with cascade are known from
+// the materialized results only, so they are kept.
+func materializeResults(batch *model.Batch, solver *formula.Solver, materialized map[string]model.Result, cellIds []string) error {
+	order, err := solver.Order(cellIds)
+	if err != nil {
+		return err
+	}
+
+	for _, cellId := range order {
+		result, value, formulaError, err := solver.Solve(cellId)
+		if err != nil {
+			return err
+		}
+
+		if formula.IsMissingCell(value, formulaError) || solver.IsVolatile(cellId) {
+			batch.DeleteResult(cellId)
+			continue
+		}
+
+		computed := newResult(CellResult{Result: result, Value: value, FormulaError: formulaError})
+		if old, exists := materialized[cellId]; exists && isDanglingReference(old, computed) {
+			continue
+		}
+		batch.SetResult(cellId, computed)
+	}
+
+	return nil
+}
+
+// changedResults compares the solved results of the edited and the affected
+// cells with the materialized ones. Edited cells without a materialized
+// result, e.g. depending on EXTERNAL_REF, are reported as changed.
+func changedResults(solver *formula.Solver, materialized map[string]model.Result, edited, affected []string) ([]model.CellChange, error) {
+	cellIds := append(append([]string{}, edited...), affected...)
+
+	isEdited := make(map[string]struct{}, len(edited))
+	for _, cellId := range edited {
+		isEdited[strings.ToLower(cellId)] = struct{}{}
+	}
+
+	var changes []model.CellChange
+	visited := make(map[string]struct{}, len(cellIds))
+	for _, cellId := range cellIds {
+		cellId = strings.ToLower(cellId)
+		if _, exists := visited[cellId]; exists {
+			continue
+		}
+		visited[cellId] = struct{}{}
+
+		result, value, formulaError, err := solver.Solve(cellId)
+		if err != nil {
+			return nil, err
+		}
+
+		change := model.CellChange{CellId: cellId}
+		if old, exists := materialized[cellId]; exists {
+			change.Old = &old
+		}
+		if !formula.IsMissingCell(value, formulaError) {
+			computed := newResult(CellResult{Result: result, Value: value, FormulaError: formulaError})
+			change.New = &computed
+		}
+
+		switch {
+		case change.Old != nil && change.New != nil && (*change.Old == *change.New || isDanglingReference(*change.Old, *change.New)):
+			continue
+		case change.Old == nil && change.New == nil:
+			if _, exists := isEdited[cellId]; !exists {
+				continue
+			}
+		}
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+}
+
+// materializeSpreadsheet recomputes results of all the spreadsheet cells with
+// the iterative calculation setting, results of the cells missing in cells
+// are removed. Returns the changed results, removed results of the cells
+// depending on EXTERNAL_REF are not reported as they are evaluated on read.
+func materializeSpreadsheet(batch *model.Batch, sheetId string, cells map[string]string, results map[string]model.Result, iteration model.IterativeCalculation) (changes []model.CellChange, err error) {
+	solver := formula.NewSolver(model.CellsSnapshot(cells), sheetId)
+	solver.SetIterativeCalculation(iteration)
+	solver.SetOffline()
+
+	cellIds := make([]string, 0, len(cells)+len(results))
+	for cellId := range cells {
+		cellIds = append(cellIds, cellId)
+	}
+	for cellId := range results {
+		if _, exists := cells[cellId]; !exists {
+			cellIds = append(cellIds, cellId)
+		}
+	}
+
+	order, err := solver.Order(cellIds)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, cellId := range order {
+		result, value, formulaError, err := solver.Solve(cellId)
+		if err != nil {
+			return nil, err
+		}
+
+		materialized, exists := results[cellId]
+		if formula.IsMissingCell(value, formulaError) || solver.IsVolatile(cellId) {
+			if exists {
+				batch.DeleteResult(cellId)
+				if !solver.IsVolatile(cellId) {
+					changes = append(changes, model.CellChange{CellId: cellId, Old: &materialized})
+				}
+			}
+			continue
+		}
+
+		computed := newResult(CellResult{Result: result, Value: value, FormulaError: formulaError})
+		if !exists || materialized != computed {
+			batch.SetResult(cellId, computed)
+
+			change := model.CellChange{CellId: cellId, New: &computed}
+			if exists {
+				change.Old = &materialized
+			}
+			changes = append(changes, change)
+		}
+	}
+
+	return changes, nil
+}
+
+func newResult(cell CellResult) model.Result {
+	result := model.Result{Value: cell.Value, Result: cell.Result}
+	if cell.FormulaError != nil {
+		result.Error = cell.FormulaError.Error()
+	}
+
+	return result
+}
+
+// isDanglingReference reports whether the materialized result refers to a
+// cell deleted with cascade, which the cell values alone show as missing.
+func isDanglingReference(materialized, computed model.Result) bool {
+	return materialized.Value == computed.Value &&
+		materialized.Result == formula.REF && materialized.Error == formula.REFERENCE_ERROR.Error() &&
+		computed.Result == formula.ERROR && computed.Error == formula.NO_SUCH_CELL.Error()
+}
+
+func newMaterializedCellResult(result model.Result) CellResult {
+	cell := CellResult{Result: result.Result, Value: result.Value}
+	if result.Error != "" {
+		cell.FormulaError = errors.New(result.Error)
+	}
+
+	return cell
+}
+
+// readCell returns the materialized result of the cell, a cell without one
+// is evaluated.
+func (s *Service) readCell(sheetId, cellId string) (CellResult, error) {
+	result, err := s.dao.GetResult(sheetId, cellId)
+	if err == nil {
+		return newMaterializedCellResult(result), nil
+	}
+	if err != model.ERROR_NO_RESULT {
+		return CellResult{}, err
+	}
+
+	solver, err := s.newSolver(s.dao, sheetId)
+	if err != nil {
+		return CellResult{}, err
+	}
+
+	var cell CellResult
+	cell.Result, cell.Value, cell.FormulaError, err = solver.Solve(cellId)
+
+	return cell, err
+}
+
+// checkConsistency compares the materialized results with the results
+// computed from the cell values. Cells and results are read separately, so
+// a concurrent change may be reported as a mismatch.
+func (s *Service) checkConsistency(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sheetId := vars["sheet_id"]
+
+	cells, err := s.dao.GetAllCells(sheetId)
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	results, err := s.dao.GetAllResults(sheetId)
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if len(cells) == 0 && len(results) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	solver, err := s.newSolver(model.CellsSnapshot(cells), sheetId)
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	solver.SetOffline()
+
+	resp := ConsistencyResponse{Mismatches: make(map[string]ConsistencyMismatch)}
+	mismatch := func(cellId string, materialized, computed *model.Result) {
+		var m ConsistencyMismatch
+		if materialized != nil {
+			cell := NewCellResponse(newMaterializedCellResult(*materialized))
+			m.Materialized = &cell
+		}
+		if computed != nil {
+			cell := NewCellResponse(newMaterializedCellResult(*computed))
+			m.Computed = &cell
+		}
+		resp.Mismatches[cellId] = m
+	}
+
+	for cellId := range cells {
+		result, value, formulaError, err := solver.Solve(cellId)
+		if err != nil {
+			log.Print(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		materialized, exists := results[cellId]
+		if solver.IsVolatile(cellId) {
+			// Volatile results are not materialized
+			if exists {
+				mismatch(cellId, &materialized, nil)
+			}
+			continue
+		}
+
+		computed := newResult(CellResult{Result: result, Value: value, FormulaError: formulaError})
+		if !exists {
+			mismatch(cellId, nil, &computed)
+		} else if materialized != computed && !isDanglingReference(materialized, computed) {
+			mismatch(cellId, &materialized, &computed)
+		}
+	}
+
+	for cellId, materialized := range results {
+		if _, exists := cells[cellId]; !exists {
+			materialized := materialized
+			mismatch(cellId, &materialized, nil)
+		}
+	}
+
+	resp.Consistent = len(resp.Mismatches) == 0
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(&resp)
+}
@@ -0,0 +1,247 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"devchallenge.it/spreadsheet/internal/model"
+	"github.com/go-test/deep"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func GetConsistency(router *mux.Router, sheetId string) (*httptest.ResponseRecorder, ConsistencyResponse) {
+	response := Get(router, "/"+sheetId+"?consistency=true")
+
+	var resp ConsistencyResponse
+	json.NewDecoder(response.Body).Decode(&resp)
+
+	return response, resp
+}
+
+func TestGetCellMaterialized(t *testing.T) {
+	tctx := NewTestContext()
+
+	tctx.mock.ExpectHGet(testResultsKey, "var1").SetVal(`{"value":"=var2","result":"2"}`)
+
+	response := Get(tctx.router, "/devchallenge-xx/var1")
+
+	var resp CellResponse
+	json.NewDecoder(response.Body).Decode(&resp)
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	if diff := deep.Equal(resp, CellResponse{Value: "=var2", Result: "2"}); diff != nil {
+		t.Error(diff)
+	}
+
+	assert.NoError(t, tctx.mock.ExpectationsWereMet())
+}
+
+func TestUpsertMaterializesDependants(t *testing.T) {
+	router, dao := NewMiniredisTestContext(t)
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "1").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var2", "=var1+1").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var3", "=var2*var1").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "3").Code)
+
+	results, err := dao.GetAllResults("devchallenge-xx")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]model.Result{
+		"var1": {Value: "3", Result: "3"},
+		"var2": {Value: "=var1+1", Result: "4"},
+		"var3": {Value: "=var2*var1", Result: "12"},
+	}, results)
+
+	// Rejected change keeps the results
+	assert.Equal(t, http.StatusUnprocessableEntity, PostCell(router, "devchallenge-xx", "var1", "=var3").Code)
+
+	result, err := dao.GetResult("devchallenge-xx", "var3")
+	assert.NoError(t, err)
+	assert.Equal(t, "12", result.Result)
+}
+
+func TestDeleteCellRemovesResult(t *testing.T) {
+	router, dao := NewMiniredisTestContext(t)
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "1").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var2", "=var1").Code)
+
+	assert.Equal(t, http.StatusNoContent, Delete(router, "/devchallenge-xx/var1?cascade=true").Code)
+
+	_, err := dao.GetResult("devchallenge-xx", "var1")
+	assert.Equal(t, model.ERROR_NO_RESULT, err)
+
+	response, resp := GetConsistency(router, "devchallenge-xx")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.True(t, resp.Consistent, resp.Mismatches)
+}
+
+func TestIterativeCalculationMaterializesResults(t *testing.T) {
+	router, dao := NewMiniredisTestContext(t)
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var2", "1").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "=var2/2").Code)
+
+	// The cycle is allowed by the setting only
+	assert.Equal(t, http.StatusOK, PatchSpreadsheet(router, "devchallenge-xx", "", `{"iterative_calculation": {"enabled": true}}`).Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var2", "=var1/2+1").Code)
+
+	assert.Equal(t, http.StatusOK, PatchSpreadsheet(router, "devchallenge-xx", "", `{"iterative_calculation": {"enabled": false}}`).Code)
+
+	result, err := dao.GetResult("devchallenge-xx", "var2")
+	assert.NoError(t, err)
+	assert.Equal(t, "ERROR", result.Result)
+
+	_, resp := GetConsistency(router, "devchallenge-xx")
+	assert.True(t, resp.Consistent, resp.Mismatches)
+}
+
+func TestConsistency(t *testing.T) {
+	router, dao := NewMiniredisTestContext(t)
+
+	external := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(CellResponse{Value: "7", Result: "7"})
+	}))
+	defer external.Close()
+
+	assert.Equal(t, http.StatusNotFound, Get(router, "/devchallenge-xx?consistency=true").Code)
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "1").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var2", "=var1+1").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var3", "=EXTERNAL_REF("+external.URL+"/api/v1/devchallenge-yy/var1)").Code)
+
+	// Cells depending on EXTERNAL_REF are evaluated on read
+	_, err := dao.GetResult("devchallenge-xx", "var3")
+	assert.Equal(t, model.ERROR_NO_RESULT, err)
+
+	response, resp := GetConsistency(router, "devchallenge-xx")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.True(t, resp.Consistent)
+	assert.Empty(t, resp.Mismatches)
+
+	// Stale and missing results, e.g. of the cells written before the
+	// results were materialized
+	assert.NoError(t, dao.Update("devchallenge-xx", func(batch *model.Batch) error {
+		batch.SetResult("var2", model.Result{Value: "=var1+1", Result: "5"})
+		batch.DeleteResult("var1")
+		batch.SetResult("var4", model.Result{Value: "4", Result: "4"})
+		return nil
+	}))
+
+	// Reads return the materialized results
+	var cell CellResponse
+	json.NewDecoder(Get(router, "/devchallenge-xx/var2").Body).Decode(&cell)
+	assert.Equal(t, "5", cell.Result)
+
+	_, resp = GetConsistency(router, "devchallenge-xx")
+	assert.False(t, resp.Consistent)
+	want := map[string]ConsistencyMismatch{
+		"var1": {Computed: &CellResponse{Value: "1", Result: "1"}},
+		"var2": {
+			Materialized: &CellResponse{Value: "=var1+1", Result: "5"},
+			Computed:     &CellResponse{Value: "=var1+1", Result: "2"},
+		},
+		"var4": {Materialized: &CellResponse{Value: "4", Result: "4"}},
+	}
+	if diff := deep.Equal(resp.Mismatches, want); diff != nil {
+		t.Error(diff)
+	}
+
+	changed, err := RebuildResults(dao, "devchallenge-xx")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, changed)
+
+	_, resp = GetConsistency(router, "devchallenge-xx")
+	assert.True(t, resp.Consistent, resp.Mismatches)
+
+	changed, err = RebuildResults(dao, "devchallenge-xx")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, changed)
+}
+
+func TestCopyMaterializesResults(t *testing.T) {
+	router, dao := NewMiniredisTestContext(t)
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "2").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var2", "=var1*2").Code)
+
+	assert.Equal(t, http.StatusCreated, PostCopy(router, "devchallenge-xx", CopyPayload{Id: "devchallenge-yy"}).Code)
+
+	results, err := dao.GetAllResults("devchallenge-yy")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]model.Result{
+		"var1": {Value: "2", Result: "2"},
+		"var2": {Value: "=var1*2", Result: "4"},
+	}, results)
+}
+
+func TestConsistencyCellRoutes(t *testing.T) {
+	router, _ := NewMiniredisTestContext(t)
+
+	// A cell named consistency is not taken by the check
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "consistency", "1").Code)
+
+	response := Get(router, "/devchallenge-xx/consistency")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"value": "1", "result": "1"}`, response.Body.String())
+
+	response, resp := GetConsistency(router, "devchallenge-xx")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.True(t, resp.Consistent)
+
+	response = Get(router, "/devchallenge-xx?consistency=false")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"consistency": {"value": "1", "result": "1"}}`, response.Body.String())
+}
+
+func TestReservedCellIds(t *testing.T) {
+	router, _ := NewMiniredisTestContext(t)
+
+	// Cells named after spreadsheet routes could not be read or written
+	// again, so they are not created
+	for _, cellId := range []string{"Undo", "REDO", "Copy", "Evaluate", "GoalSeek", "Snapshots"} {
+		assert.Equal(t, http.StatusBadRequest, PostCell(router, "devchallenge-xx", cellId, "1").Code, cellId)
+		assert.Equal(t, http.StatusBadRequest, PostCells(router, "devchallenge-xx", map[string]string{"var1": "1", cellId: "2"}).Code, cellId)
+	}
+
+	assert.Equal(t, http.StatusNotFound, Get(router, "/devchallenge-xx").Code)
+}
+
+func TestIterativeCalculationNotifiesChanges(t *testing.T) {
+	router, _ := NewMiniredisTestContext(t)
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var2", "1").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "=var2/2").Code)
+	assert.Equal(t, http.StatusOK, PatchSpreadsheet(router, "devchallenge-xx", "", `{"iterative_calculation": {"enabled": true}}`).Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var2", "=var1/2+1").Code)
+
+	ws := DialWebsocket(t, router)
+	sendWs(t, ws, WsRequest{Type: "subscribe", Id: "1", SheetId: "devchallenge-xx", CellIds: []string{"var1", "var2"}})
+	assert.Equal(t, "ack", receiveWs(t, ws).Type)
+	for i := 0; i < 2; i++ {
+		assert.Empty(t, receiveWs(t, ws).Cell.Error)
+	}
+
+	// The cycle fails once the setting is disabled
+	assert.Equal(t, http.StatusOK, PatchSpreadsheet(router, "devchallenge-xx", "", `{"iterative_calculation": {"enabled": false}}`).Code)
+
+	changed := make(map[string]string)
+	for i := 0; i < 2; i++ {
+		msg := receiveWs(t, ws)
+		assert.NotZero(t, msg.EventId)
+		changed[msg.CellId] = msg.Cell.Result
+	}
+	assert.Equal(t, map[string]string{"var1": "ERROR", "var2": "ERROR"}, changed)
+
+	// Changing the title only changes no result
+	assert.Equal(t, http.StatusOK, PatchSpreadsheet(router, "devchallenge-xx", "", `{"title": "Cycle"}`).Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var3", "3").Code)
+	assert.Equal(t, http.StatusOK, PatchSpreadsheet(router, "devchallenge-xx", "", `{"iterative_calculation": {"enabled": true}}`).Code)
+
+	msg := receiveWs(t, ws)
+	assert.Contains(t, []string{"var1", "var2"}, msg.CellId)
+	assert.NotEqual(t, "ERROR", msg.Cell.Result)
+}
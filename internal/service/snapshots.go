@@ -0,0 +1,218 @@
+package service
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"devchallenge.it/spreadsheet/internal/model"
+	"github.com/gorilla/mux"
+)
+
+type SnapshotPayload struct {
+	Name string
+}
+
+type SnapshotResponse struct {
+	Name      string    `json:"name"`
+	Author    string    `json:"author,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	CellCount int       `json:"cell_count"`
+}
+
+func NewSnapshotResponse(snapshot model.Snapshot) SnapshotResponse {
+	return SnapshotResponse{
+		Name:      snapshot.Name,
+		Author:    snapshot.Author,
+		CreatedAt: snapshot.CreatedAt,
+		CellCount: len(snapshot.Cells),
+	}
+}
+
+// createSnapshot copies the raw values of all the spreadsheet cells under the
+// given name, the cells are read at once so the copy is consistent.
+func (s *Service) createSnapshot(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sheetId := vars["sheet_id"]
+
+	contentType := r.Header.Get("Content-Type")
+	if strings.Compare(contentType, "application/json") != 0 {
+		log.Printf("Snapshot invalid content type %s", contentType)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var payload SnapshotPayload
+	if err := NewJsonDecoder(r.Body).Decode(&payload); err != nil {
+		log.Printf("Body decode error: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if !isResourceName(payload.Name) {
+		log.Printf("Snapshot name %q is not valid", payload.Name)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	cells, err := s.dao.GetAllCells(sheetId)
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if len(cells) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	snapshot := model.Snapshot{
+		Name:      strings.ToLower(payload.Name),
+		Author:    requestAuthor(r),
+		CreatedAt: time.Now().UTC(),
+		Cells:     cells,
+	}
+	if err := s.dao.CreateSnapshot(sheetId, snapshot); err != nil {
+		if err == model.ERROR_SNAPSHOT_EXISTS {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	resp := NewSnapshotResponse(snapshot)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(&resp)
+}
+
+func (s *Service) listSnapshots(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sheetId := vars["sheet_id"]
+
+	snapshots, err := s.dao.ListSnapshots(sheetId)
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]SnapshotResponse, len(snapshots))
+	for i, snapshot := range snapshots {
+		resp[i] = NewSnapshotResponse(snapshot)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(&resp)
+}
+
+// getSnapshot evaluates the snapshot cells, the live spreadsheet is not read.
+func (s *Service) getSnapshot(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sheetId := vars["sheet_id"]
+
+	snapshot, err := s.dao.GetSnapshot(sheetId, vars["name"])
+	if err != nil {
+		if err == model.ERROR_NO_SNAPSHOT {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	cellIds := make([]string, 0, len(snapshot.Cells))
+	for cellId := range snapshot.Cells {
+		cellIds = append(cellIds, cellId)
+	}
+
+	solver, err := s.newSolver(model.CellsSnapshot(snapshot.Cells), sheetId)
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	resp, err := solveCells(solver, cellIds)
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(&resp)
+}
+
+// restoreSnapshot replaces all the spreadsheet cells with the snapshot ones
+// in a single update, the changed cells are validated like upserted ones and
+// the restore could be undone. Response contains the changed cells.
+func (s *Service) restoreSnapshot(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sheetId := vars["sheet_id"]
+
+	snapshot, err := s.dao.GetSnapshot(sheetId, vars["name"])
+	if err != nil {
+		if err == model.ERROR_NO_SNAPSHOT {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var changes []model.EditCell
+	results, stored, err := s.writeCells(sheetId, requestOrigin(w, r), func(*model.Batch) ([]model.EditCell, error) {
+		cells, err := s.dao.GetAllCells(sheetId)
+		if err != nil {
+			return nil, err
+		}
+
+		changes = nil
+		for cellId, value := range snapshot.Cells {
+			if current, exists := cells[cellId]; !exists || current != value {
+				changes = append(changes, model.EditCell{CellId: cellId, Value: value})
+			}
+		}
+		for cellId := range cells {
+			if _, exists := snapshot.Cells[cellId]; !exists {
+				changes = append(changes, model.EditCell{CellId: cellId, Deleted: true})
+			}
+		}
+
+		return changes, nil
+	})
+	if err != nil {
+		log.Print(err)
+		if err == model.ERROR_UPDATE_CONFLICT {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	resp := make(SpreadsheetResponse, len(results))
+	for cellId, cell := range results {
+		resp[cellId] = NewCellResponse(cell)
+	}
+
+	responseStatus := http.StatusUnprocessableEntity
+	if stored {
+		responseStatus = http.StatusOK
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(responseStatus)
+	json.NewEncoder(w).Encode(&resp)
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func PostSnapshot(router *mux.Router, sheetId, name string) *httptest.ResponseRecorder {
+	jsonBody, _ := json.Marshal(SnapshotPayload{Name: name})
+
+	request, _ := http.NewRequest(http.MethodPost, "/"+sheetId+"/snapshots", bytes.NewReader(jsonBody))
+	request.Header.Add("Content-Type", "application/json")
+	request.Header.Add(AuthorHeader, "alice")
+	response := httptest.NewRecorder()
+
+	router.ServeHTTP(response, request)
+
+	return response
+}
+
+func TestSnapshots(t *testing.T) {
+	router, _ := NewMiniredisTestContext(t)
+
+	assert.Equal(t, http.StatusNotFound, PostSnapshot(router, "devchallenge-xx", "month-end").Code)
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "1").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var2", "=var1 + 1").Code)
+
+	response := PostSnapshot(router, "devchallenge-xx", "Month-End")
+	assert.Equal(t, http.StatusCreated, response.Code)
+
+	var snapshot SnapshotResponse
+	json.NewDecoder(response.Body).Decode(&snapshot)
+	assert.Equal(t, "month-end", snapshot.Name)
+	assert.Equal(t, "alice", snapshot.Author)
+	assert.Equal(t, 2, snapshot.CellCount)
+
+	assert.Equal(t, http.StatusConflict, PostSnapshot(router, "devchallenge-xx", "month-end").Code)
+	assert.Equal(t, http.StatusBadRequest, PostSnapshot(router, "devchallenge-xx", "").Code)
+	assert.Equal(t, http.StatusBadRequest, PostSnapshot(router, "devchallenge-xx", "a/b").Code)
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "10").Code)
+	assert.Equal(t, http.StatusCreated, PostSnapshot(router, "devchallenge-xx", "later").Code)
+
+	response = Get(router, "/devchallenge-xx/snapshots")
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	var snapshots []SnapshotResponse
+	json.NewDecoder(response.Body).Decode(&snapshots)
+	if assert.Len(t, snapshots, 2) {
+		assert.Equal(t, "month-end", snapshots[0].Name)
+		assert.Equal(t, "later", snapshots[1].Name)
+	}
+
+	response = Get(router, "/devchallenge-xx/snapshots/MONTH-END")
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	var resp SpreadsheetResponse
+	json.NewDecoder(response.Body).Decode(&resp)
+	assert.Equal(t, SpreadsheetResponse{
+		"var1": {Value: "1", Result: "1"},
+		"var2": {Value: "=var1 + 1", Result: "2"},
+	}, resp)
+
+	assert.Equal(t, http.StatusNotFound, Get(router, "/devchallenge-xx/snapshots/missing").Code)
+}
+
+func TestRestoreSnapshot(t *testing.T) {
+	router, dao := NewMiniredisTestContext(t)
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "1").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var2", "=var1 + 1").Code)
+	assert.Equal(t, http.StatusCreated, PostSnapshot(router, "devchallenge-xx", "month-end").Code)
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "10").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var3", "=var2 * 2").Code)
+	assert.Equal(t, http.StatusNoContent, Delete(router, "/devchallenge-xx/var3").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var4", "=var2 * 3").Code)
+
+	assert.Equal(t, http.StatusNotFound, Post(router, "/devchallenge-xx/snapshots/missing/restore").Code)
+
+	response := Post(router, "/devchallenge-xx/snapshots/month-end/restore")
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	var resp SpreadsheetResponse
+	json.NewDecoder(response.Body).Decode(&resp)
+	assert.Equal(t, SpreadsheetResponse{"var1": {Value: "1", Result: "1"}}, resp)
+
+	cells, err := dao.GetAllCells("devchallenge-xx")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"var1": "1", "var2": "=var1 + 1"}, cells)
+
+	index, err := dao.GetDependencyIndex("devchallenge-xx")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{"var1": {"var2"}}, index)
+
+	// Restore is a single edit
+	assert.Equal(t, http.StatusOK, Post(router, "/devchallenge-xx/undo").Code)
+
+	cells, err = dao.GetAllCells("devchallenge-xx")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"var1": "10", "var2": "=var1 + 1", "var4": "=var2 * 3"}, cells)
+}
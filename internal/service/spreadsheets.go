@@ -0,0 +1,239 @@
+package service
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"devchallenge.it/spreadsheet/internal/formula"
+	"devchallenge.it/spreadsheet/internal/model"
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+type SpreadsheetInfoResponse struct {
+	Id        string    `json:"id"`
+	Title     string    `json:"title"`
+	Owner     string    `json:"owner"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	CellCount int       `json:"cell_count"`
+
+	IterativeCalculation IterativeCalculationResponse `json:"iterative_calculation"`
+}
+
+type IterativeCalculationResponse struct {
+	Enabled       bool    `json:"enabled"`
+	MaxIterations int     `json:"max_iterations"`
+	Epsilon       float64 `json:"epsilon"`
+}
+
+type SpreadsheetListResponse struct {
+	Spreadsheets []SpreadsheetInfoResponse `json:"spreadsheets"`
+
+	// Passed as the after parameter to fetch the next page, omitted on the
+	// last one.
+	Next string `json:"next,omitempty"`
+}
+
+type SpreadsheetInfoPayload struct {
+	Title                *string
+	IterativeCalculation *IterativeCalculationPayload `json:"iterative_calculation"`
+}
+
+// IterativeCalculationPayload replaces the setting, zero limits are replaced
+// by the defaults.
+type IterativeCalculationPayload struct {
+	Enabled       bool
+	MaxIterations int `json:"max_iterations"`
+	Epsilon       float64
+}
+
+// Upper bound of the iterations, as in the common spreadsheet applications.
+const maxIterations = 32767
+
+func NewSpreadsheetInfoResponse(info model.SpreadsheetInfo) SpreadsheetInfoResponse {
+	iteration := info.IterativeCalculation
+	if iteration.MaxIterations == 0 {
+		iteration.MaxIterations = formula.DefaultMaxIterations
+	}
+	if iteration.Epsilon == 0 {
+		iteration.Epsilon = formula.DefaultEpsilon
+	}
+
+	return SpreadsheetInfoResponse{
+		Id:        info.Id,
+		Title:     info.Title,
+		Owner:     info.Owner,
+		CreatedAt: info.CreatedAt,
+		UpdatedAt: info.UpdatedAt,
+		CellCount: info.CellCount,
+
+		IterativeCalculation: IterativeCalculationResponse{
+			Enabled:       iteration.Enabled,
+			MaxIterations: iteration.MaxIterations,
+			Epsilon:       iteration.Epsilon,
+		},
+	}
+}
+
+// newSolver returns a solver of the cells given by the source configured with
+// the spreadsheet settings.
+func (s *Service) newSolver(source formula.CellSource, sheetId string) (*formula.Solver, error) {
+	iteration, err := s.dao.GetIterativeCalculation(sheetId)
+	if err != nil {
+		return nil, err
+	}
+
+	solver := formula.NewSolver(source, sheetId)
+	solver.SetIterativeCalculation(iteration)
+
+	return solver, nil
+}
+
+// listSpreadsheets pages through the spreadsheet registry ordered by id,
+// optionally filtered by the id prefix.
+func (s *Service) listSpreadsheets(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit := defaultListLimit
+	if limitParam := query.Get("limit"); limitParam != "" {
+		var err error
+		limit, err = strconv.Atoi(limitParam)
+		if err != nil || limit < 1 || limit > maxListLimit {
+			log.Printf("Invalid limit parameter %q", limitParam)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	// One more entry tells whether there is a next page.
+	infos, err := s.dao.ListSpreadsheets(query.Get("prefix"), query.Get("after"), limit+1)
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	resp := SpreadsheetListResponse{
+		Spreadsheets: make([]SpreadsheetInfoResponse, 0, len(infos)),
+	}
+	if len(infos) > limit {
+		infos = infos[:limit]
+		resp.Next = infos[limit-1].Id
+	}
+	for _, info := range infos {
+		resp.Spreadsheets = append(resp.Spreadsheets, NewSpreadsheetInfoResponse(info))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(&resp)
+}
+
+func (s *Service) updateSpreadsheetInfo(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sheetId := vars["sheet_id"]
+
+	contentType := r.Header.Get("Content-Type")
+	if strings.Compare(contentType, "application/json") != 0 {
+		log.Printf("Update invalid content type %s", contentType)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var payload SpreadsheetInfoPayload
+	if err := NewJsonDecoder(r.Body).Decode(&payload); err != nil {
+		log.Printf("Body decode error: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if iteration := payload.IterativeCalculation; iteration != nil {
+		if iteration.MaxIterations < 0 || iteration.MaxIterations > maxIterations || iteration.Epsilon < 0 {
+			log.Printf("Invalid iterative calculation %+v", *iteration)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	if _, err := s.dao.GetSpreadsheetInfo(sheetId); err != nil {
+		if err == model.ERROR_NO_SPREADSHEET {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var changes []model.CellChange
+
+	origin := requestOrigin(w, r)
+	err := s.dao.Update(sheetId, func(batch *model.Batch) error {
+		batch.SetOrigin(origin)
+		if payload.Title != nil {
+			batch.SetTitle(*payload.Title)
+		}
+		if payload.IterativeCalculation == nil {
+			return nil
+		}
+
+		iteration := model.IterativeCalculation{
+			Enabled:       payload.IterativeCalculation.Enabled,
+			MaxIterations: payload.IterativeCalculation.MaxIterations,
+			Epsilon:       payload.IterativeCalculation.Epsilon,
+		}
+		batch.SetIterativeCalculation(iteration)
+
+		// Circular references are evaluated differently with the new setting
+		cells, err := s.dao.GetAllCells(sheetId)
+		if err != nil {
+			return err
+		}
+
+		results, err := s.dao.GetAllResults(sheetId)
+		if err != nil {
+			return err
+		}
+
+		changes, err = materializeSpreadsheet(batch, sheetId, cells, results, iteration)
+		if err != nil {
+			return err
+		}
+
+		batch.PublishCellChanges(changes)
+		return nil
+	})
+	if err != nil {
+		log.Print(err)
+		if err == model.ERROR_UPDATE_CONFLICT {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	s.enqueueWebhooks(sheetId, changes)
+
+	info, err := s.dao.GetSpreadsheetInfo(sheetId)
+	if err != nil {
+		log.Print(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	resp := NewSpreadsheetInfoResponse(info)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(&resp)
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"devchallenge.it/spreadsheet/internal/formula"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func ListSpreadsheets(router *mux.Router, query string) (*httptest.ResponseRecorder, SpreadsheetListResponse) {
+	request, _ := http.NewRequest(http.MethodGet, "/?"+query, nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+
+	var resp SpreadsheetListResponse
+	json.NewDecoder(response.Body).Decode(&resp)
+
+	return response, resp
+}
+
+func PatchSpreadsheet(router *mux.Router, sheetId, author, body string) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest(http.MethodPatch, "/"+sheetId, strings.NewReader(body))
+	request.Header.Add("Content-Type", "application/json")
+	request.Header.Add(AuthorHeader, author)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+
+	return response
+}
+
+func TestListSpreadsheets(t *testing.T) {
+	router, _ := NewMiniredisTestContext(t)
+
+	for _, sheetId := range []string{"devchallenge-xx", "devchallenge-yy", "other", "devchallenge-zz"} {
+		request, _ := http.NewRequest(http.MethodPost, "/"+sheetId+"/var1", CreateUpsertPayload("1"))
+		request.Header.Add("Content-Type", "application/json")
+		request.Header.Add(AuthorHeader, "alice")
+		router.ServeHTTP(httptest.NewRecorder(), request)
+	}
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var2", "2").Code)
+
+	response, resp := ListSpreadsheets(router, "prefix=devchallenge&limit=2")
+	assert.Equal(t, http.StatusOK, response.Code)
+	if assert.Len(t, resp.Spreadsheets, 2) {
+		assert.Equal(t, "devchallenge-xx", resp.Spreadsheets[0].Id)
+		assert.Equal(t, "alice", resp.Spreadsheets[0].Owner)
+		assert.Equal(t, 2, resp.Spreadsheets[0].CellCount)
+		assert.Equal(t, "devchallenge-yy", resp.Spreadsheets[1].Id)
+	}
+	assert.Equal(t, "devchallenge-yy", resp.Next)
+
+	_, resp = ListSpreadsheets(router, "prefix=devchallenge&limit=2&after="+resp.Next)
+	if assert.Len(t, resp.Spreadsheets, 1) {
+		assert.Equal(t, "devchallenge-zz", resp.Spreadsheets[0].Id)
+	}
+	assert.Empty(t, resp.Next)
+
+	_, resp = ListSpreadsheets(router, "")
+	assert.Len(t, resp.Spreadsheets, 4)
+
+	response, _ = ListSpreadsheets(router, "limit=0")
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+}
+
+func TestUpdateSpreadsheetTitle(t *testing.T) {
+	router, dao := NewMiniredisTestContext(t)
+
+	assert.Equal(t, http.StatusNotFound, PatchSpreadsheet(router, "devchallenge-xx", "bob", `{"title": "Budget"}`).Code)
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "1").Code)
+
+	response := PatchSpreadsheet(router, "DevChallenge-XX", "bob", `{"title": "Budget"}`)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	var resp SpreadsheetInfoResponse
+	json.NewDecoder(response.Body).Decode(&resp)
+	assert.Equal(t, "Budget", resp.Title)
+	assert.Equal(t, "", resp.Owner)
+	assert.Equal(t, 1, resp.CellCount)
+
+	info, err := dao.GetSpreadsheetInfo("devchallenge-xx")
+	assert.NoError(t, err)
+	assert.Equal(t, "Budget", info.Title)
+
+	assert.Equal(t, http.StatusBadRequest, PatchSpreadsheet(router, "devchallenge-xx", "bob", `{"owner": "bob"}`).Code)
+}
+
+func TestIterativeCalculation(t *testing.T) {
+	router, _ := NewMiniredisTestContext(t)
+
+	result := func(cellId string) string {
+		var cell CellResponse
+		json.NewDecoder(Get(router, "/devchallenge-xx/"+cellId).Body).Decode(&cell)
+		return cell.Result
+	}
+
+	assert.Equal(t, http.StatusCreated, PostCells(router, "devchallenge-xx", map[string]string{
+		"opening":  "1000",
+		"rate":     "0.1",
+		"interest": "=rate * opening",
+		"closing":  "=opening + interest",
+	}).Code)
+
+	// Circular references are rejected by default
+	assert.Equal(t, http.StatusUnprocessableEntity, PostCell(router, "devchallenge-xx", "interest", "=rate * (opening + closing) / 2").Code)
+
+	response := PatchSpreadsheet(router, "devchallenge-xx", "bob", `{"iterative_calculation": {"enabled": true, "epsilon": 1e-9}}`)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	var resp SpreadsheetInfoResponse
+	json.NewDecoder(response.Body).Decode(&resp)
+	assert.Equal(t, IterativeCalculationResponse{Enabled: true, MaxIterations: 100, Epsilon: 1e-9}, resp.IterativeCalculation)
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "interest", "=rate * (opening + closing) / 2").Code)
+
+	assert.True(t, strings.HasPrefix(result("closing"), "1105.263157"), result("closing"))
+
+	// Diverging cycle does not converge in the iterations limit
+	assert.Equal(t, http.StatusOK, PatchSpreadsheet(router, "devchallenge-xx", "bob", `{"iterative_calculation": {"enabled": true, "max_iterations": 10}}`).Code)
+	response = PostCell(router, "devchallenge-xx", "rate", "=closing")
+	assert.Equal(t, http.StatusUnprocessableEntity, response.Code)
+
+	var cellResp CellResponse
+	json.NewDecoder(response.Body).Decode(&cellResp)
+	if assert.NotNil(t, cellResp.Error) {
+		assert.Equal(t, formula.NOT_CONVERGED_ERROR.Error(), *cellResp.Error)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, PatchSpreadsheet(router, "devchallenge-xx", "bob", `{"iterative_calculation": {"max_iterations": -1}}`).Code)
+
+	// Disabling leaves the stored cycle failing
+	assert.Equal(t, http.StatusOK, PatchSpreadsheet(router, "devchallenge-xx", "bob", `{"iterative_calculation": {"enabled": false}}`).Code)
+	assert.Equal(t, formula.ERROR, result("closing"))
+}
@@ -5,14 +5,25 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"strings"
 
-	"devchallenge.it/spreadsheet/internal/formula"
 	"devchallenge.it/spreadsheet/internal/model"
 	"github.com/gorilla/mux"
 )
 
+// SubscribePayload requests the changes POSTed to the callback url, the
+// subscription is still readable as a stream.
+type SubscribePayload struct {
+	CallbackUrl string `json:"callback_url"`
+}
+
 type SubsribeResponse struct {
 	WebhookUrl string `json:"webhook_url"`
+
+	// Set for callback subscriptions, the secret is not returned again
+	CallbackUrl   string `json:"callback_url,omitempty"`
+	Secret        string `json:"secret,omitempty"`
+	DeliveriesUrl string `json:"deliveries_url,omitempty"`
 }
 
 func (s *Service) subscribeCell(w http.ResponseWriter, r *http.Request) {
@@ -20,7 +31,46 @@ func (s *Service) subscribeCell(w http.ResponseWriter, r *http.Request) {
 	sheetId := vars["sheet_id"]
 	cellId := vars["cell_id"]
 
-	id, err := s.dao.CreateSubscription(sheetId, cellId)
+	var payload SubscribePayload
+	if r.ContentLength != 0 {
+		contentType := r.Header.Get("Content-Type")
+		if strings.Compare(contentType, "application/json") != 0 {
+			log.Printf("Subscribe invalid content type %s", contentType)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if err := NewJsonDecoder(r.Body).Decode(&payload); err != nil {
+			log.Printf("Body decode error: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if !isCallbackUrl(payload.CallbackUrl) {
+			log.Printf("Invalid callback url %q", payload.CallbackUrl)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if err := s.webhooks.checkCallbackHost(r.Context(), payload.CallbackUrl); err != nil {
+			log.Printf("Invalid callback url %q: %v", payload.CallbackUrl, err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	var id, secret string
+	var err error
+	if payload.CallbackUrl != "" {
+		if secret, err = newWebhookSecret(); err != nil {
+			log.Printf("Failed to generate webhook secret: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		id, err = s.dao.CreateWebhook(sheetId, cellId, payload.CallbackUrl, secret)
+	} else {
+		id, err = s.dao.CreateSubscription(sheetId, cellId)
+	}
 	if err != nil {
 		log.Printf("Failed to get next id: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -49,6 +99,12 @@ func (s *Service) subscribeCell(w http.ResponseWriter, r *http.Request) {
 	resp := SubsribeResponse{
 		WebhookUrl: url.String(),
 	}
+	if payload.CallbackUrl != "" {
+		url.Path += "/deliveries"
+		resp.CallbackUrl = payload.CallbackUrl
+		resp.Secret = secret
+		resp.DeliveriesUrl = url.String()
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -71,11 +127,17 @@ func (s *Service) subscribeHook(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	defer subscriber.Close()
 
 	data, _ := s.dao.GetSubscription(subId)
 	sheetId := data["spreadsheetId"]
 	cellId := data["cellId"]
 
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		s.streamEvents(w, r, subscriber, subId, sheetId, cellId)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 
@@ -84,32 +146,40 @@ func (s *Service) subscribeHook(w http.ResponseWriter, r *http.Request) {
 	encoder := json.NewEncoder(w)
 
 	for {
-		_, err := subscriber.ReceiveMessage(r.Context())
+		msg, err := subscriber.ReceiveMessage(r.Context())
 		if err != nil {
 			log.Printf("Unexpected error: %v", err)
 			return
 		}
 
-		solver := formula.NewSolver(s.dao, sheetId)
-		result, value, formulaError, err := solver.Solve(cellId)
-		if err != nil {
-			log.Printf("Failed to get cell: %s", err)
-			w.WriteHeader(http.StatusInternalServerError)
+		// The subscription is removed together with its spreadsheet
+		if _, err := s.dao.GetSubscription(subId); err == model.ERROR_NO_SUBSCRIPTION {
 			return
 		}
 
-		var errorMsg *string
-		if formulaError != nil {
-			errorMsg = new(string)
-			*errorMsg = formulaError.Error()
+		var change model.CellChange
+		if err := json.Unmarshal([]byte(msg), &change); err != nil {
+			log.Printf("Invalid cell change %q: %v", msg, err)
 		}
-		resp := CellResponse{
-			Value:  value,
-			Result: result,
-			Error:  errorMsg,
+
+		cell, err := s.changedCell(sheetId, cellId, change)
+		if err != nil {
+			log.Printf("Failed to get cell: %s", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
 		}
 
-		encoder.Encode(resp)
+		encoder.Encode(NewCellResponse(cell))
 		f.Flush()
 	}
 }
+
+// changedCell returns the published result as is, a truncated or deleted one
+// is read.
+func (s *Service) changedCell(sheetId, cellId string, change model.CellChange) (CellResult, error) {
+	if change.New != nil {
+		return newMaterializedCellResult(*change.New), nil
+	}
+
+	return s.readCell(sheetId, cellId)
+}
@@ -1,22 +1,26 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"devchallenge.it/spreadsheet/internal/model"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestSubscribeCell(t *testing.T) {
 	tctx := NewTestContext()
 
-	tctx.mock.ExpectIncr("subscription:counter").SetVal(10)
-	tctx.mock.ExpectHSet("subscription:a", map[string]string{
+	tctx.mock.ExpectIncr("spreadsheet:subscription:counter").SetVal(10)
+	tctx.mock.ExpectHSet("spreadsheet:subscription:a", map[string]string{
 		"spreadsheetId": "devchallenge-xx",
 		"cellId":        "var1",
 	}).SetVal(1)
+	tctx.mock.ExpectSAdd("spreadsheet:sheet:{devchallenge-xx}:subscriptions", "a").SetVal(1)
 
 	request, _ := http.NewRequest(http.MethodPost, "/devchallenge-xx/var1/subscribe", nil)
 	response := httptest.NewRecorder()
@@ -33,3 +37,73 @@ func TestSubscribeCell(t *testing.T) {
 
 	assert.NoError(t, tctx.mock.ExpectationsWereMet())
 }
+
+// receiveChanges returns the changes received by the subscriber until none
+// arrives for a while.
+func receiveChanges(t *testing.T, subscriber model.Subscriber) []model.CellChange {
+	var changes []model.CellChange
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		msg, err := subscriber.ReceiveMessage(ctx)
+		cancel()
+		if err != nil {
+			return changes
+		}
+
+		var change model.CellChange
+		assert.NoError(t, json.Unmarshal([]byte(msg), &change))
+		assert.NotZero(t, change.EventId)
+		change.EventId = 0
+		changes = append(changes, change)
+	}
+}
+
+func TestNotifyChangedResults(t *testing.T) {
+	router, dao := NewMiniredisTestContext(t)
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "1").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var2", "=var1 * 0").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var3", "=var1 + 1").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var4", "=var2 + var3").Code)
+
+	subscribers := make(map[string]model.Subscriber)
+	for _, cellId := range []string{"var1", "var2", "var3", "var4"} {
+		subId, err := dao.CreateSubscription("devchallenge-xx", cellId)
+		assert.NoError(t, err)
+		subscribers[cellId], err = dao.Subscribe(subId)
+		assert.NoError(t, err)
+		defer subscribers[cellId].Close()
+	}
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "2").Code)
+
+	assert.Equal(t, []model.CellChange{{
+		CellId: "var1",
+		Old:    &model.Result{Value: "1", Result: "1"},
+		New:    &model.Result{Value: "2", Result: "2"},
+	}}, receiveChanges(t, subscribers["var1"]))
+	assert.Empty(t, receiveChanges(t, subscribers["var2"]))
+	assert.Equal(t, []model.CellChange{{
+		CellId: "var3",
+		Old:    &model.Result{Value: "=var1 + 1", Result: "2"},
+		New:    &model.Result{Value: "=var1 + 1", Result: "3"},
+	}}, receiveChanges(t, subscribers["var3"]))
+	// The diamond bottom is notified once
+	assert.Equal(t, []model.CellChange{{
+		CellId: "var4",
+		Old:    &model.Result{Value: "=var2 + var3", Result: "2"},
+		New:    &model.Result{Value: "=var2 + var3", Result: "3"},
+	}}, receiveChanges(t, subscribers["var4"]))
+
+	// Nothing changes
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "2").Code)
+	for cellId, subscriber := range subscribers {
+		assert.Empty(t, receiveChanges(t, subscriber), cellId)
+	}
+
+	assert.Equal(t, http.StatusNoContent, Delete(router, "/devchallenge-xx/var4").Code)
+	assert.Equal(t, []model.CellChange{{
+		CellId: "var4",
+		Old:    &model.Result{Value: "=var2 + var3", Result: "3"},
+	}}, receiveChanges(t, subscribers["var4"]))
+}
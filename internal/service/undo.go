@@ -0,0 +1,66 @@
+package service
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"devchallenge.it/spreadsheet/internal/model"
+	"github.com/gorilla/mux"
+)
+
+// undo reverts the latest edit of the spreadsheet, the reverted edit could be
+// redone until the next change.
+func (s *Service) undo(w http.ResponseWriter, r *http.Request) {
+	s.applyEdit(w, r, model.UndoStack)
+}
+
+func (s *Service) redo(w http.ResponseWriter, r *http.Request) {
+	s.applyEdit(w, r, model.RedoStack)
+}
+
+// applyEdit restores the cells of the top edit of the stack, they are
+// validated like upserted ones. Response contains the restored cells and the
+// deleted ones breaking their dependants.
+func (s *Service) applyEdit(w http.ResponseWriter, r *http.Request, stack model.EditStack) {
+	vars := mux.Vars(r)
+	sheetId := vars["sheet_id"]
+
+	var edit model.Edit
+	results, stored, err := s.writeCells(sheetId, requestOrigin(w, r), func(batch *model.Batch) (cells []model.EditCell, err error) {
+		edit, err = s.dao.GetEdit(sheetId, stack)
+		if err != nil {
+			return nil, err
+		}
+
+		batch.ApplyEdit(stack)
+		return edit.Cells, nil
+	})
+	if err != nil {
+		switch err {
+		case model.ERROR_NO_EDIT:
+			w.WriteHeader(http.StatusNotFound)
+		case model.ERROR_UPDATE_CONFLICT:
+			log.Print(err)
+			w.WriteHeader(http.StatusConflict)
+		default:
+			log.Print(err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	resp := make(SpreadsheetResponse, len(results))
+	for cellId, cell := range results {
+		resp[cellId] = NewCellResponse(cell)
+	}
+
+	responseStatus := http.StatusUnprocessableEntity
+	if stored {
+		responseStatus = http.StatusOK
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(responseStatus)
+	json.NewEncoder(w).Encode(&resp)
+}
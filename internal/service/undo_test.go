@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"devchallenge.it/spreadsheet/internal/model"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func Post(router *mux.Router, path string) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest(http.MethodPost, path, nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+
+	return response
+}
+
+func TestUndoRedo(t *testing.T) {
+	router, dao := NewMiniredisTestContext(t)
+
+	assert.Equal(t, http.StatusNotFound, Post(router, "/devchallenge-xx/undo").Code)
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "1").Code)
+	assert.Equal(t, http.StatusCreated, PostCells(router, "devchallenge-xx", map[string]string{
+		"var1": "2",
+		"var2": "=var1 * 10",
+	}).Code)
+
+	response := Post(router, "/DevChallenge-XX/undo")
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	var resp SpreadsheetResponse
+	json.NewDecoder(response.Body).Decode(&resp)
+	assert.Equal(t, SpreadsheetResponse{"var1": {Value: "1", Result: "1"}}, resp)
+
+	cells, err := dao.GetAllCells("devchallenge-xx")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"var1": "1"}, cells)
+
+	deps, err := dao.GetDependants("devchallenge-xx", "var1")
+	assert.NoError(t, err)
+	assert.Empty(t, deps)
+
+	response = Post(router, "/devchallenge-xx/redo")
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	json.NewDecoder(response.Body).Decode(&resp)
+	assert.Equal(t, "20", resp["var2"].Result)
+
+	deps, err = dao.GetDependants("devchallenge-xx", "var1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"var2"}, deps)
+
+	assert.Equal(t, http.StatusNotFound, Post(router, "/devchallenge-xx/redo").Code)
+
+	assert.Equal(t, http.StatusOK, Post(router, "/devchallenge-xx/undo").Code)
+	assert.Equal(t, http.StatusOK, Post(router, "/devchallenge-xx/undo").Code)
+	assert.Equal(t, http.StatusNotFound, Post(router, "/devchallenge-xx/undo").Code)
+
+	exists, err := dao.IsSpreadsheetExists("devchallenge-xx")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	// A new change drops the undone edits
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var3", "3").Code)
+	assert.Equal(t, http.StatusNotFound, Post(router, "/devchallenge-xx/redo").Code)
+}
+
+func TestRedoBreakDependant(t *testing.T) {
+	router, dao := NewMiniredisTestContext(t)
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "1").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var2", "=var1 + 1").Code)
+	assert.Equal(t, http.StatusNoContent, Delete(router, "/devchallenge-xx/var1?cascade=true").Code)
+
+	assert.Equal(t, http.StatusOK, Post(router, "/devchallenge-xx/undo").Code)
+
+	// Redo of the cascade delete is validated like the ordinary delete
+	response := Post(router, "/devchallenge-xx/redo")
+	assert.Equal(t, http.StatusUnprocessableEntity, response.Code)
+
+	var resp SpreadsheetResponse
+	json.NewDecoder(response.Body).Decode(&resp)
+	if assert.Contains(t, resp, "var1") {
+		assert.Equal(t, "1", resp["var1"].Value)
+		assert.NotNil(t, resp["var1"].Error)
+	}
+
+	value, err := dao.GetCell("devchallenge-xx", "var1")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", value)
+
+	_, err = dao.GetEdit("devchallenge-xx", model.RedoStack)
+	assert.NoError(t, err)
+}
+
+func TestUndoNotifies(t *testing.T) {
+	router, dao := NewMiniredisTestContext(t)
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "1").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var2", "=var1 + 1").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "2").Code)
+
+	subId, err := dao.CreateSubscription("devchallenge-xx", "var2")
+	assert.NoError(t, err)
+	subscriber, err := dao.Subscribe(subId)
+	assert.NoError(t, err)
+	defer subscriber.Close()
+
+	assert.Equal(t, http.StatusOK, Post(router, "/devchallenge-xx/undo").Code)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = subscriber.ReceiveMessage(ctx)
+	assert.NoError(t, err)
+}
@@ -4,10 +4,11 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"sort"
 	"strings"
 
 	"devchallenge.it/spreadsheet/internal/formula"
-	"devchallenge.it/spreadsheet/internal/formula/parser"
+	"devchallenge.it/spreadsheet/internal/model"
 	"github.com/gorilla/mux"
 )
 
@@ -26,6 +27,12 @@ func (s *Service) upsert(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if IsReservedCellId(cellId) {
+		log.Printf("Cell ID %q is reserved", cellId)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
 	contentType := r.Header.Get("Content-Type")
 	if strings.Compare(contentType, "application/json") != 0 {
 		log.Printf("Upsert invalid content type %s", contentType)
@@ -41,11 +48,13 @@ func (s *Service) upsert(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	solver := formula.NewSolver(s.dao, sheetId)
-	solver.SetCell(cellId, payload.Value)
-	result, value, formulaError, err := solver.Solve(cellId)
+	result, value, formulaError, err := s.storeCell(sheetId, requestOrigin(w, r), cellId, payload.Value)
 	if err != nil {
 		log.Print(err)
+		if err == model.ERROR_UPDATE_CONFLICT {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -54,30 +63,6 @@ func (s *Service) upsert(w http.ResponseWriter, r *http.Request) {
 	var errorMsg *string
 
 	if formulaError == nil {
-		formulaError, err = s.checkDependentFormula(sheetId, cellId, solver)
-		if err != nil {
-			log.Print(err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		if formulaError != nil {
-			result = "ERROR"
-		}
-	}
-
-	if formulaError == nil {
-		if err := s.dao.SetCell(sheetId, cellId, payload.Value); err != nil {
-			log.Print(err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-
-		if err := s.dao.AddDependatFormula(sheetId, cellId, parser.FindAllIdentifiers(payload.Value)); err != nil {
-			log.Print(err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-
 		responseStatus = http.StatusCreated
 	} else {
 		responseStatus = http.StatusUnprocessableEntity
@@ -85,10 +70,6 @@ func (s *Service) upsert(w http.ResponseWriter, r *http.Request) {
 		*errorMsg = formulaError.Error()
 	}
 
-	if errorMsg == nil {
-		s.notifyDependents(sheetId, cellId)
-	}
-
 	resp := CellResponse{
 		Value:  value,
 		Result: result,
@@ -100,36 +81,275 @@ func (s *Service) upsert(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(&resp)
 }
 
-func (s *Service) checkDependentFormula(spreadsheet, cellId string, solver *formula.Solver) (formulaError error, err error) {
-	deps, err := s.dao.GetDependants(spreadsheet, cellId)
+// CellResult is the outcome of a cell validation.
+type CellResult struct {
+	Result       string
+	Value        string
+	FormulaError error
+}
+
+// storeCell validates the new cell value and the cells depending on it, then
+// stores the value with the dependency index.
+func (s *Service) storeCell(sheetId string, origin model.Origin, cellId, newValue string) (result string, value string, formulaError error, err error) {
+	results, _, err := s.storeCells(sheetId, origin, map[string]string{cellId: newValue})
 	if err != nil {
 		return
 	}
 
-	for _, depCellId := range deps {
-		_, _, formulaError, _ = solver.Solve(depCellId)
-		if formulaError != nil {
-			return
+	cell := results[strings.ToLower(cellId)]
+	return cell.Result, cell.Value, cell.FormulaError, nil
+}
+
+// storeCells validates the new values together with the cells depending on
+// them using a single solver, so the new cells may refer to each other. The
+// values are stored only if all of them are valid.
+func (s *Service) storeCells(sheetId string, origin model.Origin, values map[string]string) (results map[string]CellResult, stored bool, err error) {
+	cells := make([]model.EditCell, 0, len(values))
+	for cellId, value := range values {
+		cells = append(cells, model.EditCell{CellId: cellId, Value: value})
+	}
+
+	return s.writeCells(sheetId, origin, func(*model.Batch) ([]model.EditCell, error) {
+		return cells, nil
+	})
+}
+
+// writeCells validates and stores the cell changes given by load, deleted
+// cells must not break their dependants and are absent in the results unless
+// they do. Validation and write are done in a single Dao.Update so concurrent
+// upserts can not break the spreadsheet, load is called in it to read the
+// changes consistently. Subscribers of the stored cells and their dependants
+// are notified of the changed results.
+func (s *Service) writeCells(sheetId string, origin model.Origin, load func(batch *model.Batch) ([]model.EditCell, error)) (results map[string]CellResult, stored bool, err error) {
+	var notifications []model.CellChange
+	err = s.dao.Update(sheetId, func(batch *model.Batch) error {
+		cells, err := load(batch)
+		if err != nil {
+			return err
 		}
 
-		formulaError, err = s.checkDependentFormula(spreadsheet, depCellId, solver)
-		if formulaError != nil || err != nil {
-			return
+		cellIds := make([]string, 0, len(cells))
+		changes := make(map[string]model.EditCell, len(cells))
+		for _, cell := range cells {
+			cellId := strings.ToLower(cell.CellId)
+			cellIds = append(cellIds, cellId)
+			changes[cellId] = cell
+		}
+		sort.Strings(cellIds)
+
+		results = make(map[string]CellResult, len(cellIds))
+		stored = true
+
+		solver, err := s.newSolver(s.dao, sheetId)
+		if err != nil {
+			return err
+		}
+
+		for _, cellId := range cellIds {
+			if changes[cellId].Deleted {
+				solver.DeleteCell(cellId)
+			} else {
+				solver.SetCell(cellId, changes[cellId].Value)
+			}
+		}
+
+		// Transitive dependants of the changed cells are solved once with
+		// them, their results are materialized with the changed ones.
+		graph, affected, err := s.readDependants(sheetId, cellIds)
+		if err != nil {
+			return err
+		}
+
+		formulaErrors, err := solveDependants(solver, append(affected, cellIds...))
+		if err != nil {
+			return err
+		}
+
+		materialized, err := s.dao.GetResults(sheetId, append(cellIds, affected...))
+		if err != nil {
+			return err
+		}
+
+		for _, cellId := range cellIds {
+			if changes[cellId].Deleted {
+				if formulaError := brokenDependant(graph, cellId, formulaErrors, materialized); formulaError != nil {
+					value, err := s.dao.GetCell(sheetId, cellId)
+					if err != nil && err != model.ERROR_NO_CELL {
+						return err
+					}
+
+					results[cellId] = CellResult{Result: formula.ERROR, Value: value, FormulaError: formulaError}
+					stored = false
+				}
+				continue
+			}
+
+			result, value, formulaError, err := solver.Solve(cellId)
+			if err != nil {
+				return err
+			}
+
+			if formulaError == nil {
+				if formulaError = brokenDependant(graph, cellId, formulaErrors, materialized); formulaError != nil {
+					result = formula.ERROR
+				}
+			}
+
+			results[cellId] = CellResult{Result: result, Value: value, FormulaError: formulaError}
+			if formulaError != nil {
+				stored = false
+			}
 		}
+
+		if !stored {
+			return nil
+		}
+
+		batch.SetOrigin(origin)
+		for _, cellId := range cellIds {
+			oldValue, err := s.dao.GetCell(sheetId, cellId)
+			if err != nil && err != model.ERROR_NO_CELL {
+				return err
+			}
+
+			newValue := changes[cellId].Value
+			if changes[cellId].Deleted {
+				newValue = ""
+				batch.DeleteCell(cellId)
+			} else {
+				batch.SetCell(cellId, newValue)
+			}
+			updateDependencies(batch, cellId, oldValue, newValue)
+		}
+
+		if notifications, err = changedResults(solver, materialized, cellIds, affected); err != nil {
+			return err
+		}
+		batch.PublishCellChanges(notifications)
+
+		return materializeResults(batch, solver, materialized, append(cellIds, affected...))
+	})
+
+	if err == nil && stored {
+		s.enqueueWebhooks(sheetId, notifications)
 	}
 
 	return
 }
 
-func (s *Service) notifyDependents(spreadsheet, cellId string) {
-	deps, err := s.dao.GetDependants(spreadsheet, cellId)
+// updateDependencies replaces the edges of the old cell value in the
+// dependency index with the edges of the new one.
+func updateDependencies(batch *model.Batch, cellId, oldValue, newValue string) {
+	oldDependencies := formula.Dependencies(oldValue)
+	newDependencies := formula.Dependencies(newValue)
+
+	if removed := subtract(oldDependencies, newDependencies); len(removed) > 0 {
+		batch.DeleteDependatFormula(cellId, removed)
+	}
+
+	if added := subtract(newDependencies, oldDependencies); len(added) > 0 {
+		batch.AddDependatFormula(cellId, added)
+	}
+}
+
+// subtract returns elements of a missing in b.
+func subtract(a, b []string) []string {
+	exclude := make(map[string]struct{}, len(b))
+	for _, v := range b {
+		exclude[v] = struct{}{}
+	}
+
+	var result []string
+	for _, v := range a {
+		if _, exists := exclude[v]; !exists {
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
+
+// readDependants reads the dependants graph of the cells at once and returns
+// it with the transitive dependants of the cells, excluding the cells, sorted
+// by id.
+func (s *Service) readDependants(spreadsheet string, cellIds []string) (graph map[string][]string, dependants []string, err error) {
+	graph, err = s.dao.GetDependantsGraph(spreadsheet, cellIds)
 	if err != nil {
 		return
 	}
 
-	s.dao.NotifyCellChange(spreadsheet, cellId)
+	visited := make(map[string]struct{}, len(cellIds))
+	for _, cellId := range cellIds {
+		visited[strings.ToLower(cellId)] = struct{}{}
+	}
+
+	for _, deps := range graph {
+		for _, depCellId := range deps {
+			if _, exists := visited[depCellId]; !exists {
+				visited[depCellId] = struct{}{}
+				dependants = append(dependants, depCellId)
+			}
+		}
+	}
+	sort.Strings(dependants)
+
+	return
+}
+
+// solveDependants reads the cells at once and solves them in the topological
+// order, so every formula is evaluated once with its references already
+// solved, and returns the formula errors of the existing ones.
+func solveDependants(solver *formula.Solver, cellIds []string) (map[string]error, error) {
+	if err := solver.LoadKeys(cellIds); err != nil {
+		return nil, err
+	}
+
+	order, err := solver.Order(cellIds)
+	if err != nil {
+		return nil, err
+	}
+
+	formulaErrors := make(map[string]error, len(order))
+	for _, cellId := range order {
+		_, value, formulaError, err := solver.Solve(cellId)
+		if err != nil {
+			return nil, err
+		}
+		if formula.IsMissingCell(value, formulaError) {
+			continue
+		}
+		formulaErrors[cellId] = formulaError
+	}
+
+	return formulaErrors, nil
+}
+
+// brokenDependant returns the formula error of a transitive dependant of the
+// cell broken by the change. Dependants deleted by the same change are skipped
+// with their own dependants. Dependants materialized with an error were broken
+// before the change, e.g. by a cascade delete, and do not reject it.
+func brokenDependant(graph map[string][]string, cellId string, formulaErrors map[string]error, materialized map[string]model.Result) error {
+	cellId = strings.ToLower(cellId)
+	visited := map[string]struct{}{cellId: {}}
+	queue := []string{cellId}
 
-	for _, depCellId := range deps {
-		s.notifyDependents(spreadsheet, depCellId)
+	for i := 0; i < len(queue); i++ {
+		for _, depCellId := range graph[queue[i]] {
+			if _, exists := visited[depCellId]; exists {
+				continue
+			}
+			visited[depCellId] = struct{}{}
+
+			formulaError, solved := formulaErrors[depCellId]
+			if !solved {
+				continue
+			}
+			if formulaError != nil && materialized[depCellId].Error == "" {
+				return formulaError
+			}
+			queue = append(queue, depCellId)
+		}
 	}
+
+	return nil
 }
@@ -3,20 +3,39 @@ package service
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"reflect"
+	"regexp"
+	"sync"
 	"testing"
 
+	"devchallenge.it/spreadsheet/internal/formula"
 	"devchallenge.it/spreadsheet/internal/model"
+	"github.com/alicebob/miniredis/v2"
 	"github.com/go-redis/redismock/v9"
 	"github.com/gorilla/mux"
+	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
 )
 
+// TestMain runs the tests with every formula evaluator.
+func TestMain(m *testing.M) {
+	for _, e := range []formula.Evaluator{formula.TreeEvaluator, formula.BytecodeEvaluator} {
+		fmt.Printf("Evaluator %s\n", e)
+		formula.SetEvaluator(e)
+		if code := m.Run(); code != 0 {
+			os.Exit(code)
+		}
+	}
+}
+
 type TestContext struct {
 	service *Service
 	router  *mux.Router
-	dao     *model.Dao
+	dao     *model.RedisDao
 	mock    redismock.ClientMock
 }
 
@@ -24,7 +43,7 @@ func NewTestContext() *TestContext {
 	r := mux.NewRouter()
 
 	rdb, mock := redismock.NewClientMock()
-	dao := model.NewDao(rdb)
+	dao := model.NewRedisDao(rdb)
 
 	s := NewService(r, dao)
 
@@ -36,6 +55,162 @@ func NewTestContext() *TestContext {
 	}
 }
 
+// NewMiniredisTestContext runs the service against in-memory Redis server,
+// used where the tests rely on real Redis semantics, e.g. transactions.
+func NewMiniredisTestContext(t testing.TB) (*mux.Router, *model.RedisDao) {
+	server := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	dao := model.NewRedisDao(rdb)
+	r := mux.NewRouter()
+	NewService(r, dao)
+
+	return r, dao
+}
+
+// Redis keys of the devchallenge-xx spreadsheet.
+const (
+	testCellsKey           = "spreadsheet:sheet:{devchallenge-xx}:cells"
+	testDependantsIndexKey = "spreadsheet:sheet:{devchallenge-xx}:dependants"
+	testInfoKey            = "spreadsheet:sheet:{devchallenge-xx}:info"
+	testResultsKey         = "spreadsheet:sheet:{devchallenge-xx}:results"
+	testHistoryKey         = "spreadsheet:sheet:{devchallenge-xx}:history"
+	testUndoKey            = "spreadsheet:sheet:{devchallenge-xx}:undo"
+	testRedoKey            = "spreadsheet:sheet:{devchallenge-xx}:redo"
+	testEventIdKey         = "spreadsheet:sheet:{devchallenge-xx}:event-id"
+	testEventsIndexKey     = "spreadsheet:sheet:{devchallenge-xx}:events"
+	testWebhooksKey        = "spreadsheet:sheet:{devchallenge-xx}:webhooks"
+)
+
+func testDependantsKey(cellId string) string {
+	return testDependantsIndexKey + ":" + cellId
+}
+
+// expectRegister expects the spreadsheet registration preceding every update
+// transaction.
+func expectRegister(mock redismock.ClientMock) {
+	mock.ExpectZAdd("spreadsheet:registry", redis.Z{Member: "devchallenge-xx"}).SetVal(0)
+}
+
+// expectHistory expects the history entry of the cell value, the timestamp
+// and the request id of the entry are not known beforehand.
+func expectHistory(mock redismock.ClientMock, cellId, value string) {
+	matchEntry := func(data interface{}) error {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(fmt.Sprint(data)), &entry); err != nil {
+			return err
+		}
+		if entry["cellId"] != cellId || entry["value"] != value {
+			return fmt.Errorf("unexpected history entry %s", data)
+		}
+		return nil
+	}
+
+	mock.CustomMatch(func(expected, actual []interface{}) error {
+		if actual[1] != testHistoryKey+":"+cellId {
+			return fmt.Errorf("unexpected history key %v", actual[1])
+		}
+		return matchEntry(actual[2])
+	}).ExpectRPush(testHistoryKey+":"+cellId, "").SetVal(1)
+	mock.CustomMatch(func(expected, actual []interface{}) error {
+		if actual[1] != testHistoryKey {
+			return fmt.Errorf("unexpected history key %v", actual[1])
+		}
+		return matchEntry(actual[3])
+	}).ExpectZAdd(testHistoryKey, redis.Z{}).SetVal(1)
+}
+
+// expectEdit expects the edit reverting an ordinary change pushed to the undo
+// stack, cells is the JSON of the restored cells.
+func expectEdit(mock redismock.ClientMock, cells string) {
+	mock.ExpectDel(testRedoKey).SetVal(0)
+	mock.Regexp().ExpectLPush(regexp.QuoteMeta(testUndoKey), `"cells":`+regexp.QuoteMeta(cells)).SetVal(1)
+	mock.ExpectLTrim(testUndoKey, 0, 99).SetVal("OK")
+}
+
+// expectDependantsGraph expects the dependants graph of the cells read by the
+// script, graph lists the cells followed by their dependants.
+func expectDependantsGraph(mock redismock.ClientMock, cellIds []string, graph ...[]string) {
+	args := []interface{}{testDependantsIndexKey + ":"}
+	for _, cellId := range cellIds {
+		args = append(args, cellId)
+	}
+
+	val := make([]interface{}, len(graph))
+	for i, entry := range graph {
+		ids := make([]interface{}, len(entry))
+		for j, id := range entry {
+			ids[j] = id
+		}
+		val[i] = ids
+	}
+
+	// The script digest is not compared
+	mock.CustomMatch(func(expected, actual []interface{}) error {
+		if actual[0] != "evalsha" || !reflect.DeepEqual(expected[2:], actual[2:]) {
+			return fmt.Errorf("unexpected script call %v", actual)
+		}
+		return nil
+	}).ExpectEvalSha("", []string{testDependantsIndexKey}, args...).SetVal(val)
+}
+
+// expectPublish expects the change of the cell logged and published as the
+// first event within the update transaction, change is its JSON without the
+// event id.
+func expectPublish(mock redismock.ClientMock, cellId, change string) {
+	eventsKey := testEventsIndexKey + ":" + cellId
+	channel := "spreadsheet:pubsub:{devchallenge-xx}:" + cellId
+
+	// The script source is not compared
+	mock.CustomMatch(func(expected, actual []interface{}) error {
+		if actual[0] != "eval" || !reflect.DeepEqual(expected[2:], actual[2:]) {
+			return fmt.Errorf("unexpected script call %v", actual)
+		}
+		return nil
+	}).ExpectEval("", []string{testEventIdKey, testEventsIndexKey, eventsKey}, model.MaxCellEvents, cellId, channel, change).SetVal(int64(1))
+}
+
+// expectNoWebhooks expects the webhooks of the changed cells read after the
+// update, there are none.
+func expectNoWebhooks(mock redismock.ClientMock) {
+	mock.ExpectSMembers(testWebhooksKey).SetVal([]string{})
+}
+
+// expectIterativeCalculation expects the spreadsheet setting read before the
+// cells are evaluated, it is not set.
+func expectIterativeCalculation(mock redismock.ClientMock) {
+	mock.ExpectHGet(testInfoKey, "iteration").RedisNil()
+}
+
+// expectResult expects the materialized result of the cell, result is its
+// JSON.
+func expectResult(mock redismock.ClientMock, cellId, result string) {
+	mock.ExpectHSet(testResultsKey, cellId, result).SetVal(1)
+}
+
+// expectInfoUpdate expects the spreadsheet registry entry writes which close
+// every update transaction.
+func expectInfoUpdate(mock redismock.ClientMock) {
+	mock.Regexp().ExpectHSetNX(regexp.QuoteMeta(testInfoKey), "createdAt", ".+").SetVal(false)
+	mock.ExpectHSetNX(testInfoKey, "owner", "").SetVal(false)
+	mock.Regexp().ExpectHSet(regexp.QuoteMeta(testInfoKey), "updatedAt", ".+").SetVal(0)
+}
+
+func PostCell(router *mux.Router, sheetId, cellId, value string) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest(
+		http.MethodPost,
+		"/"+sheetId+"/"+cellId,
+		CreateUpsertPayload(value),
+	)
+	request.Header.Add("Content-Type", "application/json")
+	response := httptest.NewRecorder()
+
+	router.ServeHTTP(response, request)
+
+	return response
+}
+
 func CreateUpsertPayload(value string) *bytes.Reader {
 	jsonBody, _ := json.Marshal(UpsertPayload{value})
 	return bytes.NewReader(jsonBody)
@@ -44,14 +219,28 @@ func CreateUpsertPayload(value string) *bytes.Reader {
 func TestUpsertSimpleVarSuccess(t *testing.T) {
 	tctx := NewTestContext()
 
-	tctx.mock.ExpectSMembers("devchallenge-xx/var1").SetVal([]string{})
+	tctx.mock.ExpectWatch(testCellsKey, testInfoKey)
+	expectIterativeCalculation(tctx.mock)
+	expectDependantsGraph(tctx.mock, []string{"var1"})
+	tctx.mock.ExpectHMGet(testResultsKey, "var1").SetVal([]interface{}{nil})
+	tctx.mock.ExpectHGet(testCellsKey, "var1").RedisNil()
+	tctx.mock.ExpectHMGet(testCellsKey, "var1").SetVal([]interface{}{nil})
+	expectRegister(tctx.mock)
+	tctx.mock.ExpectTxPipeline()
 	tctx.mock.
 		ExpectHSet(
-			"devchallenge-xx",
+			testCellsKey,
 			map[string]string{
 				"var1": "0",
 			},
 		).SetVal(1)
+	expectResult(tctx.mock, "var1", `{"value":"0","result":"0"}`)
+	expectHistory(tctx.mock, "var1", "0")
+	expectInfoUpdate(tctx.mock)
+	expectEdit(tctx.mock, `[{"cellId":"var1","deleted":true}]`)
+	expectPublish(tctx.mock, "var1", `{"cellId":"var1","new":{"value":"0","result":"0"}}`)
+	tctx.mock.ExpectTxPipelineExec()
+	expectNoWebhooks(tctx.mock)
 
 	request, _ := http.NewRequest(
 		http.MethodPost,
@@ -97,14 +286,28 @@ func TestUpsertInvalidCellIdFail(t *testing.T) {
 func TestUpsertCaseInsensitiveSuccess(t *testing.T) {
 	tctx := NewTestContext()
 
-	tctx.mock.ExpectSMembers("devchallenge-xx/var2").SetVal([]string{})
+	tctx.mock.ExpectWatch(testCellsKey, testInfoKey)
+	expectIterativeCalculation(tctx.mock)
+	expectDependantsGraph(tctx.mock, []string{"var2"})
+	tctx.mock.ExpectHMGet(testResultsKey, "var2").SetVal([]interface{}{nil})
+	tctx.mock.ExpectHGet(testCellsKey, "var2").RedisNil()
+	tctx.mock.ExpectHMGet(testCellsKey, "var2").SetVal([]interface{}{nil})
+	expectRegister(tctx.mock)
+	tctx.mock.ExpectTxPipeline()
 	tctx.mock.
 		ExpectHSet(
-			"devchallenge-xx",
+			testCellsKey,
 			map[string]string{
 				"var2": "1",
 			},
 		).SetVal(1)
+	expectResult(tctx.mock, "var2", `{"value":"1","result":"1"}`)
+	expectHistory(tctx.mock, "var2", "1")
+	expectInfoUpdate(tctx.mock)
+	expectEdit(tctx.mock, `[{"cellId":"var2","deleted":true}]`)
+	expectPublish(tctx.mock, "var2", `{"cellId":"var2","new":{"value":"1","result":"1"}}`)
+	tctx.mock.ExpectTxPipelineExec()
+	expectNoWebhooks(tctx.mock)
 
 	request, _ := http.NewRequest(
 		http.MethodPost,
@@ -129,19 +332,35 @@ func TestUpsertCaseInsensitiveSuccess(t *testing.T) {
 func TestUpsertFormulaSuccess(t *testing.T) {
 	tctx := NewTestContext()
 
-	tctx.mock.ExpectHGet("devchallenge-xx", "var1").SetVal("1")
-	tctx.mock.ExpectHGet("devchallenge-xx", "var2").SetVal("2")
-	tctx.mock.ExpectSMembers("devchallenge-xx/var3").SetVal([]string{})
-
+	tctx.mock.ExpectWatch(testCellsKey, testInfoKey)
+	expectIterativeCalculation(tctx.mock)
+	expectDependantsGraph(tctx.mock, []string{"var3"})
+	tctx.mock.ExpectHGet(testCellsKey, "var1").SetVal("1")
+	tctx.mock.ExpectHGet(testCellsKey, "var2").SetVal("2")
+	tctx.mock.ExpectHMGet(testResultsKey, "var3").SetVal([]interface{}{nil})
+	tctx.mock.ExpectHGet(testCellsKey, "var3").RedisNil()
+
+	tctx.mock.ExpectHMGet(testCellsKey, "var3").SetVal([]interface{}{nil})
+	expectRegister(tctx.mock)
+	tctx.mock.ExpectTxPipeline()
 	tctx.mock.
 		ExpectHSet(
-			"devchallenge-xx",
+			testCellsKey,
 			map[string]string{
 				"var3": "=var1+var2",
 			},
 		).SetVal(1)
-	tctx.mock.ExpectSAdd("devchallenge-xx/var1", []string{"var3"}).SetVal(1)
-	tctx.mock.ExpectSAdd("devchallenge-xx/var2", []string{"var3"}).SetVal(1)
+	tctx.mock.ExpectSAdd(testDependantsKey("var1"), []string{"var3"}).SetVal(1)
+	tctx.mock.ExpectSAdd(testDependantsIndexKey, "var1").SetVal(1)
+	tctx.mock.ExpectSAdd(testDependantsKey("var2"), []string{"var3"}).SetVal(1)
+	tctx.mock.ExpectSAdd(testDependantsIndexKey, "var2").SetVal(1)
+	expectResult(tctx.mock, "var3", `{"value":"=var1+var2","result":"3"}`)
+	expectHistory(tctx.mock, "var3", "=var1+var2")
+	expectInfoUpdate(tctx.mock)
+	expectEdit(tctx.mock, `[{"cellId":"var3","deleted":true}]`)
+	expectPublish(tctx.mock, "var3", `{"cellId":"var3","new":{"value":"=var1+var2","result":"3"}}`)
+	tctx.mock.ExpectTxPipelineExec()
+	expectNoWebhooks(tctx.mock)
 
 	request, _ := http.NewRequest(
 		http.MethodPost,
@@ -163,10 +382,57 @@ func TestUpsertFormulaSuccess(t *testing.T) {
 	assert.NoError(t, tctx.mock.ExpectationsWereMet())
 }
 
+func TestUpsertReplaceFormulaDependencies(t *testing.T) {
+	tctx := NewTestContext()
+
+	tctx.mock.ExpectWatch(testCellsKey, testInfoKey)
+	expectIterativeCalculation(tctx.mock)
+	expectDependantsGraph(tctx.mock, []string{"var3"})
+	tctx.mock.ExpectHGet(testCellsKey, "var2").SetVal("2")
+	tctx.mock.ExpectHGet(testCellsKey, "var4").SetVal("4")
+	tctx.mock.ExpectHMGet(testResultsKey, "var3").SetVal([]interface{}{`{"value":"=var1+var2","result":"3"}`})
+	tctx.mock.ExpectHGet(testCellsKey, "var3").SetVal("=var1+var2")
+
+	tctx.mock.ExpectHMGet(testCellsKey, "var3").SetVal([]interface{}{"=var1+var2"})
+	expectRegister(tctx.mock)
+	tctx.mock.ExpectTxPipeline()
+	tctx.mock.
+		ExpectHSet(
+			testCellsKey,
+			map[string]string{
+				"var3": "=var2+var4",
+			},
+		).SetVal(1)
+	tctx.mock.ExpectSRem(testDependantsKey("var1"), "var3").SetVal(1)
+	tctx.mock.ExpectSAdd(testDependantsKey("var4"), "var3").SetVal(1)
+	tctx.mock.ExpectSAdd(testDependantsIndexKey, "var4").SetVal(1)
+	expectResult(tctx.mock, "var3", `{"value":"=var2+var4","result":"6"}`)
+	expectHistory(tctx.mock, "var3", "=var2+var4")
+	expectInfoUpdate(tctx.mock)
+	expectEdit(tctx.mock, `[{"cellId":"var3","value":"=var1+var2"}]`)
+	expectPublish(tctx.mock, "var3", `{"cellId":"var3","old":{"value":"=var1+var2","result":"3"},"new":{"value":"=var2+var4","result":"6"}}`)
+	tctx.mock.ExpectTxPipelineExec()
+	expectNoWebhooks(tctx.mock)
+
+	response := PostCell(tctx.router, "devchallenge-xx", "var3", "=var2+var4")
+
+	var resp CellResponse
+	json.NewDecoder(response.Body).Decode(&resp)
+
+	assert.Equal(t, 201, response.Code)
+	assert.Equal(t, "6", resp.Result)
+
+	assert.NoError(t, tctx.mock.ExpectationsWereMet())
+}
+
 func TestPostFormulaError(t *testing.T) {
 	tctx := NewTestContext()
 
-	tctx.mock.ExpectHGet("devchallenge-xx", "var2").SetVal("2")
+	tctx.mock.ExpectWatch(testCellsKey, testInfoKey)
+	expectIterativeCalculation(tctx.mock)
+	expectDependantsGraph(tctx.mock, []string{"var1"})
+	tctx.mock.ExpectHGet(testCellsKey, "var2").SetVal("2")
+	tctx.mock.ExpectHMGet(testResultsKey, "var1").SetVal([]interface{}{nil})
 
 	request, _ := http.NewRequest(
 		http.MethodPost,
@@ -191,10 +457,11 @@ func TestPostFormulaError(t *testing.T) {
 func TestPostDependentFormulaError(t *testing.T) {
 	tctx := NewTestContext()
 
-	tctx.mock.ExpectSMembers("devchallenge-xx/var1").SetVal([]string{"var2"})
-	tctx.mock.ExpectHGet("devchallenge-xx", "var2").SetVal("=var1 - 1")
-	tctx.mock.ExpectSMembers("devchallenge-xx/var2").SetVal([]string{"var3"})
-	tctx.mock.ExpectHGet("devchallenge-xx", "var3").SetVal("=1/var2")
+	tctx.mock.ExpectWatch(testCellsKey, testInfoKey)
+	expectIterativeCalculation(tctx.mock)
+	expectDependantsGraph(tctx.mock, []string{"var1"}, []string{"var1", "var2"}, []string{"var2", "var3"})
+	tctx.mock.ExpectHMGet(testCellsKey, "var2", "var3").SetVal([]interface{}{"=var1 - 1", "=1/var2"})
+	tctx.mock.ExpectHMGet(testResultsKey, "var1", "var2", "var3").SetVal([]interface{}{nil, nil, nil})
 
 	request, _ := http.NewRequest(
 		http.MethodPost,
@@ -215,3 +482,137 @@ func TestPostDependentFormulaError(t *testing.T) {
 
 	assert.NoError(t, tctx.mock.ExpectationsWereMet())
 }
+
+func postConcurrently(router *mux.Router, sheetId string, cells map[string]string) map[string]int {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	codes := make(map[string]int)
+
+	for cellId, value := range cells {
+		wg.Add(1)
+		go func(cellId, value string) {
+			defer wg.Done()
+			code := PostCell(router, sheetId, cellId, value).Code
+
+			mu.Lock()
+			codes[cellId] = code
+			mu.Unlock()
+		}(cellId, value)
+	}
+	wg.Wait()
+
+	return codes
+}
+
+func assertSpreadsheetValid(t *testing.T, dao model.Dao, sheetId string) {
+	keys, err := dao.GetSpreadeetKeys(sheetId)
+	assert.NoError(t, err)
+
+	solver := formula.NewSolver(dao, sheetId)
+	for _, cellId := range keys {
+		_, _, formulaError, err := solver.Solve(cellId)
+		assert.NoError(t, err)
+		assert.NoError(t, formulaError, cellId)
+	}
+}
+
+func TestUpsertConcurrentCycle(t *testing.T) {
+	router, dao := NewMiniredisTestContext(t)
+
+	for i := 0; i < 50; i++ {
+		assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "1").Code)
+		assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var2", "1").Code)
+
+		codes := postConcurrently(router, "devchallenge-xx", map[string]string{
+			"var1": "=var2+1",
+			"var2": "=var1+1",
+		})
+
+		assert.ElementsMatch(t,
+			[]int{http.StatusCreated, http.StatusUnprocessableEntity},
+			[]int{codes["var1"], codes["var2"]})
+		assertSpreadsheetValid(t, dao, "devchallenge-xx")
+	}
+}
+
+func TestUpsertConcurrentBreakDependant(t *testing.T) {
+	router, dao := NewMiniredisTestContext(t)
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "1").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var2", "=var1").Code)
+
+	for i := 0; i < 50; i++ {
+		assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "1").Code)
+		assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var3", "0").Code)
+
+		codes := postConcurrently(router, "devchallenge-xx", map[string]string{
+			"var1": "0",
+			"var3": "=1/var2",
+		})
+
+		assert.ElementsMatch(t,
+			[]int{http.StatusCreated, http.StatusUnprocessableEntity},
+			[]int{codes["var1"], codes["var3"]})
+		assertSpreadsheetValid(t, dao, "devchallenge-xx")
+	}
+}
+
+// storeDiamonds stores a chain of diamonds with the given number of cells:
+// every diamond top var{3k} is referred by var{3k+1} and var{3k+2}, the
+// bottom var{3k+3} refers to both of them and is the top of the next diamond.
+func storeDiamonds(t testing.TB, dao model.Dao, sheetId string, size int) {
+	err := dao.Update(sheetId, func(batch *model.Batch) error {
+		batch.SetCell("var0", "1")
+		for i := 0; i+3 < size; i += 3 {
+			top, left, right, bottom := fmt.Sprintf("var%d", i), fmt.Sprintf("var%d", i+1), fmt.Sprintf("var%d", i+2), fmt.Sprintf("var%d", i+3)
+			batch.SetCell(left, "="+top+" + 1")
+			batch.SetCell(right, "="+top+" - 1")
+			batch.SetCell(bottom, "=("+left+" + "+right+") / 2")
+			batch.AddDependatFormula(left, []string{top})
+			batch.AddDependatFormula(right, []string{top})
+			batch.AddDependatFormula(bottom, []string{left, right})
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpsertDiamondDependants(t *testing.T) {
+	router, dao := NewMiniredisTestContext(t)
+	storeDiamonds(t, dao, "devchallenge-xx", 301)
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var0", "3").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var301", "=1 / (var300 - 2)").Code)
+
+	result, err := dao.GetResult("devchallenge-xx", "var300")
+	assert.NoError(t, err)
+	assert.Equal(t, "3", result.Result)
+
+	response := PostCell(router, "devchallenge-xx", "var0", "2")
+	assert.Equal(t, http.StatusUnprocessableEntity, response.Code)
+	assertSpreadsheetValid(t, dao, "devchallenge-xx")
+}
+
+// BenchmarkUpsertDiamondDependants updates the top of the diamond chain, all
+// the cells are checked and materialized, the notifications are not sent. The
+// cost per cell stays the same with the growing size.
+func BenchmarkUpsertDiamondDependants(b *testing.B) {
+	for _, size := range []int{1000, 10000} {
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			_, dao := NewMiniredisTestContext(b)
+			s := NewService(mux.NewRouter(), dao)
+			storeDiamonds(b, dao, "devchallenge-xx", size)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, _, formulaError, err := s.storeCell("devchallenge-xx", model.Origin{}, "var0", fmt.Sprint(i))
+				if err != nil || formulaError != nil {
+					b.Fatal(err, formulaError)
+				}
+			}
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*size), "ns/cell")
+		})
+	}
+}
@@ -0,0 +1,484 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"devchallenge.it/spreadsheet/internal/model"
+	"github.com/gorilla/mux"
+)
+
+// Headers of webhook requests. The signature is the hex HMAC-SHA256 of the
+// timestamp, a dot and the body keyed by the subscription secret.
+const (
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// Webhook delivery defaults, attempt n is retried after
+// DefaultWebhookBaseDelay * 2^(n-1) up to DefaultWebhookMaxDelay.
+const (
+	DefaultWebhookMaxAttempts = 8
+	DefaultWebhookBaseDelay   = time.Second
+	DefaultWebhookMaxDelay    = time.Minute
+)
+
+const (
+	webhookTimeout   = 10 * time.Second
+	webhookWorkers   = 4
+	webhookQueueSize = 1024
+)
+
+var ERROR_WEBHOOK_QUEUE_FULL = errors.New("Webhook delivery queue is full")
+var ERROR_WEBHOOK_ADDRESS = errors.New("Webhook address is not public")
+
+// sharedAddressSpace is the carrier-grade NAT range, it is not covered by
+// netip.Addr.IsPrivate.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// WebhookEvent is the body POSTed to a webhook, old is absent for a new cell
+// and new for a deleted one.
+type WebhookEvent struct {
+	SubscriptionId string        `json:"subscription_id"`
+	SheetId        string        `json:"sheet_id"`
+	CellId         string        `json:"cell_id"`
+	EventId        int64         `json:"event_id,omitempty"`
+	Old            *CellResponse `json:"old,omitempty"`
+	New            *CellResponse `json:"new,omitempty"`
+}
+
+type DeliveryResponse struct {
+	Id             int64           `json:"id"`
+	CellId         string          `json:"cell_id"`
+	EventId        int64           `json:"event_id,omitempty"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	ResponseStatus int             `json:"response_status,omitempty"`
+	Error          string          `json:"error,omitempty"`
+	Payload        json.RawMessage `json:"payload"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+}
+
+func NewDeliveryResponse(delivery model.Delivery) DeliveryResponse {
+	return DeliveryResponse{
+		Id:             delivery.Id,
+		CellId:         delivery.CellId,
+		EventId:        delivery.EventId,
+		Status:         delivery.Status,
+		Attempts:       delivery.Attempts,
+		ResponseStatus: delivery.ResponseStatus,
+		Error:          delivery.Error,
+		Payload:        delivery.Payload,
+		CreatedAt:      delivery.CreatedAt,
+		UpdatedAt:      delivery.UpdatedAt,
+		NextAttemptAt:  delivery.NextAttemptAt,
+	}
+}
+
+// webhookWorker delivers the queued webhook requests, failed ones are queued
+// again after the backoff delay. Pending deliveries are resumed on startup by
+// ResumeWebhooks.
+type webhookWorker struct {
+	client       *http.Client
+	maxAttempts  int
+	baseDelay    time.Duration
+	maxDelay     time.Duration
+	allowPrivate bool
+
+	queue     chan webhookJob
+	startOnce sync.Once
+}
+
+type webhookJob struct {
+	webhook  model.Webhook
+	delivery model.Delivery
+}
+
+func newWebhookWorker() *webhookWorker {
+	w := &webhookWorker{
+		maxAttempts: DefaultWebhookMaxAttempts,
+		baseDelay:   DefaultWebhookBaseDelay,
+		maxDelay:    DefaultWebhookMaxDelay,
+		queue:       make(chan webhookJob, webhookQueueSize),
+	}
+
+	// The address is checked when connecting, so a host resolving to a
+	// public address on subscribe can not be pointed to an internal one
+	// later. Requests are not proxied, the proxy would connect instead.
+	dialer := &net.Dialer{
+		Timeout: webhookTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			return w.checkAddress(addrPort.Addr())
+		},
+	}
+	w.client = &http.Client{
+		Timeout:   webhookTimeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+	}
+
+	return w
+}
+
+// AllowPrivateWebhooks lets webhooks be delivered to loopback, private and
+// link-local addresses, e.g. when the receivers run next to the service.
+func (s *Service) AllowPrivateWebhooks() {
+	s.webhooks.allowPrivate = true
+}
+
+// checkAddress rejects the loopback, private, link-local and other
+// non-public addresses unless they are allowed.
+func (w *webhookWorker) checkAddress(addr netip.Addr) error {
+	if w.allowPrivate {
+		return nil
+	}
+
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() || sharedAddressSpace.Contains(addr) {
+		return ERROR_WEBHOOK_ADDRESS
+	}
+
+	return nil
+}
+
+// checkCallbackHost resolves the callback url host and rejects it unless
+// all of its addresses are allowed.
+func (w *webhookWorker) checkCallbackHost(ctx context.Context, callbackUrl string) error {
+	u, err := url.Parse(callbackUrl)
+	if err != nil {
+		return err
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil {
+		return err
+	}
+
+	for _, addr := range addrs {
+		if err := w.checkAddress(addr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// backoff returns the delay after the attempt.
+func (w *webhookWorker) backoff(attempt int) time.Duration {
+	delay := w.baseDelay
+	for i := 1; i < attempt && delay < w.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > w.maxDelay {
+		delay = w.maxDelay
+	}
+
+	return delay
+}
+
+// isCallbackUrl accepts absolute http and https urls.
+func isCallbackUrl(callbackUrl string) bool {
+	u, err := url.Parse(callbackUrl)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// newWebhookSecret returns a random key signing the deliveries of a webhook.
+func newWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, secret); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(secret), nil
+}
+
+// SignWebhook returns the signature of the webhook body sent at the
+// timestamp.
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// enqueueWebhooks stores a pending delivery of every change for each webhook
+// of its cell and queues it.
+func (s *Service) enqueueWebhooks(sheetId string, changes []model.CellChange) {
+	if len(changes) == 0 {
+		return
+	}
+
+	cellIds := make([]string, len(changes))
+	for i, change := range changes {
+		cellIds[i] = change.CellId
+	}
+
+	webhooks, err := s.dao.GetWebhooks(sheetId, cellIds)
+	if err != nil {
+		log.Printf("Failed to get webhooks of %s: %v", sheetId, err)
+		return
+	}
+
+	for _, change := range changes {
+		for _, webhook := range webhooks {
+			if webhook.CellId != change.CellId {
+				continue
+			}
+
+			if err := s.enqueueWebhook(webhook, change); err != nil {
+				log.Printf("Failed to queue webhook %s: %v", webhook.SubscriptionId, err)
+			}
+		}
+	}
+}
+
+func (s *Service) enqueueWebhook(webhook model.Webhook, change model.CellChange) error {
+	event := WebhookEvent{
+		SubscriptionId: webhook.SubscriptionId,
+		SheetId:        webhook.SpreadsheetId,
+		CellId:         webhook.CellId,
+		EventId:        change.EventId,
+	}
+	if change.Old != nil {
+		old := NewCellResponse(newMaterializedCellResult(*change.Old))
+		event.Old = &old
+	}
+	if change.New != nil || change.Truncated {
+		cell, err := s.changedCell(webhook.SpreadsheetId, webhook.CellId, change)
+		if err != nil {
+			return err
+		}
+		resp := NewCellResponse(cell)
+		event.New = &resp
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	delivery, err := s.dao.SaveDelivery(model.Delivery{
+		SubscriptionId: webhook.SubscriptionId,
+		SpreadsheetId:  webhook.SpreadsheetId,
+		CellId:         webhook.CellId,
+		EventId:        change.EventId,
+		Status:         model.DeliveryPending,
+		Payload:        payload,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.queueWebhook(webhookJob{webhook: webhook, delivery: delivery})
+}
+
+// queueWebhook queues the delivery attempt without blocking, the delivery
+// fails when the queue is full.
+func (s *Service) queueWebhook(job webhookJob) error {
+	s.webhooks.startOnce.Do(func() {
+		for i := 0; i < webhookWorkers; i++ {
+			go s.deliverWebhooks()
+		}
+	})
+
+	select {
+	case s.webhooks.queue <- job:
+		return nil
+	default:
+		delivery := job.delivery
+		delivery.Status = model.DeliveryFailed
+		delivery.Error = ERROR_WEBHOOK_QUEUE_FULL.Error()
+		delivery.NextAttemptAt = nil
+		delivery.UpdatedAt = time.Now().UTC()
+		_, err := s.dao.SaveDelivery(delivery)
+		return err
+	}
+}
+
+// ResumeWebhooks queues the pending deliveries stored before a restart, the
+// ones waiting for a retry are queued at their next attempt time. Deliveries
+// retried by another running instance may be attempted twice, receivers tell
+// them apart by the delivery header.
+func (s *Service) ResumeWebhooks() error {
+	deliveries, err := s.dao.GetPendingDeliveries()
+	if err != nil {
+		return err
+	}
+
+	for _, delivery := range deliveries {
+		data, err := s.dao.GetSubscription(delivery.SubscriptionId)
+		if err == model.ERROR_NO_SUBSCRIPTION {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		webhook, ok := model.WebhookFromSubscription(delivery.SubscriptionId, data)
+		if !ok {
+			continue
+		}
+
+		s.scheduleWebhook(webhookJob{webhook: webhook, delivery: delivery})
+	}
+
+	return nil
+}
+
+// scheduleWebhook queues the delivery at its next attempt time.
+func (s *Service) scheduleWebhook(job webhookJob) {
+	queue := func() {
+		if err := s.queueWebhook(job); err != nil {
+			log.Printf("Failed to queue webhook %s: %v", job.webhook.SubscriptionId, err)
+		}
+	}
+
+	if job.delivery.NextAttemptAt == nil {
+		queue()
+		return
+	}
+
+	delay := time.Until(*job.delivery.NextAttemptAt)
+	if delay <= 0 {
+		queue()
+		return
+	}
+	time.AfterFunc(delay, queue)
+}
+
+func (s *Service) deliverWebhooks() {
+	for job := range s.webhooks.queue {
+		s.deliverWebhook(job)
+	}
+}
+
+// deliverWebhook makes an attempt of the delivery and stores its outcome,
+// deliveries of removed subscriptions are dropped.
+func (s *Service) deliverWebhook(job webhookJob) {
+	if _, err := s.dao.GetSubscription(job.webhook.SubscriptionId); err == model.ERROR_NO_SUBSCRIPTION {
+		return
+	}
+
+	delivery := job.delivery
+	delivery.Attempts++
+	delivery.ResponseStatus, delivery.Error = 0, ""
+	delivery.NextAttemptAt = nil
+
+	status, err := s.postWebhook(job.webhook, delivery)
+	delivery.ResponseStatus = status
+	delivery.UpdatedAt = time.Now().UTC()
+
+	switch {
+	case err == nil:
+		delivery.Status = model.DeliveryDelivered
+	case delivery.Attempts >= s.webhooks.maxAttempts:
+		delivery.Status = model.DeliveryFailed
+		delivery.Error = err.Error()
+	default:
+		next := delivery.UpdatedAt.Add(s.webhooks.backoff(delivery.Attempts))
+		delivery.Error = err.Error()
+		delivery.NextAttemptAt = &next
+	}
+
+	if _, err := s.dao.SaveDelivery(delivery); err != nil {
+		log.Printf("Failed to save delivery %s/%d: %v", delivery.SubscriptionId, delivery.Id, err)
+	}
+
+	if delivery.NextAttemptAt != nil {
+		s.scheduleWebhook(webhookJob{webhook: job.webhook, delivery: delivery})
+	}
+}
+
+// postWebhook sends the signed delivery payload, responses other than 2xx
+// fail.
+func (s *Service) postWebhook(webhook model.Webhook, delivery model.Delivery) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.Url, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookDeliveryHeader, strconv.FormatInt(delivery.Id, 10))
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhook(webhook.Secret, timestamp, delivery.Payload))
+
+	resp, err := s.webhooks.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("Unexpected response status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// listDeliveries returns the deliveries of the subscription from the oldest
+// one, failed only when status is given.
+func (s *Service) listDeliveries(w http.ResponseWriter, r *http.Request, status string) {
+	vars := mux.Vars(r)
+	subId := vars["subscribe_id"]
+
+	if _, err := s.dao.GetSubscription(subId); err != nil {
+		log.Printf("Failed to get subscription: %v", err)
+		if err == model.ERROR_NO_SUBSCRIPTION {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	deliveries, err := s.dao.GetDeliveries(subId)
+	if err != nil {
+		log.Printf("Failed to get deliveries: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	resp := []DeliveryResponse{}
+	for _, delivery := range deliveries {
+		if status == "" || delivery.Status == status {
+			resp = append(resp, NewDeliveryResponse(delivery))
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,370 @@
+package service
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"devchallenge.it/spreadsheet/internal/model"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type webhookRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// NewWebhookReceiver records the received requests, the first failures
+// requests are answered with 500.
+func NewWebhookReceiver(t *testing.T, failures int32) (*httptest.Server, chan webhookRequest) {
+	requests := make(chan webhookRequest, 16)
+	var received int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- webhookRequest{header: r.Header, body: body}
+
+		if atomic.AddInt32(&received, 1) <= failures {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, requests
+}
+
+// NewWebhookTestContext retries webhook deliveries without delays.
+func NewWebhookTestContext(t *testing.T, maxAttempts int) *mux.Router {
+	_, dao := NewMiniredisTestContext(t)
+	router := mux.NewRouter()
+	s := NewService(router, dao)
+	s.AllowPrivateWebhooks()
+	s.webhooks.maxAttempts = maxAttempts
+	s.webhooks.baseDelay = time.Millisecond
+	s.webhooks.maxDelay = 5 * time.Millisecond
+
+	return router
+}
+
+func SubscribeWebhook(router *mux.Router, sheetId, cellId, callbackUrl string) *httptest.ResponseRecorder {
+	jsonBody, _ := json.Marshal(SubscribePayload{CallbackUrl: callbackUrl})
+
+	request, _ := http.NewRequest(http.MethodPost, "/"+sheetId+"/"+cellId+"/subscribe", bytes.NewReader(jsonBody))
+	request.Header.Add("Content-Type", "application/json")
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+
+	return response
+}
+
+func receiveWebhook(t *testing.T, requests chan webhookRequest) webhookRequest {
+	select {
+	case req := <-requests:
+		return req
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "webhook is not delivered")
+		return webhookRequest{}
+	}
+}
+
+// waitDeliveries returns the deliveries listed at the path once the last one
+// has the status.
+func waitDeliveries(t *testing.T, router *mux.Router, path, status string) []DeliveryResponse {
+	var deliveries []DeliveryResponse
+	assert.Eventually(t, func() bool {
+		response := Get(router, path)
+		require.Equal(t, http.StatusOK, response.Code)
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&deliveries))
+		return len(deliveries) > 0 && deliveries[len(deliveries)-1].Status == status
+	}, 5*time.Second, 5*time.Millisecond)
+
+	return deliveries
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	router := NewWebhookTestContext(t, 3)
+	receiver, requests := NewWebhookReceiver(t, 0)
+
+	response := SubscribeWebhook(router, "devchallenge-xx", "var1", receiver.URL+"/hook")
+	require.Equal(t, http.StatusCreated, response.Code)
+
+	var resp SubsribeResponse
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&resp))
+	assert.Equal(t, receiver.URL+"/hook", resp.CallbackUrl)
+	assert.Equal(t, "http:///sub/1", resp.WebhookUrl)
+	assert.Equal(t, "http:///sub/1/deliveries", resp.DeliveriesUrl)
+	assert.Len(t, resp.Secret, 64)
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "1").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var2", "2").Code)
+
+	req := receiveWebhook(t, requests)
+	assert.Equal(t, "application/json", req.header.Get("Content-Type"))
+	assert.Equal(t, "1", req.header.Get(WebhookDeliveryHeader))
+	assert.Equal(t, "sha256="+SignWebhook(resp.Secret, req.header.Get(WebhookTimestampHeader), req.body), req.header.Get(WebhookSignatureHeader))
+	assert.JSONEq(t, `{"subscription_id": "1", "sheet_id": "devchallenge-xx", "cell_id": "var1", "event_id": 1, "new": {"value": "1", "result": "1"}}`, string(req.body))
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "=var2 * 2").Code)
+
+	req = receiveWebhook(t, requests)
+	assert.JSONEq(t, `{"subscription_id": "1", "sheet_id": "devchallenge-xx", "cell_id": "var1", "event_id": 3, "old": {"value": "1", "result": "1"}, "new": {"value": "=var2 * 2", "result": "4"}}`, string(req.body))
+
+	deliveries := waitDeliveries(t, router, "/sub/1/deliveries", "delivered")
+	require.Len(t, deliveries, 2)
+	assert.Equal(t, int64(2), deliveries[1].Id)
+	assert.Equal(t, int64(3), deliveries[1].EventId)
+	assert.Equal(t, 1, deliveries[1].Attempts)
+	assert.Equal(t, http.StatusNoContent, deliveries[1].ResponseStatus)
+	assert.JSONEq(t, string(req.body), string(deliveries[1].Payload))
+}
+
+func TestWebhookRetry(t *testing.T) {
+	router := NewWebhookTestContext(t, 3)
+	receiver, requests := NewWebhookReceiver(t, 2)
+
+	require.Equal(t, http.StatusCreated, SubscribeWebhook(router, "devchallenge-xx", "var1", receiver.URL).Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "1").Code)
+
+	// The same delivery is signed again on every attempt
+	var bodies []string
+	for i := 0; i < 3; i++ {
+		req := receiveWebhook(t, requests)
+		assert.Equal(t, "1", req.header.Get(WebhookDeliveryHeader))
+		bodies = append(bodies, string(req.body))
+	}
+	assert.Equal(t, bodies[0], bodies[2])
+
+	deliveries := waitDeliveries(t, router, "/sub/1/deliveries", "delivered")
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, 3, deliveries[0].Attempts)
+	assert.Empty(t, deliveries[0].Error)
+	assert.Nil(t, deliveries[0].NextAttemptAt)
+
+	response := Get(router, "/sub/1/dead-letters")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `[]`, response.Body.String())
+}
+
+func TestWebhookDeadLetter(t *testing.T) {
+	router := NewWebhookTestContext(t, 3)
+	receiver, requests := NewWebhookReceiver(t, 10)
+
+	require.Equal(t, http.StatusCreated, SubscribeWebhook(router, "devchallenge-xx", "var1", receiver.URL).Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "1").Code)
+
+	for i := 0; i < 3; i++ {
+		receiveWebhook(t, requests)
+	}
+
+	deliveries := waitDeliveries(t, router, "/sub/1/dead-letters", "failed")
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, 3, deliveries[0].Attempts)
+	assert.Equal(t, http.StatusInternalServerError, deliveries[0].ResponseStatus)
+	assert.Equal(t, "Unexpected response status 500", deliveries[0].Error)
+	assert.Nil(t, deliveries[0].NextAttemptAt)
+
+	// No attempt is made after the last one
+	select {
+	case <-requests:
+		assert.Fail(t, "failed delivery is retried")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestWebhookDeletedSubscription(t *testing.T) {
+	router := NewWebhookTestContext(t, 3)
+	receiver, requests := NewWebhookReceiver(t, 10)
+
+	require.Equal(t, http.StatusCreated, SubscribeWebhook(router, "devchallenge-xx", "var1", receiver.URL).Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "1").Code)
+	receiveWebhook(t, requests)
+
+	// Pending retries are dropped with the spreadsheet
+	assert.Equal(t, http.StatusNoContent, Delete(router, "/devchallenge-xx").Code)
+	assert.Equal(t, http.StatusNotFound, Get(router, "/sub/1/deliveries").Code)
+}
+
+func TestSubscribeInvalidCallback(t *testing.T) {
+	router, _ := NewMiniredisTestContext(t)
+
+	for _, callbackUrl := range []string{"", "localhost/hook", "ftp://localhost/hook", "http:///hook"} {
+		assert.Equal(t, http.StatusBadRequest, SubscribeWebhook(router, "devchallenge-xx", "var1", callbackUrl).Code, callbackUrl)
+	}
+
+	request, _ := http.NewRequest(http.MethodPost, "/devchallenge-xx/var1/subscribe", bytes.NewReader([]byte(`{"callback_url": "http://localhost"}`)))
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+
+	// Pull subscriptions have no deliveries
+	request, _ = http.NewRequest(http.MethodPost, "/devchallenge-xx/var1/subscribe", nil)
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusCreated, response.Code)
+	assert.JSONEq(t, `{"webhook_url": "http:///sub/1"}`, response.Body.String())
+
+	response = Get(router, "/sub/1/deliveries")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `[]`, response.Body.String())
+	assert.Equal(t, http.StatusNotFound, Get(router, "/sub/2/deliveries").Code)
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("no entropy")
+}
+
+// FailRandom makes crypto/rand fail until the test ends.
+func FailRandom(t *testing.T) {
+	reader := rand.Reader
+	rand.Reader = failingReader{}
+	t.Cleanup(func() { rand.Reader = reader })
+}
+
+func TestSubscribeSecretFailure(t *testing.T) {
+	router := NewWebhookTestContext(t, 1)
+	FailRandom(t)
+
+	assert.Equal(t, http.StatusInternalServerError, SubscribeWebhook(router, "devchallenge-xx", "var1", "http://localhost/hook").Code)
+	assert.Equal(t, http.StatusNotFound, Get(router, "/sub/1/deliveries").Code)
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	w := newWebhookWorker()
+
+	assert.Equal(t, time.Second, w.backoff(1))
+	assert.Equal(t, 2*time.Second, w.backoff(2))
+	assert.Equal(t, 32*time.Second, w.backoff(6))
+	assert.Equal(t, time.Minute, w.backoff(7))
+	assert.Equal(t, time.Minute, w.backoff(100))
+}
+
+func TestWebhookQueueFull(t *testing.T) {
+	_, dao := NewMiniredisTestContext(t)
+	router := mux.NewRouter()
+	s := NewService(router, dao)
+	s.AllowPrivateWebhooks()
+
+	// No worker receives from the queue, so it is always full
+	s.webhooks.queue = make(chan webhookJob)
+	s.webhooks.startOnce.Do(func() {})
+
+	receiver, requests := NewWebhookReceiver(t, 0)
+	require.Equal(t, http.StatusCreated, SubscribeWebhook(router, "devchallenge-xx", "var1", receiver.URL).Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "1").Code)
+
+	deliveries := waitDeliveries(t, router, "/sub/1/dead-letters", "failed")
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, 0, deliveries[0].Attempts)
+	assert.Equal(t, ERROR_WEBHOOK_QUEUE_FULL.Error(), deliveries[0].Error)
+
+	// A retry of a failed attempt is not blocked on the full queue either
+	webhooks, err := dao.GetWebhooks("devchallenge-xx", []string{"var1"})
+	require.NoError(t, err)
+	require.Len(t, webhooks, 1)
+	stored, err := dao.GetDeliveries("1")
+	require.NoError(t, err)
+	require.Len(t, stored, 1)
+
+	retry := stored[0]
+	retry.Status, retry.Attempts = model.DeliveryPending, 1
+	assert.NoError(t, s.queueWebhook(webhookJob{webhook: webhooks[0], delivery: retry}))
+
+	deliveries = waitDeliveries(t, router, "/sub/1/dead-letters", "failed")
+	assert.Equal(t, 1, deliveries[0].Attempts)
+	assert.Empty(t, requests)
+}
+
+func TestResumeWebhooks(t *testing.T) {
+	_, dao := NewMiniredisTestContext(t)
+	router := mux.NewRouter()
+	s := NewService(router, dao)
+	s.AllowPrivateWebhooks()
+	receiver, requests := NewWebhookReceiver(t, 0)
+
+	subId, err := dao.CreateWebhook("devchallenge-xx", "var1", receiver.URL, "secret")
+	require.NoError(t, err)
+
+	// Deliveries left pending by a previous process, one of them was to be
+	// retried already and one is retried later
+	past := time.Now().UTC().Add(-time.Minute)
+	future := time.Now().UTC().Add(50 * time.Millisecond)
+	for _, next := range []*time.Time{&past, &future} {
+		_, err := dao.SaveDelivery(model.Delivery{
+			SubscriptionId: subId,
+			SpreadsheetId:  "devchallenge-xx",
+			CellId:         "var1",
+			Status:         model.DeliveryPending,
+			Attempts:       1,
+			Payload:        json.RawMessage(`{"cell_id": "var1"}`),
+			NextAttemptAt:  next,
+		})
+		require.NoError(t, err)
+	}
+	_, err = dao.SaveDelivery(model.Delivery{SubscriptionId: subId, SpreadsheetId: "devchallenge-xx", CellId: "var1", Status: model.DeliveryDelivered, Payload: json.RawMessage(`{}`)})
+	require.NoError(t, err)
+
+	require.NoError(t, s.ResumeWebhooks())
+
+	assert.Equal(t, "1", receiveWebhook(t, requests).header.Get(WebhookDeliveryHeader))
+	assert.Equal(t, "2", receiveWebhook(t, requests).header.Get(WebhookDeliveryHeader))
+
+	assert.Eventually(t, func() bool {
+		pending, err := dao.GetPendingDeliveries()
+		return err == nil && len(pending) == 0
+	}, 5*time.Second, 5*time.Millisecond)
+
+	deliveries, err := dao.GetDeliveries(subId)
+	require.NoError(t, err)
+	for _, delivery := range deliveries[:2] {
+		assert.Equal(t, model.DeliveryDelivered, delivery.Status)
+		assert.Equal(t, 2, delivery.Attempts)
+	}
+}
+
+func TestSubscribeInternalCallback(t *testing.T) {
+	router, _ := NewMiniredisTestContext(t)
+
+	for _, callbackUrl := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://[::1]/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://10.0.0.1/hook",
+		"https://192.168.1.1/hook",
+		"http://100.64.0.1/hook",
+		"http://0.0.0.0/hook",
+		"http://[::ffff:127.0.0.1]/hook",
+	} {
+		assert.Equal(t, http.StatusBadRequest, SubscribeWebhook(router, "devchallenge-xx", "var1", callbackUrl).Code, callbackUrl)
+	}
+}
+
+func TestWebhookInternalAddress(t *testing.T) {
+	w := newWebhookWorker()
+
+	assert.NoError(t, w.checkAddress(netip.MustParseAddr("93.184.216.34")))
+	assert.NoError(t, w.checkAddress(netip.MustParseAddr("2606:2800:220:1::1")))
+	assert.Equal(t, ERROR_WEBHOOK_ADDRESS, w.checkAddress(netip.MustParseAddr("172.16.0.1")))
+	assert.Equal(t, ERROR_WEBHOOK_ADDRESS, w.checkAddress(netip.MustParseAddr("fe80::1")))
+	assert.Equal(t, ERROR_WEBHOOK_ADDRESS, w.checkAddress(netip.MustParseAddr("fd00::1")))
+
+	// Connections are checked as well, e.g. when the host is resolved to
+	// another address after subscribing
+	receiver, requests := NewWebhookReceiver(t, 0)
+	_, err := w.client.Post(receiver.URL, "application/json", nil)
+	assert.ErrorIs(t, err, ERROR_WEBHOOK_ADDRESS)
+	assert.Empty(t, requests)
+}
@@ -0,0 +1,287 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"devchallenge.it/spreadsheet/internal/model"
+	"golang.org/x/net/websocket"
+)
+
+// WsRequest is a message sent by a WebSocket client. Subscribe and
+// unsubscribe refer to the listed cells or, without cells, to the whole
+// spreadsheet. Upsert sets the cell value.
+type WsRequest struct {
+	Type    string   `json:"type"`
+	Id      string   `json:"id"`
+	SheetId string   `json:"sheet_id"`
+	CellIds []string `json:"cell_ids"`
+	CellId  string   `json:"cell_id"`
+	Value   string   `json:"value"`
+}
+
+// WsMessage is a message sent to a WebSocket client, replies repeat the
+// request id. Upsert replies carry the status the upsert route would
+// respond with.
+type WsMessage struct {
+	Type    string        `json:"type"`
+	Id      string        `json:"id,omitempty"`
+	SheetId string        `json:"sheet_id,omitempty"`
+	CellId  string        `json:"cell_id,omitempty"`
+	EventId int64         `json:"event_id,omitempty"`
+	Status  int           `json:"status,omitempty"`
+	Cell    *CellResponse `json:"cell,omitempty"`
+	Error   string        `json:"error,omitempty"`
+}
+
+const (
+	wsSubscribe   = "subscribe"
+	wsUnsubscribe = "unsubscribe"
+	wsUpsert      = "upsert"
+	wsAck         = "ack"
+	wsChange      = "change"
+	wsError       = "error"
+)
+
+var ERROR_WS_REQUEST_TYPE = errors.New("Unknown request type")
+var ERROR_WS_SHEET_ID = errors.New("Spreadsheet id is required")
+
+// newWebsocketHandler accepts connections of any origin like the CORS
+// headers of the other routes.
+func (s *Service) newWebsocketHandler() http.Handler {
+	return websocket.Server{
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler:   s.serveWebsocket,
+	}
+}
+
+// wsSheet is a spreadsheet subscription of a connection, changes of other
+// cells are dropped unless all of them are subscribed.
+type wsSheet struct {
+	subscriber model.Subscriber
+	all        bool
+	cells      map[string]bool
+}
+
+type wsConn struct {
+	s      *Service
+	ws     *websocket.Conn
+	ctx    context.Context
+	author string
+
+	// sendMu orders the initial results of the subscribed cells before
+	// their changes
+	sendMu sync.Mutex
+
+	mu     sync.Mutex
+	sheets map[string]*wsSheet
+	wg     sync.WaitGroup
+}
+
+func (s *Service) serveWebsocket(ws *websocket.Conn) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &wsConn{
+		s:      s,
+		ws:     ws,
+		ctx:    ctx,
+		author: requestAuthor(ws.Request()),
+		sheets: make(map[string]*wsSheet),
+	}
+	defer func() {
+		cancel()
+		c.closeSheets()
+		c.wg.Wait()
+	}()
+
+	for {
+		var req WsRequest
+		err := websocket.JSON.Receive(ws, &req)
+		if err != nil {
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+				c.send(WsMessage{Type: wsError, Error: err.Error()})
+				continue
+			}
+			return
+		}
+
+		switch req.Type {
+		case wsSubscribe:
+			c.subscribe(req)
+		case wsUnsubscribe:
+			c.unsubscribe(req)
+		case wsUpsert:
+			c.upsert(req)
+		default:
+			c.send(WsMessage{Type: wsError, Id: req.Id, Error: ERROR_WS_REQUEST_TYPE.Error()})
+		}
+	}
+}
+
+func (c *wsConn) send(msg WsMessage) {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	c.sendLocked(msg)
+}
+
+func (c *wsConn) sendLocked(msg WsMessage) {
+	if err := websocket.JSON.Send(c.ws, msg); err != nil {
+		log.Printf("WebSocket send failure: %v", err)
+	}
+}
+
+func (c *wsConn) subscribe(req WsRequest) {
+	if req.SheetId == "" {
+		c.send(WsMessage{Type: wsError, Id: req.Id, Error: ERROR_WS_SHEET_ID.Error()})
+		return
+	}
+	sheetId := strings.ToLower(req.SheetId)
+
+	c.mu.Lock()
+	sheet, exists := c.sheets[sheetId]
+	if !exists {
+		subscriber, err := c.s.dao.SubscribeSpreadsheet(sheetId)
+		if err != nil {
+			c.mu.Unlock()
+			log.Printf("Failed to subscribe: %v", err)
+			c.send(WsMessage{Type: wsError, Id: req.Id, Error: err.Error()})
+			return
+		}
+
+		sheet = &wsSheet{subscriber: subscriber, cells: make(map[string]bool)}
+		c.sheets[sheetId] = sheet
+
+		c.wg.Add(1)
+		go c.forward(sheetId, sheet)
+	}
+
+	if len(req.CellIds) == 0 {
+		sheet.all = true
+	}
+	for _, cellId := range req.CellIds {
+		sheet.cells[strings.ToLower(cellId)] = true
+	}
+	c.mu.Unlock()
+
+	// The cells are read after subscribing and sent before any change
+	// received meanwhile, so a client never sees an older result last
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	c.sendLocked(WsMessage{Type: wsAck, Id: req.Id})
+	for _, cellId := range req.CellIds {
+		cell, err := c.s.readCell(sheetId, cellId)
+		if err != nil {
+			log.Printf("Failed to get cell: %s", err)
+			c.sendLocked(WsMessage{Type: wsError, Id: req.Id, SheetId: sheetId, CellId: strings.ToLower(cellId), Error: err.Error()})
+			continue
+		}
+
+		resp := NewCellResponse(cell)
+		c.sendLocked(WsMessage{Type: wsChange, SheetId: sheetId, CellId: strings.ToLower(cellId), Cell: &resp})
+	}
+}
+
+func (c *wsConn) unsubscribe(req WsRequest) {
+	sheetId := strings.ToLower(req.SheetId)
+
+	c.mu.Lock()
+	if sheet, exists := c.sheets[sheetId]; exists {
+		for _, cellId := range req.CellIds {
+			delete(sheet.cells, strings.ToLower(cellId))
+		}
+
+		if len(req.CellIds) == 0 || (!sheet.all && len(sheet.cells) == 0) {
+			delete(c.sheets, sheetId)
+			sheet.subscriber.Close()
+		}
+	}
+	c.mu.Unlock()
+
+	c.send(WsMessage{Type: wsAck, Id: req.Id})
+}
+
+// upsert validates and stores the value like the upsert route.
+func (c *wsConn) upsert(req WsRequest) {
+	reply := WsMessage{Type: wsUpsert, Id: req.Id, SheetId: strings.ToLower(req.SheetId), CellId: strings.ToLower(req.CellId)}
+
+	if req.SheetId == "" || !IsVariable(req.CellId) || IsReservedCellId(req.CellId) {
+		log.Printf("Cell ID %q is not valid variable", req.CellId)
+		reply.Status = http.StatusBadRequest
+		c.send(reply)
+		return
+	}
+
+	origin := model.Origin{Author: c.author, RequestId: newRequestId()}
+	result, value, formulaError, err := c.s.storeCell(req.SheetId, origin, req.CellId, req.Value)
+	if err != nil {
+		log.Print(err)
+		reply.Status = http.StatusInternalServerError
+		if err == model.ERROR_UPDATE_CONFLICT {
+			reply.Status = http.StatusConflict
+		}
+		c.send(reply)
+		return
+	}
+
+	reply.Status = http.StatusCreated
+	if formulaError != nil {
+		reply.Status = http.StatusUnprocessableEntity
+	}
+
+	resp := NewCellResponse(CellResult{Result: result, Value: value, FormulaError: formulaError})
+	reply.Cell = &resp
+	c.send(reply)
+}
+
+// forward sends the subscribed changes of the spreadsheet until its
+// subscriber is closed.
+func (c *wsConn) forward(sheetId string, sheet *wsSheet) {
+	defer c.wg.Done()
+
+	for {
+		msg, err := sheet.subscriber.ReceiveMessage(c.ctx)
+		if err != nil {
+			return
+		}
+
+		var change model.CellChange
+		if err := json.Unmarshal([]byte(msg), &change); err != nil {
+			log.Printf("Invalid cell change %q: %v", msg, err)
+			continue
+		}
+
+		c.mu.Lock()
+		subscribed := c.sheets[sheetId] == sheet && (sheet.all || sheet.cells[change.CellId])
+		c.mu.Unlock()
+		if !subscribed {
+			continue
+		}
+
+		cell, err := c.s.changedCell(sheetId, change.CellId, change)
+		if err != nil {
+			log.Printf("Failed to get cell: %s", err)
+			continue
+		}
+
+		resp := NewCellResponse(cell)
+		c.send(WsMessage{Type: wsChange, SheetId: sheetId, CellId: change.CellId, EventId: change.EventId, Cell: &resp})
+	}
+}
+
+func (c *wsConn) closeSheets() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for sheetId, sheet := range c.sheets {
+		sheet.subscriber.Close()
+		delete(c.sheets, sheetId)
+	}
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+// DialWebsocket connects to the WebSocket route of the router served over
+// HTTP.
+func DialWebsocket(t *testing.T, router *mux.Router) *websocket.Conn {
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", "", server.URL)
+	require.NoError(t, err)
+	t.Cleanup(func() { ws.Close() })
+
+	return ws
+}
+
+func sendWs(t *testing.T, ws *websocket.Conn, req WsRequest) {
+	require.NoError(t, websocket.JSON.Send(ws, req))
+}
+
+func receiveWs(t *testing.T, ws *websocket.Conn) WsMessage {
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var msg WsMessage
+	require.NoError(t, websocket.JSON.Receive(ws, &msg))
+	return msg
+}
+
+func wsCell(value, result string) *CellResponse {
+	return &CellResponse{Value: value, Result: result}
+}
+
+func TestWebsocketSubscribeCells(t *testing.T) {
+	router, _ := NewMiniredisTestContext(t)
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "1").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var2", "=var1 + 1").Code)
+
+	ws := DialWebsocket(t, router)
+
+	// The current results follow the acknowledgement
+	sendWs(t, ws, WsRequest{Type: "subscribe", Id: "1", SheetId: "DevChallenge-XX", CellIds: []string{"VAR2", "var3"}})
+	assert.Equal(t, WsMessage{Type: "ack", Id: "1"}, receiveWs(t, ws))
+	assert.Equal(t, WsMessage{Type: "change", SheetId: "devchallenge-xx", CellId: "var2", Cell: wsCell("=var1 + 1", "2")}, receiveWs(t, ws))
+
+	noSuchCell := "No such cellId"
+	assert.Equal(t, WsMessage{Type: "change", SheetId: "devchallenge-xx", CellId: "var3", Cell: &CellResponse{Error: &noSuchCell}}, receiveWs(t, ws))
+
+	// Changes of other cells are not sent
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var4", "4").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "2").Code)
+
+	msg := receiveWs(t, ws)
+	assert.NotZero(t, msg.EventId)
+	msg.EventId = 0
+	assert.Equal(t, WsMessage{Type: "change", SheetId: "devchallenge-xx", CellId: "var2", Cell: wsCell("=var1 + 1", "3")}, msg)
+
+	sendWs(t, ws, WsRequest{Type: "unsubscribe", Id: "2", SheetId: "devchallenge-xx", CellIds: []string{"var2"}})
+	assert.Equal(t, WsMessage{Type: "ack", Id: "2"}, receiveWs(t, ws))
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var3", "3").Code)
+	msg = receiveWs(t, ws)
+	msg.EventId = 0
+	assert.Equal(t, WsMessage{Type: "change", SheetId: "devchallenge-xx", CellId: "var3", Cell: wsCell("3", "3")}, msg)
+
+	// var2 is no longer subscribed
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "3").Code)
+	sendWs(t, ws, WsRequest{Type: "unsubscribe", Id: "3", SheetId: "devchallenge-xx"})
+	assert.Equal(t, WsMessage{Type: "ack", Id: "3"}, receiveWs(t, ws))
+}
+
+func TestWebsocketSubscribeSpreadsheets(t *testing.T) {
+	router, _ := NewMiniredisTestContext(t)
+
+	ws := DialWebsocket(t, router)
+
+	sendWs(t, ws, WsRequest{Type: "subscribe", Id: "1", SheetId: "devchallenge-xx"})
+	assert.Equal(t, WsMessage{Type: "ack", Id: "1"}, receiveWs(t, ws))
+	sendWs(t, ws, WsRequest{Type: "subscribe", Id: "2", SheetId: "devchallenge-yy"})
+	assert.Equal(t, WsMessage{Type: "ack", Id: "2"}, receiveWs(t, ws))
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "1").Code)
+	msg := receiveWs(t, ws)
+	msg.EventId = 0
+	assert.Equal(t, WsMessage{Type: "change", SheetId: "devchallenge-xx", CellId: "var1", Cell: wsCell("1", "1")}, msg)
+
+	sendWs(t, ws, WsRequest{Type: "unsubscribe", Id: "3", SheetId: "devchallenge-xx"})
+	assert.Equal(t, WsMessage{Type: "ack", Id: "3"}, receiveWs(t, ws))
+
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-xx", "var1", "2").Code)
+	assert.Equal(t, http.StatusCreated, PostCell(router, "devchallenge-yy", "var1", "3").Code)
+	msg = receiveWs(t, ws)
+	msg.EventId = 0
+	assert.Equal(t, WsMessage{Type: "change", SheetId: "devchallenge-yy", CellId: "var1", Cell: wsCell("3", "3")}, msg)
+}
+
+func TestWebsocketUpsert(t *testing.T) {
+	router, _ := NewMiniredisTestContext(t)
+
+	ws := DialWebsocket(t, router)
+
+	sendWs(t, ws, WsRequest{Type: "upsert", Id: "1", SheetId: "devchallenge-xx", CellId: "Var1", Value: "1"})
+	assert.Equal(t, WsMessage{Type: "upsert", Id: "1", SheetId: "devchallenge-xx", CellId: "var1", Status: http.StatusCreated, Cell: wsCell("1", "1")}, receiveWs(t, ws))
+
+	sendWs(t, ws, WsRequest{Type: "upsert", Id: "2", SheetId: "devchallenge-xx", CellId: "var2", Value: "=var1 + 1"})
+	assert.Equal(t, WsMessage{Type: "upsert", Id: "2", SheetId: "devchallenge-xx", CellId: "var2", Status: http.StatusCreated, Cell: wsCell("=var1 + 1", "2")}, receiveWs(t, ws))
+
+	// A value breaking the dependant is rejected like the upsert route does
+	sendWs(t, ws, WsRequest{Type: "upsert", Id: "3", SheetId: "devchallenge-xx", CellId: "var1", Value: "text"})
+	msg := receiveWs(t, ws)
+	assert.Equal(t, http.StatusUnprocessableEntity, msg.Status)
+	assert.Equal(t, "3", msg.Id)
+
+	sendWs(t, ws, WsRequest{Type: "upsert", Id: "4", SheetId: "devchallenge-xx", CellId: "var+1", Value: "1"})
+	assert.Equal(t, WsMessage{Type: "upsert", Id: "4", SheetId: "devchallenge-xx", CellId: "var+1", Status: http.StatusBadRequest}, receiveWs(t, ws))
+
+	sendWs(t, ws, WsRequest{Type: "upsert", Id: "4", SheetId: "devchallenge-xx", CellId: "undo", Value: "1"})
+	assert.Equal(t, WsMessage{Type: "upsert", Id: "4", SheetId: "devchallenge-xx", CellId: "undo", Status: http.StatusBadRequest}, receiveWs(t, ws))
+
+	sendWs(t, ws, WsRequest{Type: "delete", Id: "5"})
+	assert.Equal(t, WsMessage{Type: "error", Id: "5", Error: ERROR_WS_REQUEST_TYPE.Error()}, receiveWs(t, ws))
+
+	require.NoError(t, websocket.Message.Send(ws, "{"))
+	assert.Equal(t, "error", receiveWs(t, ws).Type)
+
+	response := Get(router, "/devchallenge-xx/var1")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"value": "1", "result": "1"}`, response.Body.String())
+}
+
+func TestWebsocketRouteSpreadsheet(t *testing.T) {
+	router, _ := NewMiniredisTestContext(t)
+
+	// Plain requests read the spreadsheet named ws
+	assert.Equal(t, http.StatusCreated, PostCell(router, "ws", "var1", "1").Code)
+
+	response := Get(router, "/ws")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Contains(t, response.Body.String(), "var1")
+}